@@ -0,0 +1,161 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/buildium-org/buildium_harness/logger"
+)
+
+// LogStage is the stage build logs are written under, before the first step.
+const LogStage = -1
+
+// Diagnostic is one compiler message.
+type Diagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	location := d.File
+	if d.Line > 0 {
+		location += ":" + strconv.Itoa(d.Line)
+	}
+	if d.Column > 0 {
+		location += ":" + strconv.Itoa(d.Column)
+	}
+	return fmt.Sprintf("%s: %s: %s", location, d.Severity, d.Message)
+}
+
+type Result struct {
+	Command     string
+	Dir         string
+	Output      string
+	Duration    time.Duration
+	Diagnostics []Diagnostic
+	Err         error
+}
+
+// Run executes command with sh -c in dir and parses its output.
+func Run(ctx context.Context, command string, dir string) *Result {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = dir
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	start := time.Now()
+	err := cmd.Run()
+	result := &Result{Command: command, Dir: dir, Output: output.String(), Duration: time.Since(start)}
+	result.Diagnostics = ParseOutput(result.Output)
+	if err != nil {
+		result.Err = fmt.Errorf("build failed: %v", err)
+	}
+	return result
+}
+
+var (
+	// file:line:col: [severity:] message, as printed by go, gcc, clang and javac
+	lineColPattern = regexp.MustCompile(`^(\S[^:]*?):(\d+):(?:(\d+):)?\s*(?:(fatal error|error|warning|note|info):\s*)?(.+)$`)
+	// file(line,col): severity code: message, as printed by tsc and msbuild
+	parenPattern = regexp.MustCompile(`^(\S[^(]*?)\((\d+),(\d+)\):\s*(error|warning|info)\s*(?:\w+\d+)?:\s*(.+)$`)
+	// severity[code]: message followed by "--> file:line:col", as printed by rustc
+	rustHeaderPattern   = regexp.MustCompile(`^(error|warning)(?:\[\w+\])?:\s*(.+)$`)
+	rustLocationPattern = regexp.MustCompile(`^\s*-->\s*(.+?):(\d+):(\d+)$`)
+)
+
+// ParseOutput extracts file:line:col diagnostics from compiler output.
+// Messages without a severity are treated as errors.
+func ParseOutput(output string) []Diagnostic {
+	var diagnostics []Diagnostic
+	var pending *Diagnostic
+	for _, line := range strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n") {
+		if pending != nil {
+			if match := rustLocationPattern.FindStringSubmatch(line); match != nil {
+				pending.File = match[1]
+				pending.Line, _ = strconv.Atoi(match[2])
+				pending.Column, _ = strconv.Atoi(match[3])
+				diagnostics = append(diagnostics, *pending)
+				pending = nil
+				continue
+			}
+		}
+		if match := rustHeaderPattern.FindStringSubmatch(line); match != nil {
+			pending = &Diagnostic{Severity: match[1], Message: match[2]}
+			continue
+		}
+		if match := parenPattern.FindStringSubmatch(line); match != nil {
+			lineNumber, _ := strconv.Atoi(match[2])
+			column, _ := strconv.Atoi(match[3])
+			diagnostics = append(diagnostics, Diagnostic{File: match[1], Line: lineNumber, Column: column, Severity: match[4], Message: match[5]})
+			continue
+		}
+		if match := lineColPattern.FindStringSubmatch(line); match != nil {
+			lineNumber, _ := strconv.Atoi(match[2])
+			column, _ := strconv.Atoi(match[3])
+			severity := match[4]
+			if severity == "" || severity == "fatal error" {
+				severity = "error"
+			}
+			diagnostics = append(diagnostics, Diagnostic{File: strings.TrimPrefix(match[1], "./"), Line: lineNumber, Column: column, Severity: severity, Message: match[5]})
+		}
+	}
+	return diagnostics
+}
+
+func (r *Result) Errors() []Diagnostic {
+	var errs []Diagnostic
+	for _, diagnostic := range r.Diagnostics {
+		if diagnostic.Severity == "error" {
+			errs = append(errs, diagnostic)
+		}
+	}
+	return errs
+}
+
+// Extras returns the build result in the shape uploaded alongside a project run.
+func (r *Result) Extras() map[string]any {
+	return map[string]any{"build": map[string]any{
+		"command":     r.Command,
+		"succeeded":   r.Err == nil,
+		"durationMs":  r.Duration.Milliseconds(),
+		"diagnostics": r.Diagnostics,
+	}}
+}
+
+// Log reports the build under its own title. When the output can't be parsed
+// it is shown as is.
+func (r *Result) Log(l *logger.Logger) {
+	l.LogTitle("Build")
+	l.LogInfo(fmt.Sprintf("Running `%s` in %s", r.Command, r.Dir))
+	for _, diagnostic := range r.Diagnostics {
+		switch diagnostic.Severity {
+		case "error":
+			l.LogError(diagnostic.String())
+		case "warning":
+			l.LogWarning(diagnostic.String())
+		default:
+			l.LogInfo(diagnostic.String())
+		}
+	}
+	if r.Err != nil {
+		if len(r.Diagnostics) == 0 {
+			l.LogClientCode(r.Output)
+		}
+		if errs := len(r.Errors()); errs > 0 {
+			l.LogError(fmt.Sprintf("Your project failed to compile with %d errors", errs))
+		} else {
+			l.LogError(fmt.Sprintf("Your project failed to compile: %v", r.Err))
+		}
+		return
+	}
+	l.LogSuccess(fmt.Sprintf("Build succeeded in %v", r.Duration.Round(time.Millisecond)))
+}
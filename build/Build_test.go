@@ -0,0 +1,94 @@
+package build
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/buildium-org/buildium_harness/logger"
+)
+
+func TestParseOutput(t *testing.T) {
+	cases := []struct {
+		name   string
+		output string
+		want   []Diagnostic
+	}{
+		{
+			"go",
+			"# example.com/app\n./main.go:12:5: undefined: foo\n",
+			[]Diagnostic{{File: "main.go", Line: 12, Column: 5, Severity: "error", Message: "undefined: foo"}},
+		},
+		{
+			"gcc",
+			"main.c:3:1: warning: return type defaults to 'int'\nmain.c:4:9: fatal error: missing.h: No such file or directory\n",
+			[]Diagnostic{
+				{File: "main.c", Line: 3, Column: 1, Severity: "warning", Message: "return type defaults to 'int'"},
+				{File: "main.c", Line: 4, Column: 9, Severity: "error", Message: "missing.h: No such file or directory"},
+			},
+		},
+		{
+			"rustc",
+			"error[E0425]: cannot find value `x` in this scope\n --> src/main.rs:2:13\n  |\n",
+			[]Diagnostic{{File: "src/main.rs", Line: 2, Column: 13, Severity: "error", Message: "cannot find value `x` in this scope"}},
+		},
+		{
+			"tsc",
+			"src/index.ts(7,3): error TS2322: Type 'string' is not assignable to type 'number'.\r\n",
+			[]Diagnostic{{File: "src/index.ts", Line: 7, Column: 3, Severity: "error", Message: "Type 'string' is not assignable to type 'number'."}},
+		},
+		{"unstructured", "make: *** No rule to make target 'all'.  Stop.\n", nil},
+	}
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ParseOutput(test.output); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseOutput() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	result := Run(context.Background(), "echo built > out && echo 'main.go:1:1: warning: unused' >&2", dir)
+	if result.Err != nil {
+		t.Fatalf("Run() error = %v", result.Err)
+	}
+	if result.Dir != dir || len(result.Diagnostics) != 1 || result.Diagnostics[0].Severity != "warning" {
+		t.Errorf("result = %+v, want one warning from %s", result, dir)
+	}
+
+	result = Run(context.Background(), "echo 'main.go:3:7: syntax error' >&2; exit 1", dir)
+	if result.Err == nil || len(result.Errors()) != 1 {
+		t.Errorf("result = %+v, want a failed build with one error", result)
+	}
+	build := result.Extras()["build"].(map[string]any)
+	if build["succeeded"] != false || !reflect.DeepEqual(build["diagnostics"], result.Diagnostics) {
+		t.Errorf("Extras() = %v", build)
+	}
+}
+
+func TestResultLog(t *testing.T) {
+	l := logger.NewLogger()
+	l.SetStep(LogStage)
+
+	before := len(logger.GetAllLogs())
+	Run(context.Background(), "echo 'main.go:3:7: syntax error'; exit 1", t.TempDir()).Log(l)
+	logs := logger.GetAllLogs()[before:]
+	if len(logs) != 4 || logs[2].Message != "main.go:3:7: error: syntax error" || logs[3].Type != "FAILURE" {
+		t.Fatalf("logged %+v, want title, command, diagnostic and failure", logs)
+	}
+	for _, log := range logs {
+		if log.Stage != LogStage {
+			t.Errorf("log %+v has stage %d, want %d", log, log.Stage, LogStage)
+		}
+	}
+
+	before = len(logger.GetAllLogs())
+	Run(context.Background(), "echo oops; exit 2", t.TempDir()).Log(l)
+	logs = logger.GetAllLogs()[before:]
+	if len(logs) != 4 || logs[2].Type != "CLIENT_CODE" || !strings.Contains(logs[3].Message, "exit status 2") {
+		t.Errorf("logged %+v, want the raw output when nothing was parsed", logs)
+	}
+}
@@ -0,0 +1,357 @@
+package diagnostics
+
+import (
+	"bytes"
+	"debug/buildinfo"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/buildium-org/buildium_harness/logger"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+type Finding struct {
+	Severity   Severity
+	Message    string
+	Suggestion string
+}
+
+// Report describes why an entrypoint can or can't be run.
+type Report struct {
+	Path string
+	Mode fs.FileMode
+	// Kind is "elf", "script", "macho", "pe", "directory" or "unknown".
+	Kind        string
+	Machine     string
+	Interpreter string
+	GoVersion   string
+	ModulePath  string
+	BuiltAt     time.Time
+	// NewestSource is the most recently modified file under the source directory.
+	NewestSource   string
+	NewestSourceAt time.Time
+	Findings       []Finding
+}
+
+var hostMachines = map[string]elf.Machine{
+	"amd64":   elf.EM_X86_64,
+	"386":     elf.EM_386,
+	"arm64":   elf.EM_AARCH64,
+	"arm":     elf.EM_ARM,
+	"riscv64": elf.EM_RISCV,
+	"ppc64le": elf.EM_PPC64,
+	"s390x":   elf.EM_S390,
+}
+
+var machineNames = map[elf.Machine]string{
+	elf.EM_X86_64:  "x86-64",
+	elf.EM_386:     "x86",
+	elf.EM_AARCH64: "arm64",
+	elf.EM_ARM:     "arm",
+	elf.EM_RISCV:   "riscv",
+	elf.EM_PPC64:   "ppc64",
+	elf.EM_S390:    "s390x",
+}
+
+// Inspect examines the entrypoint at path. When sourceDir is set, the binary's
+// modification time is compared with the newest file under it.
+func Inspect(path string, sourceDir string) *Report {
+	r := &Report{Path: path}
+	info, err := os.Stat(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		r.addError(fmt.Sprintf("Your executable %s does not exist", path),
+			"Build your project first, and check that \"entrypoint\" in meta.json names the built file")
+		return r
+	case err != nil:
+		r.addError(fmt.Sprintf("Your executable %s cannot be read: %v", path, err),
+			"Check the permissions of the file and the directories above it")
+		return r
+	case info.IsDir():
+		r.Kind = "directory"
+		r.addError(fmt.Sprintf("Your executable %s is a directory", path),
+			"Set \"entrypoint\" in meta.json to the built file inside it")
+		return r
+	}
+	r.Mode = info.Mode()
+	r.BuiltAt = info.ModTime()
+	if info.Mode()&0o111 == 0 {
+		r.addError(fmt.Sprintf("Your executable %s is not executable (mode %v)", path, info.Mode().Perm()),
+			fmt.Sprintf("Run `chmod +x %s`", path))
+	}
+
+	header, err := readHeader(path)
+	if err != nil {
+		r.addError(fmt.Sprintf("Your executable %s cannot be read: %v", path, err),
+			"Check the permissions of the file")
+		return r
+	}
+	switch {
+	case bytes.HasPrefix(header, []byte("\x7fELF")):
+		r.Kind = "elf"
+		r.inspectELF()
+	case bytes.HasPrefix(header, []byte("#!")):
+		r.Kind = "script"
+		r.inspectShebang(header)
+	case isMachO(header):
+		r.Kind = "macho"
+		r.addError(fmt.Sprintf("%s was built for macOS, but the tests run on %s", path, runtime.GOOS),
+			crossCompileSuggestion())
+	case bytes.HasPrefix(header, []byte("MZ")):
+		r.Kind = "pe"
+		r.addError(fmt.Sprintf("%s was built for Windows, but the tests run on %s", path, runtime.GOOS),
+			crossCompileSuggestion())
+	default:
+		r.Kind = "unknown"
+		if isText(header) {
+			r.Kind = "script"
+			r.addError(fmt.Sprintf("%s looks like a script but has no shebang line, so it cannot be executed directly", path),
+				"Add an interpreter line such as `#!/usr/bin/env python3` at the very top of the file")
+		} else {
+			r.addError(fmt.Sprintf("%s is not a recognised executable format", path),
+				"Make sure \"entrypoint\" in meta.json points at the compiled program")
+		}
+	}
+
+	if info, err := buildinfo.ReadFile(path); err == nil {
+		r.GoVersion = info.GoVersion
+		r.ModulePath = info.Main.Path
+		if r.ModulePath == "" {
+			r.ModulePath = info.Path
+		}
+	}
+	if sourceDir != "" {
+		r.checkStale(sourceDir)
+	}
+	return r
+}
+
+func (r *Report) addError(message, suggestion string) {
+	r.Findings = append(r.Findings, Finding{Severity: SeverityError, Message: message, Suggestion: suggestion})
+}
+
+func (r *Report) addWarning(message, suggestion string) {
+	r.Findings = append(r.Findings, Finding{Severity: SeverityWarning, Message: message, Suggestion: suggestion})
+}
+
+func (r *Report) inspectELF() {
+	file, err := elf.Open(r.Path)
+	if err != nil {
+		r.addError(fmt.Sprintf("%s is a corrupt ELF file: %v", r.Path, err), "Rebuild your project")
+		return
+	}
+	defer file.Close()
+	r.Machine = machineName(file.Machine)
+	host, known := hostMachines[runtime.GOARCH]
+	if known && file.Machine != host {
+		r.addError(fmt.Sprintf("%s was built for %s, but this machine is %s, which causes \"exec format error\"", r.Path, r.Machine, machineName(host)),
+			crossCompileSuggestion())
+	}
+	if file.Type != elf.ET_EXEC && file.Type != elf.ET_DYN {
+		r.addError(fmt.Sprintf("%s is an ELF %s, not an executable", r.Path, strings.TrimPrefix(file.Type.String(), "ET_")),
+			"Link your project into a program instead of an object file or library")
+		return
+	}
+	for _, prog := range file.Progs {
+		if prog.Type != elf.PT_INTERP {
+			continue
+		}
+		data, err := io.ReadAll(prog.Open())
+		if err != nil {
+			return
+		}
+		r.Interpreter = strings.TrimRight(string(data), "\x00")
+		if _, err := os.Stat(r.Interpreter); err != nil {
+			r.addError(fmt.Sprintf("%s needs the dynamic loader %s, which is not installed here", r.Path, r.Interpreter),
+				"Build a statically linked binary, for example with CGO_ENABLED=0 for Go")
+		}
+	}
+}
+
+func (r *Report) inspectShebang(header []byte) {
+	line, _, _ := bytes.Cut(header[2:], []byte("\n"))
+	if bytes.HasSuffix(line, []byte("\r")) {
+		r.Interpreter = strings.TrimSpace(string(line))
+		r.addError(fmt.Sprintf("%s has Windows line endings, so the interpreter %q is not found", r.Path, r.Interpreter+"\r"),
+			"Convert the file to Unix line endings, for example with `dos2unix`")
+		return
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		r.addError(fmt.Sprintf("%s has an empty shebang line", r.Path), "Name an interpreter, such as `#!/bin/sh`")
+		return
+	}
+	r.Interpreter = strings.Join(fields, " ")
+	if _, err := os.Stat(fields[0]); err != nil {
+		r.addError(fmt.Sprintf("The interpreter %s named in the shebang of %s does not exist", fields[0], r.Path),
+			"Use `#!/usr/bin/env <interpreter>` or the interpreter's installed path")
+		return
+	}
+	if filepath.Base(fields[0]) == "env" && len(fields) > 1 && !strings.HasPrefix(fields[1], "-") {
+		if _, err := exec.LookPath(fields[1]); err != nil {
+			r.addError(fmt.Sprintf("The interpreter %s named in the shebang of %s is not installed", fields[1], r.Path),
+				fmt.Sprintf("Install %s or change the shebang line", fields[1]))
+		}
+	}
+}
+
+// checkStale warns when a source file is newer than the binary. Hidden
+// directories and common dependency and build directories are skipped.
+func (r *Report) checkStale(sourceDir string) {
+	binary, _ := filepath.Abs(r.Path)
+	filepath.WalkDir(sourceDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		name := entry.Name()
+		if entry.IsDir() {
+			if path != sourceDir && (strings.HasPrefix(name, ".") || name == "node_modules" || name == "target" || name == "vendor" || name == "bin") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if abs, _ := filepath.Abs(path); abs == binary || strings.HasPrefix(name, ".") || name == "meta.json" {
+			return nil
+		}
+		info, err := entry.Info()
+		if err == nil && info.ModTime().After(r.NewestSourceAt) {
+			r.NewestSource = path
+			r.NewestSourceAt = info.ModTime()
+		}
+		return nil
+	})
+	if r.NewestSource != "" && r.NewestSourceAt.After(r.BuiltAt) {
+		r.addWarning(fmt.Sprintf("%s was modified at %s, after %s was built at %s, so the tests may run old code",
+			r.NewestSource, r.NewestSourceAt.Format(time.Kitchen), r.Path, r.BuiltAt.Format(time.Kitchen)),
+			"Rebuild your project before running the tests")
+	}
+}
+
+func (r *Report) Errors() []Finding {
+	var errs []Finding
+	for _, finding := range r.Findings {
+		if finding.Severity == SeverityError {
+			errs = append(errs, finding)
+		}
+	}
+	return errs
+}
+
+// LogWarnings logs findings that don't stop the entrypoint from running,
+// such as a binary older than its sources.
+func (r *Report) LogWarnings(l *logger.Logger) {
+	for _, finding := range r.Findings {
+		if finding.Severity == SeverityWarning {
+			l.LogWarning(finding.Message)
+		}
+	}
+}
+
+func (r *Report) Summary() string {
+	parts := []string{r.Path}
+	if r.Kind != "" {
+		kind := r.Kind
+		if r.Machine != "" {
+			kind += " " + r.Machine
+		}
+		parts = append(parts, kind)
+	}
+	if r.Mode != 0 {
+		parts = append(parts, "mode "+r.Mode.Perm().String())
+	}
+	if r.GoVersion != "" {
+		parts = append(parts, fmt.Sprintf("built with %s from %s", r.GoVersion, r.ModulePath))
+	}
+	if !r.BuiltAt.IsZero() {
+		parts = append(parts, "modified "+r.BuiltAt.Format(time.DateTime))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Log explains the findings plainly, each with a suggested fix.
+func (r *Report) Log(l *logger.Logger) {
+	l.LogInfo("Entrypoint: " + r.Summary())
+	for _, finding := range r.Findings {
+		if finding.Severity == SeverityError {
+			l.LogError(finding.Message)
+		} else {
+			l.LogWarning(finding.Message)
+		}
+		if finding.Suggestion != "" {
+			l.LogInfo("Suggested fix: " + finding.Suggestion)
+		}
+	}
+}
+
+// IsExecError reports whether err came from failing to execute executable,
+// as opposed to the program running and failing, or an unrelated file such as
+// a fixture being missing.
+func IsExecError(err error, executable string) bool {
+	if err == nil {
+		return false
+	}
+	var execErr *exec.Error
+	if errors.As(err, &execErr) {
+		return execErr.Name == executable
+	}
+	// exec.Cmd.Start reports ENOENT, EACCES and ENOEXEC as a "fork/exec" PathError
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Op == "fork/exec" && pathErr.Path == executable
+	}
+	// Steps that wrap errors with %v keep only the message
+	return strings.Contains(err.Error(), "fork/exec "+executable+":")
+}
+
+func readHeader(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	header := make([]byte, 512)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return header[:n], nil
+}
+
+func isMachO(header []byte) bool {
+	for _, magic := range [][]byte{{0xfe, 0xed, 0xfa, 0xce}, {0xfe, 0xed, 0xfa, 0xcf}, {0xce, 0xfa, 0xed, 0xfe}, {0xcf, 0xfa, 0xed, 0xfe}} {
+		if bytes.HasPrefix(header, magic) {
+			return true
+		}
+	}
+	return false
+}
+
+func isText(header []byte) bool {
+	return len(header) > 0 && !bytes.ContainsRune(header, 0)
+}
+
+func machineName(machine elf.Machine) string {
+	if name, ok := machineNames[machine]; ok {
+		return name
+	}
+	return strings.TrimPrefix(machine.String(), "EM_")
+}
+
+func crossCompileSuggestion() string {
+	return fmt.Sprintf("Build for this machine, for example `GOOS=%s GOARCH=%s go build` for Go", runtime.GOOS, runtime.GOARCH)
+}
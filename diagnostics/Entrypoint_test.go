@@ -0,0 +1,175 @@
+package diagnostics
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/buildium-org/buildium_harness/logger"
+)
+
+func writeFile(t *testing.T, dir, name, content string, mode os.FileMode) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+// elfHeader builds a minimal 64-bit little-endian ELF executable header.
+func elfHeader(machine elf.Machine) []byte {
+	header := make([]byte, 64)
+	copy(header, "\x7fELF")
+	header[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	binary.LittleEndian.PutUint16(header[16:], uint16(elf.ET_EXEC))
+	binary.LittleEndian.PutUint16(header[18:], uint16(machine))
+	binary.LittleEndian.PutUint32(header[20:], uint32(elf.EV_CURRENT))
+	binary.LittleEndian.PutUint16(header[52:], 64)
+	return header
+}
+
+func findingWith(r *Report, text string) *Finding {
+	for i := range r.Findings {
+		if strings.Contains(r.Findings[i].Message, text) {
+			return &r.Findings[i]
+		}
+	}
+	return nil
+}
+
+func TestInspectFileProblems(t *testing.T) {
+	dir := t.TempDir()
+	otherMachine := elf.EM_AARCH64
+	if runtime.GOARCH == "arm64" {
+		otherMachine = elf.EM_X86_64
+	}
+	cases := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"missing", filepath.Join(dir, "missing"), "does not exist"},
+		{"directory", dir, "is a directory"},
+		{"not executable", writeFile(t, dir, "noexec", "#!/bin/sh\n", 0644), "is not executable"},
+		{"no shebang", writeFile(t, dir, "script", "echo hello\n", 0755), "has no shebang line"},
+		{"crlf shebang", writeFile(t, dir, "crlf", "#!/bin/sh\r\necho hello\r\n", 0755), "Windows line endings"},
+		{"missing interpreter", writeFile(t, dir, "ruby", "#!/no/such/ruby\n", 0755), "does not exist"},
+		{"missing env interpreter", writeFile(t, dir, "env", "#!/usr/bin/env no-such-interpreter\n", 0755), "is not installed"},
+		{"macos", writeFile(t, dir, "macho", "\xcf\xfa\xed\xfe\x07\x00\x00\x01", 0755), "built for macOS"},
+		{"foreign arch", writeFile(t, dir, "foreign", string(elfHeader(otherMachine)), 0755), "but this machine is"},
+	}
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			report := Inspect(test.path, "")
+			finding := findingWith(report, test.want)
+			if finding == nil {
+				t.Fatalf("findings = %+v, want %q", report.Findings, test.want)
+			}
+			if finding.Severity != SeverityError || finding.Suggestion == "" {
+				t.Errorf("finding = %+v, want an error with a suggestion", finding)
+			}
+		})
+	}
+}
+
+func TestInspectRunnableFiles(t *testing.T) {
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatalf("os.Executable() error = %v", err)
+	}
+	report := Inspect(self, "")
+	if len(report.Errors()) != 0 {
+		t.Errorf("Errors() = %+v for the test binary", report.Errors())
+	}
+	if report.Kind != "elf" || report.GoVersion != runtime.Version() {
+		t.Errorf("report = %+v, want an ELF built with %s", report, runtime.Version())
+	}
+
+	script := writeFile(t, t.TempDir(), "server", "#!/usr/bin/env sh\necho hello\n", 0755)
+	report = Inspect(script, "")
+	if len(report.Findings) != 0 || report.Kind != "script" || report.Interpreter != "/usr/bin/env sh" {
+		t.Errorf("report = %+v, want a runnable script", report)
+	}
+}
+
+func TestInspectStaleBinary(t *testing.T) {
+	dir := t.TempDir()
+	binaryPath := writeFile(t, dir, "server", "#!/bin/sh\n", 0755)
+	source := writeFile(t, dir, "main.go", "package main\n", 0644)
+	writeFile(t, dir, ".hidden", "", 0644)
+	built := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(binaryPath, built, built); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+
+	report := Inspect(binaryPath, dir)
+	if report.NewestSource != source {
+		t.Errorf("NewestSource = %q, want %q", report.NewestSource, source)
+	}
+	finding := findingWith(report, "may run old code")
+	if finding == nil || finding.Severity != SeverityWarning {
+		t.Fatalf("findings = %+v, want a stale binary warning", report.Findings)
+	}
+
+	if err := os.Chtimes(binaryPath, time.Now().Add(time.Hour), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+	if report := Inspect(binaryPath, dir); len(report.Findings) != 0 {
+		t.Errorf("findings = %+v for a fresh binary", report.Findings)
+	}
+}
+
+func TestIsExecError(t *testing.T) {
+	dir := t.TempDir()
+	noShebang := writeFile(t, dir, "script", "echo hello\n", 0755)
+	noExec := writeFile(t, dir, "noexec", "#!/bin/sh\n", 0644)
+
+	for _, path := range []string{filepath.Join(dir, "missing"), noShebang, noExec} {
+		err := exec.Command(path).Run()
+		if !IsExecError(err, path) {
+			t.Errorf("IsExecError(%v) = false", err)
+		}
+		if wrapped := fmt.Errorf("failed to run: %v", err); !IsExecError(wrapped, path) {
+			t.Errorf("IsExecError(%v) = false for a wrapped message", wrapped)
+		}
+		if IsExecError(err, filepath.Join(dir, "app")) {
+			t.Errorf("IsExecError(%v) = true for a different program", err)
+		}
+	}
+	if err := exec.Command("no-such-program-buildium").Run(); !IsExecError(err, "no-such-program-buildium") {
+		t.Errorf("IsExecError(%v) = false for a program missing from PATH", err)
+	}
+	if err := exec.Command("/bin/sh", "-c", "exit 3").Run(); IsExecError(err, "/bin/sh") {
+		t.Errorf("IsExecError(%v) = true for a program that ran", err)
+	}
+	_, fixtureErr := os.ReadFile(filepath.Join(dir, "fixture.json"))
+	if IsExecError(fixtureErr, noShebang) {
+		t.Errorf("IsExecError(%v) = true for a missing fixture", fixtureErr)
+	}
+	if IsExecError(nil, noShebang) {
+		t.Error("IsExecError(nil) = true")
+	}
+}
+
+func TestReportLog(t *testing.T) {
+	report := Inspect(writeFile(t, t.TempDir(), "noexec", "#!/bin/sh\n", 0644), "")
+	before := len(logger.GetAllLogs())
+	report.Log(logger.NewLogger())
+	logs := logger.GetAllLogs()[before:]
+	if len(logs) != 3 {
+		t.Fatalf("logged %v, want summary, error and suggestion", logs)
+	}
+	if !strings.HasPrefix(logs[0].Message, "Entrypoint: ") || logs[1].Type != "FAILURE" || !strings.HasPrefix(logs[2].Message, "Suggested fix: Run `chmod +x") {
+		t.Errorf("logged %v", logs)
+	}
+}
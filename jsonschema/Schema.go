@@ -0,0 +1,630 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/netip"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/buildium-org/buildium_harness/logger"
+)
+
+// Schema validates instances against a JSON Schema draft 2020-12 subset:
+// type, enum, const, numeric and string bounds, pattern, format, array and
+// object keywords, the applicators (allOf, anyOf, oneOf, not, if/then/else)
+// and local $ref. Remote references and $dynamicRef are not supported.
+type Schema struct {
+	root     any
+	document any
+	mu       sync.Mutex
+	patterns map[string]*regexp.Regexp
+}
+
+type ValidationError struct {
+	InstancePath string
+	Keyword      string
+	Expected     any
+	Actual       any
+	Message      string
+}
+
+func (e ValidationError) Error() string {
+	path := e.InstancePath
+	if path == "" {
+		path = "/"
+	}
+	return fmt.Sprintf("%s: %s: %s", path, e.Keyword, e.Message)
+}
+
+func Compile(data []byte) (*Schema, error) {
+	var root any
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %v", err)
+	}
+	return New(root, root)
+}
+
+func MustCompile(data []byte) *Schema {
+	schema, err := Compile(data)
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+// New builds a schema from a decoded value. Local references are resolved
+// against document, which lets schemas embedded in a larger file (such as an
+// OpenAPI document) refer to "#/components/schemas/...".
+func New(root any, document any) (*Schema, error) {
+	switch root.(type) {
+	case bool, map[string]any:
+	default:
+		return nil, fmt.Errorf("schema must be an object or a boolean, got %T", root)
+	}
+	s := &Schema{root: root, document: document, patterns: map[string]*regexp.Regexp{}}
+	if err := s.compilePatterns(root); err != nil {
+		return nil, err
+	}
+	if err := s.compileDocument(document); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Keywords whose values are subschemas, by shape. Only these are searched for
+// patterns: keywords such as enum and default hold data, and properties can
+// have any name.
+var (
+	schemaKeywords     = []string{"items", "additionalItems", "additionalProperties", "contains", "not", "if", "then", "else", "propertyNames", "unevaluatedItems", "unevaluatedProperties"}
+	schemaListKeywords = []string{"allOf", "anyOf", "oneOf", "prefixItems", "items"}
+	schemaMapKeywords  = []string{"properties", "patternProperties", "$defs", "definitions", "dependentSchemas"}
+)
+
+func (s *Schema) compilePatterns(node any) error {
+	object, ok := node.(map[string]any)
+	if !ok {
+		return nil
+	}
+	if pattern, ok := object["pattern"].(string); ok {
+		if err := s.addPattern(pattern); err != nil {
+			return err
+		}
+	}
+	if patternProperties, ok := object["patternProperties"].(map[string]any); ok {
+		for pattern := range patternProperties {
+			if err := s.addPattern(pattern); err != nil {
+				return err
+			}
+		}
+	}
+	var children []any
+	for _, keyword := range schemaKeywords {
+		children = append(children, object[keyword])
+	}
+	for _, keyword := range schemaListKeywords {
+		list, _ := object[keyword].([]any)
+		children = append(children, list...)
+	}
+	for _, keyword := range schemaMapKeywords {
+		schemas, _ := object[keyword].(map[string]any)
+		for _, child := range schemas {
+			children = append(children, child)
+		}
+	}
+	for _, child := range children {
+		if err := s.compilePatterns(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileDocument compiles the patterns of schemas that references can reach
+// in document: its $defs and definitions, or an OpenAPI document's
+// components.schemas. Anything else is compiled when first used.
+func (s *Schema) compileDocument(document any) error {
+	if err := s.compilePatterns(document); err != nil {
+		return err
+	}
+	object, _ := document.(map[string]any)
+	components, _ := object["components"].(map[string]any)
+	return s.compilePatterns(map[string]any{"$defs": components["schemas"]})
+}
+
+func (s *Schema) addPattern(pattern string) error {
+	_, err := s.pattern(pattern)
+	return err
+}
+
+// pattern returns the compiled pattern, compiling it on first use.
+func (s *Schema) pattern(pattern string) (*regexp.Regexp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if re, ok := s.patterns[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	s.patterns[pattern] = re
+	return re, nil
+}
+
+func (s *Schema) Validate(instance any) []ValidationError {
+	return s.validate(s.root, instance, "", 0)
+}
+
+// ValidateJSON decodes data and validates it, e.g. an HTTP body or CLI output.
+func (s *Schema) ValidateJSON(data []byte) ([]ValidationError, error) {
+	var instance any
+	if err := json.Unmarshal(data, &instance); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	return s.Validate(instance), nil
+}
+
+func AsError(errs []ValidationError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	joined := make([]error, len(errs))
+	for i, err := range errs {
+		joined[i] = err
+	}
+	return errors.Join(joined...)
+}
+
+func LogErrors(l *logger.Logger, errs []ValidationError) {
+	for _, err := range errs {
+		path := err.InstancePath
+		if path == "" {
+			path = "/"
+		}
+		l.LogError(fmt.Sprintf("%s violates %q: expected %s, got %s", path, err.Keyword, describe(err.Expected), describe(err.Actual)))
+	}
+}
+
+func describe(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case nil:
+		return "null"
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+func (s *Schema) validate(schema any, instance any, path string, depth int) []ValidationError {
+	if depth > 64 {
+		return []ValidationError{{InstancePath: path, Keyword: "$ref", Message: "schema recursion is too deep"}}
+	}
+	switch node := schema.(type) {
+	case bool:
+		if !node {
+			return []ValidationError{{InstancePath: path, Keyword: "false", Expected: "nothing", Actual: instance, Message: "no value is allowed here"}}
+		}
+		return nil
+	case map[string]any:
+		return s.validateObject(node, instance, path, depth)
+	}
+	return nil
+}
+
+func (s *Schema) validateObject(node map[string]any, instance any, path string, depth int) []ValidationError {
+	var errs []ValidationError
+	fail := func(keyword string, expected, actual any, format string, args ...any) {
+		errs = append(errs, ValidationError{InstancePath: path, Keyword: keyword, Expected: expected, Actual: actual, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if ref, ok := node["$ref"].(string); ok {
+		target, err := s.resolve(ref)
+		if err != nil {
+			fail("$ref", ref, nil, "%v", err)
+		} else {
+			errs = append(errs, s.validate(target, instance, path, depth+1)...)
+		}
+	}
+
+	// OpenAPI 3.0 schemas mark nullable values with an extension keyword
+	if instance == nil && node["nullable"] == true {
+		return errs
+	}
+
+	if typeValue, ok := node["type"]; ok {
+		types := schemaTypes(typeValue)
+		actual := TypeOf(instance)
+		matched := false
+		for _, t := range types {
+			if t == actual || (t == "number" && actual == "integer") {
+				matched = true
+			}
+		}
+		if !matched {
+			fail("type", strings.Join(types, " or "), actual, "expected %s, got %s", strings.Join(types, " or "), actual)
+			return errs
+		}
+	}
+	if enum, ok := node["enum"].([]any); ok {
+		found := false
+		for _, value := range enum {
+			if equal(value, instance) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("enum", enum, instance, "value %s is not one of %s", describe(instance), describe(enum))
+		}
+	}
+	if constant, ok := node["const"]; ok && !equal(constant, instance) {
+		fail("const", constant, instance, "expected %s, got %s", describe(constant), describe(instance))
+	}
+
+	switch value := instance.(type) {
+	case float64:
+		errs = append(errs, s.validateNumber(node, value, path)...)
+	case string:
+		errs = append(errs, s.validateString(node, value, path)...)
+	case []any:
+		errs = append(errs, s.validateArray(node, value, path, depth)...)
+	case map[string]any:
+		errs = append(errs, s.validateProperties(node, value, path, depth)...)
+	}
+
+	if allOf, ok := node["allOf"].([]any); ok {
+		for _, sub := range allOf {
+			errs = append(errs, s.validate(sub, instance, path, depth+1)...)
+		}
+	}
+	if anyOf, ok := node["anyOf"].([]any); ok {
+		if s.countValid(anyOf, instance, path, depth) == 0 {
+			fail("anyOf", "at least one matching schema", "none", "value does not match any of the %d schemas", len(anyOf))
+		}
+	}
+	if oneOf, ok := node["oneOf"].([]any); ok {
+		if matches := s.countValid(oneOf, instance, path, depth); matches != 1 {
+			fail("oneOf", "exactly one matching schema", fmt.Sprintf("%d matching", matches), "value matches %d of the %d schemas", matches, len(oneOf))
+		}
+	}
+	if not, ok := node["not"]; ok {
+		if len(s.validate(not, instance, path, depth+1)) == 0 {
+			fail("not", "value not matching the schema", instance, "value must not match the schema")
+		}
+	}
+	if condition, ok := node["if"]; ok {
+		if len(s.validate(condition, instance, path, depth+1)) == 0 {
+			if then, ok := node["then"]; ok {
+				errs = append(errs, s.validate(then, instance, path, depth+1)...)
+			}
+		} else if otherwise, ok := node["else"]; ok {
+			errs = append(errs, s.validate(otherwise, instance, path, depth+1)...)
+		}
+	}
+	return errs
+}
+
+func (s *Schema) validateNumber(node map[string]any, value float64, path string) []ValidationError {
+	var errs []ValidationError
+	fail := func(keyword string, expected any, format string, args ...any) {
+		errs = append(errs, ValidationError{InstancePath: path, Keyword: keyword, Expected: expected, Actual: value, Message: fmt.Sprintf(format, args...)})
+	}
+	if limit, ok := node["minimum"].(float64); ok && value < limit {
+		fail("minimum", fmt.Sprintf(">= %v", limit), "value %v is less than minimum %v", value, limit)
+	}
+	if limit, ok := node["maximum"].(float64); ok && value > limit {
+		fail("maximum", fmt.Sprintf("<= %v", limit), "value %v is greater than maximum %v", value, limit)
+	}
+	if limit, ok := node["exclusiveMinimum"].(float64); ok && value <= limit {
+		fail("exclusiveMinimum", fmt.Sprintf("> %v", limit), "value %v is not greater than exclusive minimum %v", value, limit)
+	}
+	if limit, ok := node["exclusiveMaximum"].(float64); ok && value >= limit {
+		fail("exclusiveMaximum", fmt.Sprintf("< %v", limit), "value %v is not less than exclusive maximum %v", value, limit)
+	}
+	if divisor, ok := node["multipleOf"].(float64); ok && divisor > 0 {
+		quotient := value / divisor
+		if math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			fail("multipleOf", fmt.Sprintf("multiple of %v", divisor), "value %v is not a multiple of %v", value, divisor)
+		}
+	}
+	return errs
+}
+
+func (s *Schema) validateString(node map[string]any, value string, path string) []ValidationError {
+	var errs []ValidationError
+	fail := func(keyword string, expected any, format string, args ...any) {
+		errs = append(errs, ValidationError{InstancePath: path, Keyword: keyword, Expected: expected, Actual: value, Message: fmt.Sprintf(format, args...)})
+	}
+	length := utf8.RuneCountInString(value)
+	if limit, ok := node["minLength"].(float64); ok && float64(length) < limit {
+		fail("minLength", fmt.Sprintf("at least %v characters", limit), "length %d is less than %v", length, limit)
+	}
+	if limit, ok := node["maxLength"].(float64); ok && float64(length) > limit {
+		fail("maxLength", fmt.Sprintf("at most %v characters", limit), "length %d is greater than %v", length, limit)
+	}
+	if pattern, ok := node["pattern"].(string); ok {
+		if re, err := s.pattern(pattern); err != nil {
+			fail("pattern", pattern, "%v", err)
+		} else if !re.MatchString(value) {
+			fail("pattern", pattern, "%q does not match %q", value, pattern)
+		}
+	}
+	if format, ok := node["format"].(string); ok && !validFormat(format, value) {
+		fail("format", format, "%q is not a valid %s", value, format)
+	}
+	return errs
+}
+
+func (s *Schema) validateArray(node map[string]any, value []any, path string, depth int) []ValidationError {
+	var errs []ValidationError
+	fail := func(keyword string, expected, actual any, format string, args ...any) {
+		errs = append(errs, ValidationError{InstancePath: path, Keyword: keyword, Expected: expected, Actual: actual, Message: fmt.Sprintf(format, args...)})
+	}
+	if limit, ok := node["minItems"].(float64); ok && float64(len(value)) < limit {
+		fail("minItems", fmt.Sprintf("at least %v items", limit), fmt.Sprintf("%d items", len(value)), "array has %d items, fewer than %v", len(value), limit)
+	}
+	if limit, ok := node["maxItems"].(float64); ok && float64(len(value)) > limit {
+		fail("maxItems", fmt.Sprintf("at most %v items", limit), fmt.Sprintf("%d items", len(value)), "array has %d items, more than %v", len(value), limit)
+	}
+	if node["uniqueItems"] == true {
+		for i := 0; i < len(value); i++ {
+			for j := i + 1; j < len(value); j++ {
+				if equal(value[i], value[j]) {
+					fail("uniqueItems", "unique items", value[j], "items %d and %d are equal", i, j)
+				}
+			}
+		}
+	}
+	prefixItems, _ := node["prefixItems"].([]any)
+	for i, item := range value {
+		itemPath := path + "/" + strconv.Itoa(i)
+		if i < len(prefixItems) {
+			errs = append(errs, s.validate(prefixItems[i], item, itemPath, depth+1)...)
+		} else if items, ok := node["items"]; ok {
+			errs = append(errs, s.validate(items, item, itemPath, depth+1)...)
+		}
+	}
+	if contains, ok := node["contains"]; ok {
+		matches := 0
+		for i, item := range value {
+			if len(s.validate(contains, item, path+"/"+strconv.Itoa(i), depth+1)) == 0 {
+				matches++
+			}
+		}
+		minContains := 1.0
+		if limit, ok := node["minContains"].(float64); ok {
+			minContains = limit
+		}
+		if float64(matches) < minContains {
+			fail("contains", fmt.Sprintf("at least %v matching items", minContains), fmt.Sprintf("%d matching", matches), "array contains %d matching items, fewer than %v", matches, minContains)
+		}
+		if limit, ok := node["maxContains"].(float64); ok && float64(matches) > limit {
+			fail("maxContains", fmt.Sprintf("at most %v matching items", limit), fmt.Sprintf("%d matching", matches), "array contains %d matching items, more than %v", matches, limit)
+		}
+	}
+	return errs
+}
+
+func (s *Schema) validateProperties(node map[string]any, value map[string]any, path string, depth int) []ValidationError {
+	var errs []ValidationError
+	fail := func(keyword string, expected, actual any, format string, args ...any) {
+		errs = append(errs, ValidationError{InstancePath: path, Keyword: keyword, Expected: expected, Actual: actual, Message: fmt.Sprintf(format, args...)})
+	}
+	if limit, ok := node["minProperties"].(float64); ok && float64(len(value)) < limit {
+		fail("minProperties", fmt.Sprintf("at least %v properties", limit), fmt.Sprintf("%d properties", len(value)), "object has %d properties, fewer than %v", len(value), limit)
+	}
+	if limit, ok := node["maxProperties"].(float64); ok && float64(len(value)) > limit {
+		fail("maxProperties", fmt.Sprintf("at most %v properties", limit), fmt.Sprintf("%d properties", len(value)), "object has %d properties, more than %v", len(value), limit)
+	}
+	if required, ok := node["required"].([]any); ok {
+		for _, name := range required {
+			// A malformed schema's non-string entries name no property
+			key, ok := name.(string)
+			if !ok {
+				continue
+			}
+			if _, present := value[key]; !present {
+				fail("required", key, "missing", "missing required property %q", key)
+			}
+		}
+	}
+	if dependentRequired, ok := node["dependentRequired"].(map[string]any); ok {
+		for name, dependencies := range dependentRequired {
+			if _, present := value[name]; !present {
+				continue
+			}
+			for _, dependency := range asSlice(dependencies) {
+				key, ok := dependency.(string)
+				if !ok {
+					continue
+				}
+				if _, present := value[key]; !present {
+					fail("dependentRequired", key, "missing", "property %q is required when %q is present", key, name)
+				}
+			}
+		}
+	}
+
+	properties, _ := node["properties"].(map[string]any)
+	patternProperties, _ := node["patternProperties"].(map[string]any)
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		propertyValue := value[name]
+		propertyPath := path + "/" + EscapePointer(name)
+		if propertyNames, ok := node["propertyNames"]; ok {
+			for _, err := range s.validate(propertyNames, name, propertyPath, depth+1) {
+				err.Keyword = "propertyNames/" + err.Keyword
+				errs = append(errs, err)
+			}
+		}
+		matched := false
+		if propertySchema, ok := properties[name]; ok {
+			matched = true
+			errs = append(errs, s.validate(propertySchema, propertyValue, propertyPath, depth+1)...)
+		}
+		for pattern, patternSchema := range patternProperties {
+			re, err := s.pattern(pattern)
+			if err != nil {
+				errs = append(errs, ValidationError{InstancePath: propertyPath, Keyword: "patternProperties", Expected: pattern, Actual: name, Message: err.Error()})
+				continue
+			}
+			if re.MatchString(name) {
+				matched = true
+				errs = append(errs, s.validate(patternSchema, propertyValue, propertyPath, depth+1)...)
+			}
+		}
+		if matched {
+			continue
+		}
+		if additional, ok := node["additionalProperties"]; ok {
+			if additional == false {
+				errs = append(errs, ValidationError{InstancePath: propertyPath, Keyword: "additionalProperties", Expected: "no additional properties", Actual: name, Message: fmt.Sprintf("unexpected property %q", name)})
+			} else {
+				errs = append(errs, s.validate(additional, propertyValue, propertyPath, depth+1)...)
+			}
+		}
+	}
+	return errs
+}
+
+func (s *Schema) countValid(schemas []any, instance any, path string, depth int) int {
+	count := 0
+	for _, sub := range schemas {
+		if len(s.validate(sub, instance, path, depth+1)) == 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// resolve follows local references such as "#", "#/$defs/user" or
+// "#/components/schemas/User".
+func (s *Schema) resolve(ref string) (any, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("unsupported reference %q, only local references are supported", ref)
+	}
+	current := s.document
+	pointer := strings.TrimPrefix(ref, "#")
+	if pointer == "" {
+		return current, nil
+	}
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = UnescapePointer(token)
+		switch node := current.(type) {
+		case map[string]any:
+			next, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("unresolvable reference %q", ref)
+			}
+			current = next
+		case []any:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, fmt.Errorf("unresolvable reference %q", ref)
+			}
+			current = node[index]
+		default:
+			return nil, fmt.Errorf("unresolvable reference %q", ref)
+		}
+	}
+	return current, nil
+}
+
+func validFormat(format, value string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", value)
+		return err == nil
+	case "email":
+		address, err := mail.ParseAddress(value)
+		return err == nil && address.Address == value
+	case "uuid":
+		return uuidPattern.MatchString(value)
+	case "ipv4":
+		addr, err := netip.ParseAddr(value)
+		return err == nil && addr.Is4()
+	case "ipv6":
+		addr, err := netip.ParseAddr(value)
+		return err == nil && addr.Is6()
+	}
+	// Unknown formats are annotations only
+	return true
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// TypeOf returns the JSON Schema type name of a decoded JSON value.
+func TypeOf(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func schemaTypes(value any) []string {
+	switch t := value.(type) {
+	case string:
+		return []string{t}
+	case []any:
+		types := make([]string, 0, len(t))
+		for _, item := range t {
+			if name, ok := item.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func equal(a, b any) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func asSlice(value any) []any {
+	slice, _ := value.([]any)
+	return slice
+}
+
+func EscapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+func UnescapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+}
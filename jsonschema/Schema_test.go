@@ -0,0 +1,246 @@
+package jsonschema
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/buildium-org/buildium_harness/logger"
+)
+
+const userSchema = `{
+	"$defs": {
+		"role": {"enum": ["admin", "member"]}
+	},
+	"type": "object",
+	"required": ["id", "name", "tags"],
+	"additionalProperties": false,
+	"properties": {
+		"id": {"type": "integer", "minimum": 1},
+		"name": {"type": "string", "minLength": 1, "maxLength": 10},
+		"email": {"type": ["string", "null"], "format": "email"},
+		"role": {"$ref": "#/$defs/role"},
+		"score": {"type": "number", "exclusiveMaximum": 100, "multipleOf": 0.5},
+		"tags": {"type": "array", "items": {"type": "string"}, "uniqueItems": true, "maxItems": 3},
+		"point": {"type": "array", "prefixItems": [{"type": "number"}, {"type": "number"}], "items": false}
+	}
+}`
+
+func errorsAt(errs []ValidationError) map[string]string {
+	found := map[string]string{}
+	for _, err := range errs {
+		found[err.InstancePath] = err.Keyword
+	}
+	return found
+}
+
+func TestValidateAcceptsValidInstance(t *testing.T) {
+	schema := MustCompile([]byte(userSchema))
+	errs, err := schema.ValidateJSON([]byte(`{"id": 1, "name": "Ada", "email": "ada@example.com", "role": "admin", "score": 42.5, "tags": ["a", "b"], "point": [1, 2]}`))
+	if err != nil {
+		t.Fatalf("ValidateJSON() error = %v", err)
+	}
+	if len(errs) != 0 {
+		t.Errorf("Validate() = %v, want no errors", errs)
+	}
+}
+
+func TestValidateReportsKeywords(t *testing.T) {
+	schema := MustCompile([]byte(userSchema))
+	errs, err := schema.ValidateJSON([]byte(`{"id": 0, "name": "", "email": "nope", "role": "owner", "score": 100.25, "tags": ["a", "a", "b", "c"], "point": [1, 2, 3], "extra": true}`))
+	if err != nil {
+		t.Fatalf("ValidateJSON() error = %v", err)
+	}
+	found := errorsAt(errs)
+	want := map[string]string{
+		"/id":      "minimum",
+		"/name":    "minLength",
+		"/email":   "format",
+		"/role":    "enum",
+		"/point/2": "false",
+		"/extra":   "additionalProperties",
+	}
+	for path, keyword := range want {
+		if found[path] != keyword {
+			t.Errorf("error at %s = %q, want %q", path, found[path], keyword)
+		}
+	}
+	keywords := map[string]bool{}
+	for _, err := range errs {
+		keywords[err.Keyword] = true
+	}
+	for _, keyword := range []string{"exclusiveMaximum", "multipleOf", "uniqueItems", "maxItems"} {
+		if !keywords[keyword] {
+			t.Errorf("missing %q error in %v", keyword, errs)
+		}
+	}
+}
+
+func TestValidateTypeError(t *testing.T) {
+	schema := MustCompile([]byte(userSchema))
+	errs := schema.Validate([]any{})
+	if len(errs) != 1 {
+		t.Fatalf("Validate() = %v, want a single type error", errs)
+	}
+	if errs[0].InstancePath != "" || errs[0].Keyword != "type" || errs[0].Expected != "object" || errs[0].Actual != "array" {
+		t.Errorf("error = %+v, want type object vs array at the root", errs[0])
+	}
+	if got := errs[0].Error(); got != "/: type: expected object, got array" {
+		t.Errorf("Error() = %q", got)
+	}
+}
+
+func TestValidateRequired(t *testing.T) {
+	schema := MustCompile([]byte(userSchema))
+	errs, _ := schema.ValidateJSON([]byte(`{"id": 3}`))
+	missing := []string{}
+	for _, err := range errs {
+		if err.Keyword == "required" {
+			missing = append(missing, err.Expected.(string))
+		}
+	}
+	if strings.Join(missing, ",") != "name,tags" {
+		t.Errorf("missing = %v, want name and tags", missing)
+	}
+}
+
+func TestValidateApplicators(t *testing.T) {
+	schema := MustCompile([]byte(`{
+		"oneOf": [{"type": "integer"}, {"type": "number", "minimum": 10}],
+		"not": {"const": 42},
+		"if": {"minimum": 100},
+		"then": {"maximum": 200}
+	}`))
+	cases := []struct {
+		value   any
+		keyword string
+	}{
+		{value: 5.0},
+		{value: 10.5},
+		{value: 20.0, keyword: "oneOf"},
+		{value: 42.0, keyword: "oneOf"},
+		{value: 300.5, keyword: "maximum"},
+		{value: "x", keyword: "oneOf"},
+	}
+	for _, test := range cases {
+		errs := schema.Validate(test.value)
+		if test.keyword == "" {
+			if len(errs) != 0 {
+				t.Errorf("Validate(%v) = %v, want no errors", test.value, errs)
+			}
+			continue
+		}
+		if len(errs) == 0 || errs[0].Keyword != test.keyword {
+			t.Errorf("Validate(%v) = %v, want %s error", test.value, errs, test.keyword)
+		}
+	}
+
+	errs := MustCompile([]byte(`{"not": {"const": 42}}`)).Validate(42.0)
+	if len(errs) != 1 || errs[0].Keyword != "not" {
+		t.Errorf("Validate(42) = %v, want a not error", errs)
+	}
+}
+
+func TestValidateRecursiveRef(t *testing.T) {
+	schema := MustCompile([]byte(`{
+		"$defs": {"node": {"type": "object", "required": ["value"], "properties": {"value": {"type": "integer"}, "children": {"type": "array", "items": {"$ref": "#/$defs/node"}}}}},
+		"$ref": "#/$defs/node"
+	}`))
+	errs, _ := schema.ValidateJSON([]byte(`{"value": 1, "children": [{"value": 2}, {"value": "3"}, {"children": []}]}`))
+	found := errorsAt(errs)
+	if found["/children/1/value"] != "type" || found["/children/2"] != "required" {
+		t.Errorf("errors = %v, want type error at /children/1/value and required at /children/2", errs)
+	}
+}
+
+func TestNewResolvesAgainstDocument(t *testing.T) {
+	document := map[string]any{
+		"components": map[string]any{
+			"schemas": map[string]any{
+				"Id": map[string]any{"type": "string", "pattern": "^u_"},
+			},
+		},
+	}
+	schema, err := New(map[string]any{"$ref": "#/components/schemas/Id"}, document)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if errs := schema.Validate("u_1"); len(errs) != 0 {
+		t.Errorf("Validate(u_1) = %v, want no errors", errs)
+	}
+	if errs := schema.Validate("x"); len(errs) != 1 || errs[0].Keyword != "pattern" {
+		t.Errorf("Validate(x) = %v, want a pattern error", errs)
+	}
+}
+
+func TestPatternsUnderKeywordNamedProperties(t *testing.T) {
+	schema, err := Compile([]byte(`{"type":"object","properties":{"default":{"type":"string","pattern":"^a"},"enum":{"patternProperties":{"^x":{"pattern":"^b"}}}}}`))
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	if errs := schema.Validate(map[string]any{"default": "abc", "enum": map[string]any{"x1": "bcd"}}); len(errs) != 0 {
+		t.Errorf("Validate() = %v, want no errors", errs)
+	}
+	errs := schema.Validate(map[string]any{"default": "xyz", "enum": map[string]any{"x1": "xyz"}})
+	if len(errs) != 2 || errs[0].Keyword != "pattern" || errs[1].Keyword != "pattern" {
+		t.Errorf("Validate() = %v, want two pattern errors", errs)
+	}
+}
+
+func TestPatternOutsideSchemaKeywords(t *testing.T) {
+	// Data keywords are not compiled, so an invalid pattern there is only
+	// reported if a $ref makes it a schema
+	document := map[string]any{
+		"default": map[string]any{"pattern": "("},
+		"x-extra": map[string]any{"pattern": "^c"},
+	}
+	schema, err := New(map[string]any{"$ref": "#/default"}, document)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if errs := schema.Validate("c"); len(errs) != 1 || !strings.Contains(errs[0].Message, "invalid pattern") {
+		t.Errorf("Validate() = %v, want an invalid pattern error", errs)
+	}
+	schema, _ = New(map[string]any{"$ref": "#/x-extra"}, document)
+	if errs := schema.Validate("d"); len(errs) != 1 || errs[0].Keyword != "pattern" {
+		t.Errorf("Validate() = %v, want the pattern compiled on first use", errs)
+	}
+}
+
+func TestMalformedRequiredEntriesAreSkipped(t *testing.T) {
+	schema, err := Compile([]byte(`{"required": ["id", 5, null], "dependentRequired": {"id": ["name", true]}}`))
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	errs := schema.Validate(map[string]any{"id": 1.0})
+	if len(errs) != 1 || errs[0].Message != `property "name" is required when "id" is present` {
+		t.Errorf("Validate() = %v, want only the missing string dependency", errs)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, data := range []string{`not json`, `"string"`, `{"pattern": "("}`} {
+		if _, err := Compile([]byte(data)); err == nil {
+			t.Errorf("Compile(%s) should fail", data)
+		}
+	}
+	errs := MustCompile([]byte(`{"$ref": "#/$defs/missing"}`)).Validate(1.0)
+	if len(errs) != 1 || errs[0].Keyword != "$ref" {
+		t.Errorf("Validate() = %v, want an unresolvable $ref error", errs)
+	}
+}
+
+func TestAsErrorAndLogErrors(t *testing.T) {
+	if AsError(nil) != nil {
+		t.Error("AsError(nil) should be nil")
+	}
+	errs := MustCompile([]byte(`{"type": "object", "required": ["id"]}`)).Validate(map[string]any{})
+	if err := AsError(errs); err == nil || !strings.Contains(err.Error(), `missing required property "id"`) {
+		t.Errorf("AsError() = %v", err)
+	}
+	before := len(logger.GetAllLogs())
+	LogErrors(logger.NewLogger(), errs)
+	logs := logger.GetAllLogs()
+	if len(logs) != before+1 || !strings.Contains(logs[len(logs)-1].Message, `/ violates "required": expected id, got missing`) {
+		t.Errorf("logged %v", logs[before:])
+	}
+}
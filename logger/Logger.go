@@ -3,55 +3,163 @@ package logger
 import (
 	"fmt"
 	"io"
+	"slices"
 	"strings"
+	"sync"
 )
 
 type Log struct {
-	Stage   int    `json:"stage"`
+	Stage int `json:"stage"`
+	// StepId is the stable ID of the step the log belongs to, if it has one.
+	StepId string `json:"stepId,omitempty"`
+	// Attempt numbers the logs of a retried step from 1, and is 0 otherwise.
+	Attempt int    `json:"attempt,omitempty"`
 	Message string `json:"message"`
 	Type    string `json:"type"`
 }
 
 var sharedLogs []Log
 
+// mu guards sharedLogs and every Logger's fields, since steps that time out
+// keep logging from their own goroutine.
+var mu sync.Mutex
+
 type Logger struct {
-	step int
+	step    int
+	stepId  string
+	attempt int
+	verbose bool
+	// abandoned is set once the step this logger was forked for has returned;
+	// later logs come from a step left running and are not collected.
+	abandoned bool
 }
 
 func NewLogger() *Logger {
 	return &Logger{step: 0}
 }
 
+// GetAllLogs returns a copy of the logs collected so far.
 func GetAllLogs() []Log {
-	return sharedLogs
+	mu.Lock()
+	defer mu.Unlock()
+	return slices.Clone(sharedLogs)
+}
+
+// ResetLogs discards the collected logs, so that a new run reports only its own.
+func ResetLogs() {
+	mu.Lock()
+	defer mu.Unlock()
+	sharedLogs = nil
 }
 
 func (l *Logger) Writer() io.Writer {
 	return &LogWriter{logger: l}
 }
 
+// Fork returns a logger for one run of a step, starting at l's step. Moving l
+// to another step does not move the fork, so that a step left running after
+// it timed out cannot log into the next one.
+func (l *Logger) Fork() *Logger {
+	mu.Lock()
+	defer mu.Unlock()
+	return &Logger{step: l.step, stepId: l.stepId, attempt: l.attempt, verbose: l.verbose}
+}
+
+// Abandon stops collecting l's logs once its step has returned, so that a
+// step that timed out and was left running is not reported. Its logs are still
+// printed, marked as abandoned.
+func (l *Logger) Abandon() {
+	mu.Lock()
+	defer mu.Unlock()
+	l.abandoned = true
+}
+
 func (l *Logger) NextStep() {
+	mu.Lock()
+	defer mu.Unlock()
 	l.step++
+	l.stepId = ""
+	l.attempt = 0
+}
+
+// SetStep moves the logger to step, e.g. -1 for logs written before the first step.
+func (l *Logger) SetStep(step int) {
+	mu.Lock()
+	defer mu.Unlock()
+	l.step = step
+	l.stepId = ""
+	l.attempt = 0
+}
+
+// SetStepId tags the current step's logs with the step's stable ID.
+func (l *Logger) SetStepId(id string) {
+	mu.Lock()
+	defer mu.Unlock()
+	l.stepId = id
+}
+
+// SetAttempt tags the current step's logs with the attempt being run, when
+// the step is retried. 0 removes the tag.
+func (l *Logger) SetAttempt(attempt int) {
+	mu.Lock()
+	defer mu.Unlock()
+	l.attempt = attempt
+}
+
+// record prints message with format, which takes the step and the message,
+// and collects it as a log of type kind.
+func (l *Logger) record(format string, message string, kind string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if l.abandoned {
+		fmt.Printf(format, l.step, "(abandoned) "+message)
+		return
+	}
+	fmt.Printf(format, l.step, message)
+	sharedLogs = append(sharedLogs, Log{Stage: l.step, StepId: l.stepId, Attempt: l.attempt, Message: message, Type: kind})
 }
 
 func (l *Logger) LogTitle(title string) {
-	fmt.Printf("--------------------------------Test %d: %s--------------------------------\n", l.step, title)
-	sharedLogs = append(sharedLogs, Log{Stage: l.step, Message: title, Type: "HEADER"})
+	l.record("--------------------------------Test %d: %s--------------------------------\n", title, "HEADER")
 }
 
 func (l *Logger) LogSuccess(message string) {
-	fmt.Printf(Colorize(Green, "[Test %d] [Success]: %s\n"), l.step, message)
-	sharedLogs = append(sharedLogs, Log{Stage: l.step, Message: message, Type: "SUCCESS"})
+	l.record(Colorize(Green, "[Test %d] [Success]: %s\n"), message, "SUCCESS")
 }
 
 func (l *Logger) LogInfo(message string) {
-	fmt.Printf(Colorize(Blue, "[Test %d] [Info]: %s\n"), l.step, message)
-	sharedLogs = append(sharedLogs, Log{Stage: l.step, Message: message, Type: "INFO"})
+	l.record(Colorize(Blue, "[Test %d] [Info]: %s\n"), message, "INFO")
 }
 
 func (l *Logger) LogError(message string) {
-	fmt.Printf(Colorize(Red, "[Test %d] [Error]: %s\n"), l.step, message)
-	sharedLogs = append(sharedLogs, Log{Stage: l.step, Message: message, Type: "FAILURE"})
+	l.record(Colorize(Red, "[Test %d] [Error]: %s\n"), message, "FAILURE")
+}
+
+func (l *Logger) LogWarning(message string) {
+	l.record(Colorize(Yellow, "[Test %d] [Warning]: %s\n"), message, "WARNING")
+}
+
+// SetVerbose turns on LogDebug output.
+func (l *Logger) SetVerbose(verbose bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	l.verbose = verbose
+}
+
+// LogDebug prints message in verbose mode only. Debug logs are not reported.
+func (l *Logger) LogDebug(message string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if l.verbose {
+		fmt.Printf("[Test %d] [Debug]: %s\n", l.step, message)
+	}
+}
+
+// LogHeader prints a line describing the whole run, such as its random seed.
+// Header logs are not collected, since reports record the run's settings
+// separately.
+func (l *Logger) LogHeader(message string) {
+	fmt.Println(Colorize(Blue, "[Run] "+message))
 }
 
 func (l *Logger) LogClientCode(message string) {
@@ -60,7 +168,6 @@ func (l *Logger) LogClientCode(message string) {
 		if line == "" {
 			continue
 		}
-		fmt.Printf(Colorize(Yellow, "[Test %d] [Your Code]: %s\n"), l.step, line)
-		sharedLogs = append(sharedLogs, Log{Stage: l.step, Message: line, Type: "CLIENT_CODE"})
+		l.record(Colorize(Yellow, "[Test %d] [Your Code]: %s\n"), line, "CLIENT_CODE")
 	}
 }
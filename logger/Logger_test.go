@@ -37,6 +37,88 @@ func TestNextStep(t *testing.T) {
 	}
 }
 
+func TestSetStep(t *testing.T) {
+	logger := NewLogger()
+
+	logger.SetStep(-1)
+	if logger.step != -1 {
+		t.Errorf("step after SetStep(-1) = %d, want -1", logger.step)
+	}
+
+	logger.SetStep(0)
+	logger.NextStep()
+	if logger.step != 1 {
+		t.Errorf("step after SetStep(0) and NextStep() = %d, want 1", logger.step)
+	}
+}
+
+func TestSetStepId(t *testing.T) {
+	resetSharedLogs()
+	logger := NewLogger()
+
+	logger.SetStepId("parse-flags")
+	logger.LogInfo("tagged")
+	logger.NextStep()
+	logger.LogInfo("untagged")
+
+	logs := GetAllLogs()
+	if len(logs) != 2 {
+		t.Fatalf("expected 2 logs, got %d", len(logs))
+	}
+	if logs[0].StepId != "parse-flags" {
+		t.Errorf("log StepId = %q, want %q", logs[0].StepId, "parse-flags")
+	}
+	if logs[1].StepId != "" {
+		t.Errorf("log StepId after NextStep() = %q, want empty", logs[1].StepId)
+	}
+}
+
+func TestResetLogs(t *testing.T) {
+	logger := NewLogger()
+	logger.LogInfo("first run")
+
+	ResetLogs()
+	if logs := GetAllLogs(); len(logs) != 0 {
+		t.Fatalf("expected no logs after ResetLogs(), got %d", len(logs))
+	}
+	logger.LogInfo("second run")
+	if logs := GetAllLogs(); len(logs) != 1 || logs[0].Message != "second run" {
+		t.Errorf("logs = %+v, want only the second run", logs)
+	}
+}
+
+func TestSetAttempt(t *testing.T) {
+	resetSharedLogs()
+	logger := NewLogger()
+
+	logger.SetAttempt(2)
+	logger.LogError("second attempt")
+	logger.SetStep(1)
+	logger.LogInfo("next step")
+
+	logs := GetAllLogs()
+	if logs[0].Attempt != 2 || logs[1].Attempt != 0 {
+		t.Errorf("log attempts = %d, %d, want 2 and then 0 after SetStep()", logs[0].Attempt, logs[1].Attempt)
+	}
+}
+
+func TestForkAndAbandon(t *testing.T) {
+	resetSharedLogs()
+	logger := NewLogger()
+	logger.SetStep(2)
+	logger.SetStepId("parse")
+	fork := logger.Fork()
+	logger.SetStep(3)
+	fork.LogInfo("from the step")
+	fork.Abandon()
+	fork.LogInfo("after the step returned")
+
+	logs := GetAllLogs()
+	if len(logs) != 1 || logs[0].Stage != 2 || logs[0].StepId != "parse" {
+		t.Errorf("logs = %+v, want only the fork's log before Abandon(), at its own step", logs)
+	}
+}
+
 func TestLogTitle(t *testing.T) {
 	resetSharedLogs()
 	logger := NewLogger()
@@ -133,6 +215,30 @@ func TestLogError(t *testing.T) {
 	}
 }
 
+func TestLogWarning(t *testing.T) {
+	resetSharedLogs()
+	logger := NewLogger()
+	logger.step = 2
+
+	logger.LogWarning("Something looks off")
+
+	logs := GetAllLogs()
+	if len(logs) != 1 {
+		t.Fatalf("expected 1 log, got %d", len(logs))
+	}
+
+	log := logs[0]
+	if log.Stage != 2 {
+		t.Errorf("log.Stage = %d, want 2", log.Stage)
+	}
+	if log.Message != "Something looks off" {
+		t.Errorf("log.Message = %q, want %q", log.Message, "Something looks off")
+	}
+	if log.Type != "WARNING" {
+		t.Errorf("log.Type = %q, want %q", log.Type, "WARNING")
+	}
+}
+
 func TestLogClientCode(t *testing.T) {
 	resetSharedLogs()
 	logger := NewLogger()
@@ -267,3 +373,17 @@ func TestGetAllLogsReturnsCurrentState(t *testing.T) {
 		t.Errorf("logs2[1].Message = %q, want %q", logs2[1].Message, "second")
 	}
 }
+
+func TestLogDebug(t *testing.T) {
+	resetSharedLogs()
+	logger := NewLogger()
+
+	logger.LogDebug("hidden")
+	logger.SetVerbose(true)
+	logger.LogDebug("shown")
+	logger.LogHeader("Random seed: 42")
+
+	if logs := GetAllLogs(); len(logs) != 0 {
+		t.Errorf("debug and header logs were collected: %v", logs)
+	}
+}
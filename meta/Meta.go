@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 )
 
 type Meta struct {
@@ -11,24 +12,76 @@ type Meta struct {
 	Entrypoint    string `json:"entrypoint"`
 	ExecutableDir string `json:"executableDir"`
 	ProjectId     string `json:"projectId"`
+	// Port is the port the user's server listens on, checked before server steps.
+	Port int `json:"port"`
+	// SourceDir is the learner's source tree, used to warn about stale binaries.
+	SourceDir string `json:"sourceDir"`
+	// Language selects a toolchain profile (go, rust, python, node). Empty means
+	// Entrypoint is already a runnable program.
+	Language string `json:"language"`
+	// Build optionally compiles the project before the first step.
+	Build *BuildConfig `json:"build,omitempty"`
 }
 
-func NewMeta() *Meta {
-	clientDir := os.Getenv("CLIENT_DIR")
-	if clientDir == "" {
-		clientDir = "/app/bin"
+type BuildConfig struct {
+	// Command is run with sh -c.
+	Command string `json:"command"`
+	// WorkingDir and Output are relative to ExecutableDir unless absolute.
+	WorkingDir string `json:"workingDir"`
+	Output     string `json:"output"`
+}
+
+// Executable returns the path of the program under test: the build output
+// when a build is configured, otherwise Entrypoint inside ExecutableDir.
+func (m *Meta) Executable() string {
+	if m.Build != nil && m.Build.Output != "" {
+		return m.resolve(m.Build.Output)
+	}
+	return m.ExecutableDir + "/" + m.Entrypoint
+}
+
+// BuildDir returns the directory the build command runs in.
+func (m *Meta) BuildDir() string {
+	if m.Build == nil || m.Build.WorkingDir == "" {
+		return m.ExecutableDir
+	}
+	return m.resolve(m.Build.WorkingDir)
+}
+
+func (m *Meta) resolve(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(m.ExecutableDir, path)
+}
+
+// ClientDir is the user's project directory: CLIENT_DIR, or /app/bin.
+func ClientDir() string {
+	if clientDir := os.Getenv("CLIENT_DIR"); clientDir != "" {
+		return clientDir
 	}
-	metaPath := clientDir + "/meta.json"
-	metaBytes, err := os.ReadFile(metaPath)
+	return "/app/bin"
+}
+
+func NewMeta() *Meta {
+	meta, err := Load(ClientDir())
 	if err != nil {
-		fmt.Println("Error reading meta file:", err)
+		fmt.Println("Error", err)
 		os.Exit(1)
 	}
+	return meta
+}
+
+// Load reads meta.json from the project directory dir.
+func Load(dir string) (*Meta, error) {
+	metaBytes, err := os.ReadFile(filepath.Join(dir, "meta.json"))
+	if err != nil {
+		return nil, fmt.Errorf("reading meta file: %v", err)
+	}
 	var meta Meta
 	if err := json.Unmarshal(metaBytes, &meta); err != nil {
-		fmt.Println("Error unmarshalling meta file:", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("unmarshalling meta file: %v", err)
 	}
-	meta.ExecutableDir = clientDir
-	return &meta
+	meta.ExecutableDir = dir
+	return &meta, nil
 }
@@ -2,6 +2,9 @@ package meta
 
 import (
 	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -63,3 +66,54 @@ func TestMetaStruct_JSONTags(t *testing.T) {
 		}
 	}
 }
+
+func TestMetaExecutable(t *testing.T) {
+	m := &Meta{Entrypoint: "server", ExecutableDir: "/project"}
+	if got := m.Executable(); got != "/project/server" {
+		t.Errorf("Executable() = %q, want /project/server", got)
+	}
+	if got := m.BuildDir(); got != "/project" {
+		t.Errorf("BuildDir() = %q, want /project", got)
+	}
+
+	m.Build = &BuildConfig{Command: "go build -o bin/server .", WorkingDir: "src", Output: "bin/server"}
+	if got := m.Executable(); got != "/project/bin/server" {
+		t.Errorf("Executable() = %q, want /project/bin/server", got)
+	}
+	if got := m.BuildDir(); got != "/project/src" {
+		t.Errorf("BuildDir() = %q, want /project/src", got)
+	}
+
+	m.Build.Output = "/tmp/server"
+	if got := m.Executable(); got != "/tmp/server" {
+		t.Errorf("Executable() = %q, want /tmp/server", got)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "meta.json"), []byte(`{"stage": 2, "entrypoint": "app", "language": "go"}`), 0644); err != nil {
+		t.Fatalf("failed to write meta.json: %v", err)
+	}
+	m, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if m.Stage != 2 || m.Language != "go" || m.ExecutableDir != dir {
+		t.Errorf("Load() = %+v, want stage 2 in %s", m, dir)
+	}
+	if _, err := Load(t.TempDir()); err == nil || !strings.HasPrefix(err.Error(), "reading meta file") {
+		t.Errorf("Load() error = %v for a directory without meta.json", err)
+	}
+}
+
+func TestClientDir(t *testing.T) {
+	t.Setenv("CLIENT_DIR", "")
+	if got := ClientDir(); got != "/app/bin" {
+		t.Errorf("ClientDir() = %q, want /app/bin", got)
+	}
+	t.Setenv("CLIENT_DIR", "/home/learner/project")
+	if got := ClientDir(); got != "/home/learner/project" {
+		t.Errorf("ClientDir() = %q, want CLIENT_DIR", got)
+	}
+}
@@ -0,0 +1,72 @@
+package process
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// tcpListen is the LISTEN state in /proc/net/tcp.
+const tcpListen = "0A"
+
+// PortOwner finds the process listening on a TCP port through /proc/net/tcp
+// and /proc/net/tcp6. It returns false when the port is free or the owner is
+// not visible, for example because it belongs to another user.
+func PortOwner(port int) (Process, bool) {
+	inodes := map[string]bool{}
+	for _, table := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		for _, inode := range listeningInodes(table, port) {
+			inodes[inode] = true
+		}
+	}
+	if len(inodes) == 0 {
+		return Process{}, false
+	}
+	processes, _ := List()
+	for _, p := range processes {
+		fdDir := fmt.Sprintf("/proc/%d/fd", p.Pid)
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(target, "socket:[") {
+				continue
+			}
+			if inodes[strings.TrimSuffix(strings.TrimPrefix(target, "socket:["), "]")] {
+				return p, true
+			}
+		}
+	}
+	return Process{}, false
+}
+
+func listeningInodes(table string, port int) []string {
+	file, err := os.Open(table)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	var inodes []string
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != tcpListen {
+			continue
+		}
+		_, portHex, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			continue
+		}
+		localPort, err := strconv.ParseInt(portHex, 16, 32)
+		if err == nil && int(localPort) == port {
+			inodes = append(inodes, fields[9])
+		}
+	}
+	return inodes
+}
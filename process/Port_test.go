@@ -0,0 +1,25 @@
+package process
+
+import (
+	"net"
+	"os"
+	"testing"
+)
+
+func TestPortOwner(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	owner, ok := PortOwner(port)
+	if !ok || owner.Pid != os.Getpid() {
+		t.Errorf("PortOwner(%d) = %v, %v, want this process", port, owner, ok)
+	}
+
+	listener.Close()
+	if owner, ok := PortOwner(port); ok {
+		t.Errorf("PortOwner(%d) = %v after close, want no owner", port, owner)
+	}
+}
@@ -0,0 +1,99 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Process is an entry of /proc.
+type Process struct {
+	Pid     int
+	PPid    int
+	Pgid    int
+	State   string
+	Command string
+}
+
+func (p Process) String() string {
+	return fmt.Sprintf("%d (%s)", p.Pid, p.Command)
+}
+
+// StatFields returns the fields of /proc/<pid>/stat that follow the command
+// name, so fields[0] is the state, fields[1] the parent pid and fields[2] the
+// process group.
+func StatFields(pid int) ([]string, error) {
+	_, fields, err := readStat(pid)
+	return fields, err
+}
+
+func readStat(pid int) (string, []string, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return "", nil, err
+	}
+	start := strings.IndexByte(string(data), '(')
+	end := strings.LastIndexByte(string(data), ')')
+	if start < 0 || end < start {
+		return "", nil, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 22 {
+		return "", nil, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	return string(data[start+1 : end]), fields, nil
+}
+
+func Get(pid int) (Process, error) {
+	command, fields, err := readStat(pid)
+	if err != nil {
+		return Process{}, err
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	pgid, _ := strconv.Atoi(fields[2])
+	return Process{Pid: pid, PPid: ppid, Pgid: pgid, State: fields[0], Command: command}, nil
+}
+
+// List returns every process visible in /proc. Processes that exit while
+// listing are skipped.
+func List() ([]Process, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	var processes []Process
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		p, err := Get(pid)
+		if err != nil {
+			continue
+		}
+		processes = append(processes, p)
+	}
+	return processes, nil
+}
+
+// Descendants returns the children of pid, their children and so on, in
+// breadth-first order.
+func Descendants(pid int) []Process {
+	processes, _ := List()
+	children := map[int][]Process{}
+	for _, p := range processes {
+		children[p.PPid] = append(children[p.PPid], p)
+	}
+	var descendants []Process
+	queue := []int{pid}
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+		for _, child := range children[parent] {
+			descendants = append(descendants, child)
+			queue = append(queue, child.Pid)
+		}
+	}
+	return descendants
+}
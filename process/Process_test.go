@@ -0,0 +1,52 @@
+package process
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestGetSelf(t *testing.T) {
+	p, err := Get(os.Getpid())
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if p.PPid != os.Getppid() || p.State == "" || p.Command == "" {
+		t.Errorf("Get() = %+v", p)
+	}
+	if _, err := Get(-1); err == nil {
+		t.Error("Get(-1) should fail")
+	}
+}
+
+func TestDescendants(t *testing.T) {
+	cmd := exec.Command("/bin/sh", "-c", "sleep 5 & sleep 5 & wait")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	descendants := Descendants(cmd.Process.Pid)
+	if len(descendants) != 2 {
+		t.Fatalf("Descendants() = %v, want two sleeps", descendants)
+	}
+	for _, p := range descendants {
+		if p.PPid != cmd.Process.Pid || p.Command != "sleep" {
+			t.Errorf("descendant = %+v, want a sleep child of the shell", p)
+		}
+	}
+	found := false
+	for _, p := range Descendants(os.Getpid()) {
+		if p.Pid == cmd.Process.Pid {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Descendants(self) should include the shell")
+	}
+}
@@ -0,0 +1,23 @@
+//go:build linux
+
+package process
+
+import "syscall"
+
+const prSetChildSubreaper = 36
+
+// EnableSubreaper makes orphaned descendants reparent to this process instead
+// of init, so double-forked or daemonized children stay visible to Descendants.
+func EnableSubreaper() error {
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 1, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// reap collects the exit status of a zombie child of this process.
+func reap(pid int) {
+	var status syscall.WaitStatus
+	syscall.Wait4(pid, &status, syscall.WNOHANG, nil)
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package process
+
+import "errors"
+
+func EnableSubreaper() error {
+	return errors.New("child subreapers are only supported on linux")
+}
+
+func reap(pid int) {}
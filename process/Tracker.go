@@ -0,0 +1,113 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/buildium-org/buildium_harness/logger"
+)
+
+// Tracker finds processes started by a step that are still alive after it,
+// including ones that double-forked or moved to another process group.
+type Tracker struct {
+	pid      int
+	existing map[int]bool
+}
+
+func NewTracker() (*Tracker, error) {
+	if err := EnableSubreaper(); err != nil {
+		return nil, fmt.Errorf("failed to become a child subreaper: %v", err)
+	}
+	t := &Tracker{pid: os.Getpid()}
+	t.Reset()
+	return t, nil
+}
+
+// Reset records the current descendants as belonging to the harness.
+func (t *Tracker) Reset() {
+	t.existing = map[int]bool{}
+	for _, p := range Descendants(t.pid) {
+		t.existing[p.Pid] = true
+	}
+}
+
+// Survivors returns the descendants started since the last Reset that are
+// still running. Zombies reparented to the harness are reaped along the way.
+func (t *Tracker) Survivors() []Process {
+	var survivors []Process
+	for _, p := range Descendants(t.pid) {
+		if t.existing[p.Pid] {
+			continue
+		}
+		if p.State == "Z" {
+			if p.PPid == t.pid {
+				reap(p.Pid)
+			}
+			continue
+		}
+		survivors = append(survivors, p)
+	}
+	return survivors
+}
+
+// Kill sends SIGKILL to processes and waits up to timeout for them to exit.
+// It returns the ones that are still running.
+func (t *Tracker) Kill(processes []Process, timeout time.Duration) []Process {
+	for _, p := range processes {
+		syscall.Kill(p.Pid, syscall.SIGKILL)
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		remaining := slices.DeleteFunc(t.Survivors(), func(p Process) bool {
+			return !slices.ContainsFunc(processes, func(killed Process) bool { return killed.Pid == p.Pid })
+		})
+		if len(remaining) == 0 || time.Now().After(deadline) {
+			return remaining
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Check kills the processes a step left behind and reports them as warnings,
+// or as errors that fail the step when fail is set. A nil Tracker checks nothing.
+func (t *Tracker) Check(l *logger.Logger, fail bool) error {
+	if t == nil {
+		return nil
+	}
+	defer t.Reset()
+	survivors := t.Survivors()
+	if len(survivors) == 0 {
+		return nil
+	}
+	for _, p := range survivors {
+		message := fmt.Sprintf("Process %s was still running after the step and has been killed", p)
+		if fail {
+			l.LogError(message)
+		} else {
+			l.LogWarning(message)
+		}
+	}
+	for _, p := range t.Kill(survivors, time.Second) {
+		l.LogError(fmt.Sprintf("Failed to kill process %s", p))
+	}
+	if fail {
+		return fmt.Errorf("%d processes were left running after the step; make sure your program waits for or stops every process it starts", len(survivors))
+	}
+	l.LogWarning("Make sure your program waits for or stops every process it starts")
+	return nil
+}
+
+// FailOnOrphans reads ORPHAN_PROCESSES, which is "warn" (the default) or "fail".
+func FailOnOrphans() (bool, error) {
+	switch mode := os.Getenv("ORPHAN_PROCESSES"); mode {
+	case "", "warn":
+		return false, nil
+	case "fail":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid ORPHAN_PROCESSES %q, expected warn or fail", mode)
+	}
+}
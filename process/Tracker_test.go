@@ -0,0 +1,90 @@
+package process
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/buildium-org/buildium_harness/logger"
+)
+
+// doubleFork starts a sleep that outlives its parent and its parent's group.
+func doubleFork(t *testing.T) {
+	t.Helper()
+	if err := exec.Command("/bin/sh", "-c", "(setsid sleep 30 &)").Run(); err != nil {
+		t.Fatalf("failed to double fork: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+}
+
+func TestTrackerFindsAndKillsOrphans(t *testing.T) {
+	tracker, err := NewTracker()
+	if err != nil {
+		t.Skipf("subreaper unavailable: %v", err)
+	}
+	doubleFork(t)
+
+	survivors := tracker.Survivors()
+	if len(survivors) != 1 || survivors[0].Command != "sleep" {
+		t.Fatalf("Survivors() = %v, want the orphaned sleep", survivors)
+	}
+	if remaining := tracker.Kill(survivors, time.Second); len(remaining) != 0 {
+		t.Errorf("Kill() left %v running", remaining)
+	}
+	if survivors := tracker.Survivors(); len(survivors) != 0 {
+		t.Errorf("Survivors() = %v after Kill, want none", survivors)
+	}
+}
+
+func TestTrackerCheck(t *testing.T) {
+	tracker, err := NewTracker()
+	if err != nil {
+		t.Skipf("subreaper unavailable: %v", err)
+	}
+	l := logger.NewLogger()
+
+	if err := tracker.Check(l, true); err != nil {
+		t.Errorf("Check() error = %v with nothing left running", err)
+	}
+
+	doubleFork(t)
+	before := len(logger.GetAllLogs())
+	if err := tracker.Check(l, false); err != nil {
+		t.Errorf("Check() in warn mode error = %v", err)
+	}
+	logs := logger.GetAllLogs()[before:]
+	if len(logs) == 0 || logs[0].Type != "WARNING" || !strings.Contains(logs[0].Message, "(sleep) was still running") {
+		t.Errorf("logs = %v, want a warning about the sleep", logs)
+	}
+
+	doubleFork(t)
+	if err := tracker.Check(l, true); err == nil || !strings.Contains(err.Error(), "1 processes were left running") {
+		t.Errorf("Check() in fail mode error = %v", err)
+	}
+	if survivors := tracker.Survivors(); len(survivors) != 0 {
+		t.Errorf("Survivors() = %v after Check, want none", survivors)
+	}
+}
+
+func TestNilTrackerCheck(t *testing.T) {
+	var tracker *Tracker
+	if err := tracker.Check(logger.NewLogger(), true); err != nil {
+		t.Errorf("Check() on nil tracker error = %v", err)
+	}
+}
+
+func TestFailOnOrphans(t *testing.T) {
+	cases := map[string]bool{"": false, "warn": false, "fail": true}
+	for value, want := range cases {
+		t.Setenv("ORPHAN_PROCESSES", value)
+		got, err := FailOnOrphans()
+		if err != nil || got != want {
+			t.Errorf("FailOnOrphans() with %q = %v, %v, want %v", value, got, err, want)
+		}
+	}
+	t.Setenv("ORPHAN_PROCESSES", "ignore")
+	if _, err := FailOnOrphans(); err == nil {
+		t.Error("FailOnOrphans() should reject unknown modes")
+	}
+}
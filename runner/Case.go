@@ -0,0 +1,58 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/buildium-org/buildium_harness/logger"
+)
+
+// Case is one input checked within a step.
+type Case[C any] struct {
+	Name string
+	Run  func(config C) error
+	// Required stops the remaining cases when this one fails, for cases the
+	// others depend on.
+	Required bool
+}
+
+type caseFailure struct {
+	name string
+	err  error
+}
+
+// RunCases runs every case, logging each result, and keeps going after a
+// failure unless the failed case is Required. It ends with a summary such as
+// "12/15 cases passed" followed by the failing cases, and returns an error if
+// any case failed.
+func RunCases[C any](l *logger.Logger, config C, cases []Case[C]) error {
+	var failures []caseFailure
+	ran := 0
+	for i, c := range cases {
+		ran++
+		err := c.Run(config)
+		if err == nil {
+			l.LogSuccess(fmt.Sprintf("Case %d/%d passed: %s", i+1, len(cases), c.Name))
+			continue
+		}
+		l.LogError(fmt.Sprintf("Case %d/%d failed: %s: %v", i+1, len(cases), c.Name, err))
+		failures = append(failures, caseFailure{name: c.Name, err: err})
+		if c.Required {
+			l.LogInfo(fmt.Sprintf("Skipping the remaining %d cases because %q is required", len(cases)-ran, c.Name))
+			break
+		}
+	}
+
+	summary := fmt.Sprintf("%d/%d cases passed", ran-len(failures), len(cases))
+	if len(failures) == 0 {
+		l.LogSuccess(summary)
+		return nil
+	}
+	l.LogError(summary)
+	names := make([]string, len(failures))
+	for i, failure := range failures {
+		l.LogError(fmt.Sprintf("  %s: %v", failure.name, failure.err))
+		names[i] = failure.name
+	}
+	return fmt.Errorf("%d of %d cases failed: %s", len(failures), len(cases), strings.Join(names, ", "))
+}
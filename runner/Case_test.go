@@ -0,0 +1,89 @@
+package runner
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/buildium-org/buildium_harness/logger"
+)
+
+func caseLogs(before int) []string {
+	var messages []string
+	for _, log := range logger.GetAllLogs()[before:] {
+		messages = append(messages, log.Type+" "+log.Message)
+	}
+	return messages
+}
+
+func TestRunCases(t *testing.T) {
+	var seen []string
+	check := func(want int) func(config int) error {
+		return func(config int) error {
+			seen = append(seen, "case")
+			if config != want {
+				return errors.New("wrong answer")
+			}
+			return nil
+		}
+	}
+	cases := []Case[int]{
+		{Name: "adds", Run: check(4)},
+		{Name: "subtracts", Run: check(0)},
+		{Name: "multiplies", Run: check(4)},
+		{Name: "divides", Run: check(1)},
+	}
+
+	before := len(logger.GetAllLogs())
+	err := RunCases(logger.NewLogger(), 4, cases)
+	if err == nil || err.Error() != "2 of 4 cases failed: subtracts, divides" {
+		t.Errorf("RunCases() error = %v", err)
+	}
+	if len(seen) != 4 {
+		t.Errorf("ran %d cases, want all 4 after failures", len(seen))
+	}
+	want := []string{
+		"SUCCESS Case 1/4 passed: adds",
+		"FAILURE Case 2/4 failed: subtracts: wrong answer",
+		"SUCCESS Case 3/4 passed: multiplies",
+		"FAILURE Case 4/4 failed: divides: wrong answer",
+		"FAILURE 2/4 cases passed",
+		"FAILURE   subtracts: wrong answer",
+		"FAILURE   divides: wrong answer",
+	}
+	if got := caseLogs(before); !reflect.DeepEqual(got, want) {
+		t.Errorf("logs = %q\nwant %q", got, want)
+	}
+}
+
+func TestRunCasesAllPass(t *testing.T) {
+	pass := func(config int) error { return nil }
+	before := len(logger.GetAllLogs())
+	if err := RunCases(logger.NewLogger(), 0, []Case[int]{{Name: "a", Run: pass}, {Name: "b", Run: pass}}); err != nil {
+		t.Fatalf("RunCases() error = %v", err)
+	}
+	logs := caseLogs(before)
+	if logs[len(logs)-1] != "SUCCESS 2/2 cases passed" {
+		t.Errorf("logs = %q, want a passing summary", logs)
+	}
+}
+
+func TestRunCasesRequired(t *testing.T) {
+	ran := 0
+	cases := []Case[int]{
+		{Name: "connects", Required: true, Run: func(config int) error { ran++; return errors.New("refused") }},
+		{Name: "queries", Run: func(config int) error { ran++; return nil }},
+		{Name: "closes", Run: func(config int) error { ran++; return nil }},
+	}
+	before := len(logger.GetAllLogs())
+	if err := RunCases(logger.NewLogger(), 0, cases); err == nil {
+		t.Fatal("RunCases() should fail")
+	}
+	if ran != 1 {
+		t.Errorf("ran %d cases, want the rest skipped after a required failure", ran)
+	}
+	logs := caseLogs(before)
+	if logs[1] != `INFO Skipping the remaining 2 cases because "connects" is required` || logs[2] != "FAILURE 0/3 cases passed" {
+		t.Errorf("logs = %q", logs)
+	}
+}
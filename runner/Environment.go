@@ -0,0 +1,82 @@
+package runner
+
+import (
+	"context"
+	"maps"
+)
+
+// Adapt lets env run steps that take config B, built from env's config A.
+func Adapt[A, B any](env Environment[A], convert func(A) B) Environment[B] {
+	return &adapted[A, B]{env: env, convert: convert}
+}
+
+type adapted[A, B any] struct {
+	env     Environment[A]
+	convert func(A) B
+}
+
+func (a *adapted[A, B]) Setup(ctx context.Context, s *Session) error {
+	return a.env.Setup(ctx, s)
+}
+
+func (a *adapted[A, B]) RunStep(ctx context.Context, s *Session, step func(config B) error) error {
+	return a.env.RunStep(ctx, s, func(config A) error {
+		return step(a.convert(config))
+	})
+}
+
+func (a *adapted[A, B]) Extras(ctx context.Context, s *Session) map[string]any {
+	return a.env.Extras(ctx, s)
+}
+
+func (a *adapted[A, B]) Teardown(s *Session) {
+	a.env.Teardown(s)
+}
+
+// Combine runs each step inside both outer and inner, e.g. a CLI step that
+// talks to a running server, passing it the config join builds from theirs.
+// outer is set up first and torn down last.
+func Combine[A, B, C any](outer Environment[A], inner Environment[B], join func(A, B) C) Environment[C] {
+	return &combined[A, B, C]{outer: outer, inner: inner, join: join}
+}
+
+type combined[A, B, C any] struct {
+	outer Environment[A]
+	inner Environment[B]
+	join  func(A, B) C
+}
+
+func (c *combined[A, B, C]) Setup(ctx context.Context, s *Session) error {
+	if err := c.outer.Setup(ctx, s); err != nil {
+		return err
+	}
+	if err := c.inner.Setup(ctx, s); err != nil {
+		c.outer.Teardown(s)
+		return err
+	}
+	return nil
+}
+
+func (c *combined[A, B, C]) RunStep(ctx context.Context, s *Session, step func(config C) error) error {
+	return c.outer.RunStep(ctx, s, func(a A) error {
+		return c.inner.RunStep(ctx, s, func(b B) error {
+			return step(c.join(a, b))
+		})
+	})
+}
+
+// Extras merges both environments' extras; inner wins on conflicting keys.
+func (c *combined[A, B, C]) Extras(ctx context.Context, s *Session) map[string]any {
+	outer, inner := c.outer.Extras(ctx, s), c.inner.Extras(ctx, s)
+	if outer == nil {
+		return inner
+	}
+	extras := maps.Clone(outer)
+	maps.Copy(extras, inner)
+	return extras
+}
+
+func (c *combined[A, B, C]) Teardown(s *Session) {
+	c.inner.Teardown(s)
+	c.outer.Teardown(s)
+}
@@ -0,0 +1,76 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/buildium-org/buildium_harness/logger"
+)
+
+// Hooks run tutorial code around the steps, such as seeding fixtures or
+// dumping diagnostics after a failure. Every hook is optional.
+//
+// BeforeAll runs after the environment is set up and BeforeEach before each
+// step that is not skipped. AfterEach and AfterAll always run after them, even
+// when a hook or step fails or panics, and get the run's context rather than
+// one that may have timed out. A hook error stops the run but is reported as a
+// hook failure, not a failing step.
+type Hooks struct {
+	BeforeAll  func(ctx context.Context, s *Session) error
+	AfterAll   func(ctx context.Context, s *Session, result *RunResult) error
+	BeforeEach func(ctx context.Context, s *Session) error
+	AfterEach  func(ctx context.Context, s *Session, result StepResult) error
+}
+
+// SetHooks sets the hooks run around the steps.
+func (r *Runner[C]) SetHooks(hooks Hooks) {
+	r.hooks = hooks
+}
+
+func (h Hooks) beforeAll(ctx context.Context, s *Session) error {
+	if h.BeforeAll == nil {
+		return nil
+	}
+	return runHook(s.Logger, "BeforeAll hook", func() error { return h.BeforeAll(ctx, s) })
+}
+
+func (h Hooks) afterAll(ctx context.Context, s *Session, result *RunResult) error {
+	if h.AfterAll == nil {
+		return nil
+	}
+	return runHook(s.Logger, "AfterAll hook", func() error { return h.AfterAll(ctx, s, result) })
+}
+
+func (h Hooks) beforeEach(ctx context.Context, s *Session) error {
+	if h.BeforeEach == nil {
+		return nil
+	}
+	return runHook(s.Logger, fmt.Sprintf("BeforeEach hook for step %q", s.StepId), func() error { return h.BeforeEach(ctx, s) })
+}
+
+func (h Hooks) afterEach(ctx context.Context, s *Session, result StepResult) error {
+	if h.AfterEach == nil {
+		return nil
+	}
+	return runHook(s.Logger, fmt.Sprintf("AfterEach hook for step %q", s.StepId), func() error { return h.AfterEach(ctx, s, result) })
+}
+
+// runHook runs hook, turning a panic into an error, and logs its failure
+// under name.
+func runHook(l *logger.Logger, name string, hook func() error) (err error) {
+	var stack []byte
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err, stack = fmt.Errorf("panicked: %v", recovered), debug.Stack()
+		}
+		if err != nil {
+			err = fmt.Errorf("%s failed: %w", name, err)
+			l.LogError(err.Error())
+		}
+		if stack != nil {
+			l.LogInfo(string(stack))
+		}
+	}()
+	return hook()
+}
@@ -0,0 +1,143 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// recordingHooks appends each hook call to calls, failing the hooks in fail.
+func recordingHooks(calls *[]string, fail map[string]error) Hooks {
+	return Hooks{
+		BeforeAll: func(ctx context.Context, s *Session) error {
+			*calls = append(*calls, "beforeAll")
+			return fail["beforeAll"]
+		},
+		AfterAll: func(ctx context.Context, s *Session, result *RunResult) error {
+			*calls = append(*calls, "afterAll:"+result.Summary())
+			return fail["afterAll"]
+		},
+		BeforeEach: func(ctx context.Context, s *Session) error {
+			*calls = append(*calls, "beforeEach:"+s.StepId)
+			return fail["beforeEach:"+s.StepId]
+		},
+		AfterEach: func(ctx context.Context, s *Session, result StepResult) error {
+			*calls = append(*calls, "afterEach:"+result.Id+":"+string(result.Status))
+			return fail["afterEach:"+result.Id]
+		},
+	}
+}
+
+func TestHooks(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+
+	pass := func(config string) error { return nil }
+	fail := func(config string) error { return errors.New("wrong output") }
+	panics := func(config string) error { panic("boom") }
+	hookErr := errors.New("fixture missing")
+	cases := []struct {
+		name   string
+		steps  []Step[string]
+		skip   []string
+		fail   map[string]error
+		calls  []string
+		kind   ErrorKind
+		err    string
+		hooked int
+	}{
+		{
+			name:  "passes",
+			steps: Steps(pass, pass, pass),
+			skip:  []string{"step-1"},
+			calls: []string{"beforeAll", "beforeEach:step-0", "afterEach:step-0:passed",
+				"beforeEach:step-2", "afterEach:step-2:passed", "afterAll:2/2 steps passed, 1 skipped"},
+		},
+		{
+			name:  "step fails",
+			steps: Steps(pass, fail, pass),
+			calls: []string{"beforeAll", "beforeEach:step-0", "afterEach:step-0:passed",
+				"beforeEach:step-1", "afterEach:step-1:failed", `afterAll:1/2 steps passed, step "step-1" failed`},
+			kind: TestFailure,
+			err:  "wrong output",
+		},
+		{
+			name:  "step panics",
+			steps: Steps(panics),
+			calls: []string{"beforeAll", "beforeEach:step-0", "afterEach:step-0:failed",
+				`afterAll:0/1 steps passed, step "step-0" failed`},
+			kind: TestFailure,
+			err:  "step panicked: boom",
+		},
+		{
+			name:  "BeforeAll fails",
+			steps: Steps(pass),
+			fail:  map[string]error{"beforeAll": hookErr},
+			calls: []string{"beforeAll", "afterAll:0/0 steps passed: BeforeAll hook failed: fixture missing"},
+			kind:  HookError, err: "BeforeAll hook failed: fixture missing", hooked: 1,
+		},
+		{
+			name:  "BeforeEach fails",
+			steps: Steps(pass, pass),
+			fail:  map[string]error{"beforeEach:step-1": hookErr},
+			calls: []string{"beforeAll", "beforeEach:step-0", "afterEach:step-0:passed",
+				"beforeEach:step-1", "afterEach:step-1:not run",
+				`afterAll:1/1 steps passed: BeforeEach hook for step "step-1" failed: fixture missing`},
+			kind: HookError, err: `BeforeEach hook for step "step-1" failed: fixture missing`, hooked: 1,
+		},
+		{
+			name:  "AfterEach fails after a failed step",
+			steps: Steps(fail, pass),
+			fail:  map[string]error{"afterEach:step-0": hookErr, "afterAll": hookErr},
+			calls: []string{"beforeAll", "beforeEach:step-0", "afterEach:step-0:failed",
+				`afterAll:0/1 steps passed, step "step-0" failed`},
+			kind: TestFailure, err: "wrong output", hooked: 2,
+		},
+	}
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			var calls, envCalls []string
+			runner := New(testMeta(2), &fakeEnvironment{name: "env", calls: &envCalls}, test.steps, test.skip)
+			runner.SetHooks(recordingHooks(&calls, test.fail))
+			result := runner.Execute(newTestContext())
+			if !reflect.DeepEqual(calls, test.calls) {
+				t.Errorf("calls = %q, want %q", calls, test.calls)
+			}
+			if result.Kind != test.kind || (test.err != "" && (result.Err == nil || result.Err.Error() != test.err)) {
+				t.Errorf("result kind %d, error %v, want kind %d, error %q", result.Kind, result.Err, test.kind, test.err)
+			}
+			if len(result.HookErrs) != test.hooked {
+				t.Errorf("HookErrs = %v, want %d", result.HookErrs, test.hooked)
+			}
+			if envCalls[len(envCalls)-1] != "env.teardown" {
+				t.Errorf("environment calls = %v, want teardown last", envCalls)
+			}
+		})
+	}
+}
+
+func TestHookPanics(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+
+	var calls []string
+	ranAfterAll := false
+	runner := New(testMeta(0), &fakeEnvironment{name: "env", calls: &calls}, Steps(func(config string) error { return nil }), nil)
+	runner.SetHooks(Hooks{
+		AfterEach: func(ctx context.Context, s *Session, result StepResult) error { panic("dump failed") },
+		AfterAll: func(ctx context.Context, s *Session, result *RunResult) error {
+			ranAfterAll = true
+			return nil
+		},
+	})
+	result := runner.Execute(newTestContext())
+	if result.Kind != HookError || result.ExitCode() != ExitHarnessError || !ranAfterAll {
+		t.Fatalf("result = %+v, want a hook error after AfterAll ran", result)
+	}
+	if !strings.HasPrefix(result.Err.Error(), `AfterEach hook for step "step-0" failed: panicked: dump failed`) {
+		t.Errorf("Err = %v, want the panic", result.Err)
+	}
+	if result.Steps[0].Status != StepPassed || result.CompletedStage != 0 {
+		t.Errorf("result = %+v, want the step to pass despite its hook", result)
+	}
+}
@@ -0,0 +1,210 @@
+package runner
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/buildium-org/buildium_harness/logger"
+	"github.com/buildium-org/buildium_harness/meta"
+	"github.com/buildium-org/buildium_harness/utils"
+)
+
+// Options are the harness's command-line flags, shared by every tutorial.
+type Options struct {
+	// Path is the user's project directory, overriding CLIENT_DIR.
+	Path string
+	// Step runs a single step, by index or Id.
+	Step string
+	// From starts the run at a step, by index or Id.
+	From string
+	// List prints the steps instead of running them.
+	List bool
+	// All runs steps past the user's stage.
+	All     bool
+	Verbose bool
+	// ExitCode exits the process with the run's exit code; see RunResult.ExitCode.
+	ExitCode bool
+	// Watch reruns the steps whenever the user's program changes; see Runner.Watch.
+	Watch bool
+	// Seed replays a run's random inputs, overriding BUILDIUM_SEED. 0 picks a
+	// new seed.
+	Seed int64
+}
+
+// ParseFlags parses the harness flags from args, usually os.Args[1:].
+func ParseFlags(name string, args []string) (Options, error) {
+	var options Options
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.StringVar(&options.Path, "path", "", "the project directory containing meta.json (default $CLIENT_DIR or /app/bin)")
+	flags.StringVar(&options.Step, "step", "", "run only this step, by index or Id")
+	flags.StringVar(&options.Step, "only", "", "alias for -step")
+	flags.StringVar(&options.From, "from", "", "start at this step, by index or Id")
+	flags.BoolVar(&options.List, "list", false, "list the steps and exit")
+	flags.BoolVar(&options.All, "all", false, "run every step, ignoring the stage in meta.json")
+	flags.BoolVar(&options.Verbose, "v", false, "print debug output")
+	flags.BoolVar(&options.ExitCode, "exit-code", false,
+		"exit with 1 if a step fails, 2 if the steps could not run, 3 if login or upload fails")
+	flags.Int64Var(&options.Seed, "seed", 0, "replay the random inputs of the run with this seed (default $BUILDIUM_SEED, or a new seed)")
+	flags.BoolVar(&options.Watch, "watch", false, "rerun the steps whenever the executable or its sources change")
+	if err := flags.Parse(args); err != nil {
+		return Options{}, err
+	}
+	if flags.NArg() > 0 {
+		return Options{}, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+	if options.Step != "" && options.From != "" {
+		return Options{}, fmt.Errorf("-step and -from cannot be used together")
+	}
+	return options, nil
+}
+
+// Dir returns the project directory, from -path or the environment.
+func (o Options) Dir() string {
+	if o.Path != "" {
+		return o.Path
+	}
+	return meta.ClientDir()
+}
+
+// Partial reports whether the options skip steps the user has reached, in
+// which case the run is not reported.
+func (o Options) Partial() bool {
+	return o.Step != "" || o.From != ""
+}
+
+// SetOptions applies command-line options to the run.
+func (r *Runner[C]) SetOptions(options Options) {
+	r.options = options
+}
+
+// stepRange returns the indexes of the first and last steps to run.
+func (r *Runner[C]) stepRange() (int, int, error) {
+	last := min(r.meta.Stage, len(r.steps)-1)
+	if r.options.All {
+		last = len(r.steps) - 1
+	}
+	if r.options.Step != "" {
+		i, err := findStep(r.steps, r.options.Step)
+		return i, i, err
+	}
+	if r.options.From != "" {
+		first, err := findStep(r.steps, r.options.From)
+		if err == nil && first > last {
+			err = fmt.Errorf("step %q is past your current stage %d; add -all to run it", r.options.From, r.meta.Stage)
+		}
+		return first, last, err
+	}
+	return 0, last, nil
+}
+
+// findStep finds a step by Id, or by index.
+func findStep[C any](steps []Step[C], ref string) (int, error) {
+	if i := slices.IndexFunc(steps, func(step Step[C]) bool { return step.Id == ref }); i >= 0 {
+		return i, nil
+	}
+	if i, err := strconv.Atoi(ref); err == nil && i >= 0 && i < len(steps) {
+		return i, nil
+	}
+	return 0, fmt.Errorf("unknown step %q; run with -list to see the steps", ref)
+}
+
+// PrintSteps writes the curriculum to w, marking skipped steps and those past
+// stage. A negative stage marks none.
+func PrintSteps[C any](w io.Writer, steps []Step[C], skipSteps []string, stage int) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tID\tTITLE\tTAGS\t")
+	for i, step := range steps {
+		var notes []string
+		if slices.Contains(skipSteps, step.Id) {
+			notes = append(notes, "skipped")
+		}
+		if stage >= 0 && i > stage {
+			notes = append(notes, "locked")
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", i, step.Id, step.Title, strings.Join(step.Tags, ","), strings.Join(notes, ", "))
+	}
+	tw.Flush()
+}
+
+// Main runs steps in env as a tutorial's main function: it parses the harness
+// flags from os.Args, loads meta.json, runs the steps and prints a summary.
+// With -exit-code it exits the process with the result's exit code.
+func Main[C any](env Environment[C], steps []Step[C], skipSteps []string) *RunResult {
+	return MainWithHooks(env, steps, skipSteps, Hooks{})
+}
+
+// MainWithHooks is Main running hooks around the steps.
+func MainWithHooks[C any](env Environment[C], steps []Step[C], skipSteps []string, hooks Hooks) *RunResult {
+	return runMain(env, steps, skipSteps, hooks, false)
+}
+
+// MainWithIndexSkips is MainWithHooks for older tutorials that skip steps by
+// index; see Runner.SetIndexSkips.
+func MainWithIndexSkips[C any](env Environment[C], steps []Step[C], skipIndexes []int, hooks Hooks) *RunResult {
+	return runMain(env, steps, IndexIds(skipIndexes), hooks, true)
+}
+
+func runMain[C any](env Environment[C], steps []Step[C], skipSteps []string, hooks Hooks, indexSkips bool) *RunResult {
+	options, err := ParseFlags(os.Args[0], os.Args[1:])
+	if err == flag.ErrHelp {
+		return &RunResult{CompletedStage: -1, Report: ReportSkipped}
+	}
+	if err != nil {
+		fmt.Println("Error", err)
+		os.Exit(ExitHarnessError)
+	}
+	m, err := meta.Load(options.Dir())
+	if options.List {
+		stage := -1
+		if err == nil && !options.All {
+			stage = m.Stage
+		}
+		PrintSteps(os.Stdout, steps, skipSteps, stage)
+		return &RunResult{CompletedStage: -1, Report: ReportSkipped}
+	}
+	if err != nil {
+		fmt.Println("Error", err)
+		os.Exit(ExitHarnessError)
+	}
+
+	l := logger.NewLogger()
+	l.SetVerbose(options.Verbose)
+	ctx := context.WithValue(context.Background(), "logger", l)
+	runner := New(m, env, steps, skipSteps)
+	runner.SetOptions(options)
+	runner.SetHooks(hooks)
+	runner.SetIndexSkips(indexSkips)
+	var result *RunResult
+	if options.Watch {
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+		defer stop()
+		result = runner.Watch(ctx, os.Stdout)
+	} else {
+		result = runner.Execute(ctx)
+		logResult(l, m, result)
+	}
+	if options.ExitCode {
+		os.Exit(result.ExitCode())
+	}
+	return result
+}
+
+// logResult logs the summary that ends a run.
+func logResult(l *logger.Logger, m *meta.Meta, result *RunResult) {
+	if result.Passed() {
+		l.LogSuccess("Testing complete! " + result.Summary())
+	} else {
+		l.LogError("Testing stopped: " + result.Summary())
+	}
+	if result.Report == ReportUploaded {
+		l.LogInfo("See results at " + utils.GetProjectUrl(m.ProjectId))
+	}
+}
@@ -0,0 +1,147 @@
+package runner
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/buildium-org/buildium_harness/logger"
+)
+
+func TestParseFlags(t *testing.T) {
+	options, err := ParseFlags("tutorial", []string{"-path=/home/learner/project", "-only", "parse-flags", "-all", "-v", "-seed", "42"})
+	if err != nil {
+		t.Fatalf("ParseFlags() error = %v", err)
+	}
+	want := Options{Path: "/home/learner/project", Step: "parse-flags", All: true, Verbose: true, Seed: 42}
+	if options != want {
+		t.Errorf("ParseFlags() = %+v, want %+v", options, want)
+	}
+	if options.Dir() != "/home/learner/project" || !options.Partial() {
+		t.Errorf("Dir() = %q, Partial() = %v", options.Dir(), options.Partial())
+	}
+
+	t.Setenv("CLIENT_DIR", "/client")
+	if options, _ := ParseFlags("tutorial", []string{"-list"}); !options.List || options.Dir() != "/client" || options.Partial() {
+		t.Errorf("ParseFlags(-list) = %+v", options)
+	}
+
+	for _, args := range [][]string{{"-step", "1", "-from", "2"}, {"extra"}, {"-unknown"}} {
+		if _, err := ParseFlags("tutorial", args); err == nil {
+			t.Errorf("ParseFlags(%q) should fail", args)
+		}
+	}
+}
+
+func TestStepRange(t *testing.T) {
+	steps := Steps(make([]func(config string) error, 5)...)
+	cases := []struct {
+		options Options
+		first   int
+		last    int
+		err     string
+	}{
+		{Options{}, 0, 2, ""},
+		{Options{All: true}, 0, 4, ""},
+		{Options{Step: "step-4"}, 4, 4, ""},
+		{Options{Step: "3"}, 3, 3, ""},
+		{Options{From: "1"}, 1, 2, ""},
+		{Options{From: "step-3"}, 0, 0, "past your current stage 2"},
+		{Options{From: "step-3", All: true}, 3, 4, ""},
+		{Options{Step: "missing"}, 0, 0, `unknown step "missing"`},
+		{Options{Step: "5"}, 0, 0, `unknown step "5"`},
+	}
+	for _, test := range cases {
+		runner := New[string](testMeta(2), nil, steps, nil)
+		runner.SetOptions(test.options)
+		first, last, err := runner.stepRange()
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("stepRange(%+v) error = %v, want %q", test.options, err, test.err)
+			}
+			continue
+		}
+		if err != nil || first != test.first || last != test.last {
+			t.Errorf("stepRange(%+v) = %d, %d, %v; want %d, %d", test.options, first, last, err, test.first, test.last)
+		}
+	}
+}
+
+func TestRunWithOptions(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+
+	var calls []string
+	var ran []int
+	var steps []Step[string]
+	for i := range 4 {
+		steps = append(steps, Step[string]{Id: IndexId(i), Title: "Step", Run: func(config string) error {
+			ran = append(ran, i)
+			return nil
+		}})
+	}
+
+	runner := New(testMeta(1), &fakeEnvironment{name: "env", calls: &calls}, steps, nil)
+	runner.SetOptions(Options{From: "step-2", All: true})
+	before := len(logger.GetAllLogs())
+	if err := runner.Run(newTestContext()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !reflect.DeepEqual(ran, []int{2, 3}) {
+		t.Errorf("ran steps %v, want 2 and 3", ran)
+	}
+	logs := logger.GetAllLogs()[before:]
+	if logs[0].Stage != 2 || logs[0].StepId != "step-2" {
+		t.Errorf("first log = %+v, want it numbered as step 2", logs[0])
+	}
+	if last := logs[len(logs)-1]; last.Message != "Only some steps ran, so this run was not reported" {
+		t.Errorf("last log = %+v, want the run not to be reported", last)
+	}
+}
+
+func TestPrintSteps(t *testing.T) {
+	run := func(config string) error { return nil }
+	steps := []Step[string]{
+		{Id: "basic-output", Title: "Basic Output", Tags: []string{"output"}, Run: run},
+		{Id: "flags", Title: "Flags", Run: run},
+		{Id: "files", Title: "Files", Tags: []string{"io", "files"}, Run: run},
+	}
+	var out bytes.Buffer
+	PrintSteps(&out, steps, []string{"flags"}, 1)
+	want := "" +
+		"#  ID            TITLE         TAGS      \n" +
+		"0  basic-output  Basic Output  output    \n" +
+		"1  flags         Flags                   skipped\n" +
+		"2  files         Files         io,files  locked\n"
+	if out.String() != want {
+		t.Errorf("PrintSteps() =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestMainParsesFlags(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "meta.json"), []byte(`{"stage": 0, "entrypoint": "app"}`), 0644); err != nil {
+		t.Fatalf("failed to write meta.json: %v", err)
+	}
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{"tutorial", "-path", dir, "-step", "step-1"}
+
+	var calls []string
+	var ran []int
+	steps := Steps(
+		func(config string) error { ran = append(ran, 0); return nil },
+		func(config string) error { ran = append(ran, 1); return nil },
+	)
+	result := Main[string](&fakeEnvironment{name: "env", calls: &calls}, steps, nil)
+	if !result.Passed() || result.Report != ReportSkipped {
+		t.Fatalf("Main() = %+v, want a passing run that was not reported", result)
+	}
+	if !reflect.DeepEqual(ran, []int{1}) {
+		t.Errorf("ran steps %v, want only step 1 from %s", ran, dir)
+	}
+}
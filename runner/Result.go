@@ -0,0 +1,191 @@
+package runner
+
+import (
+	"fmt"
+	"maps"
+	"time"
+)
+
+type StepStatus string
+
+const (
+	StepPassed  StepStatus = "passed"
+	StepFailed  StepStatus = "failed"
+	StepSkipped StepStatus = "skipped"
+	// StepNotRun is a step outside the selected range, or after a failure.
+	StepNotRun StepStatus = "not run"
+)
+
+type StepResult struct {
+	Index  int
+	Id     string
+	Title  string
+	Status StepStatus
+	// Duration covers every attempt, and Attempts counts them; it is 0 for
+	// steps that did not run.
+	Duration time.Duration
+	Attempts int
+	Err      error
+}
+
+type ReportStatus string
+
+const (
+	ReportUploaded ReportStatus = "uploaded"
+	ReportFailed   ReportStatus = "failed"
+	// ReportDisabled is a run with ENVIRONMENT=BUILDING.
+	ReportDisabled ReportStatus = "disabled"
+	// ReportSkipped is a partial run, or one that stopped before the first step.
+	ReportSkipped ReportStatus = "skipped"
+)
+
+// ErrorKind says who a run's error is for: the learner, the tutorial author or
+// whoever runs the harness.
+type ErrorKind int
+
+const (
+	NoError ErrorKind = iota
+	// TestFailure is a failing step or a build error in the user's project.
+	TestFailure
+	// HarnessError means the steps could not be run, e.g. a missing toolchain
+	// or invalid flags.
+	HarnessError
+	// ReportingError is a failed login or report upload.
+	ReportingError
+	// HookError is a failing or panicking hook; see Hooks.
+	HookError
+)
+
+// Exit codes for ErrorKind, used by ExitCode.
+const (
+	ExitPassed         = 0
+	ExitTestFailure    = 1
+	ExitHarnessError   = 2
+	ExitReportingError = 3
+)
+
+// RunResult is the outcome of a run.
+type RunResult struct {
+	Steps []StepResult
+	// CompletedStage is the index of the last step that passed in order, as
+	// reported to Supabase.
+	CompletedStage int
+	Duration       time.Duration
+	// Seed is the run's random seed; see Session.Seed.
+	Seed      int64
+	Report    ReportStatus
+	ReportErr error
+	// Err is the error that ended the run, and Kind classifies it.
+	Err  error
+	Kind ErrorKind
+	// HookErrs are every hook failure, including those after the run ended.
+	HookErrs []error
+}
+
+func (r *RunResult) Passed() bool {
+	return r.Kind == NoError
+}
+
+func (r *RunResult) ExitCode() int {
+	switch r.Kind {
+	case TestFailure:
+		return ExitTestFailure
+	case HarnessError, HookError:
+		return ExitHarnessError
+	case ReportingError:
+		return ExitReportingError
+	}
+	return ExitPassed
+}
+
+// Count returns how many steps ended with status.
+func (r *RunResult) Count(status StepStatus) int {
+	count := 0
+	for _, step := range r.Steps {
+		if step.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// retried counts the steps that ran more than once.
+func (r *RunResult) retried() int {
+	count := 0
+	for _, step := range r.Steps {
+		if step.Attempts > 1 {
+			count++
+		}
+	}
+	return count
+}
+
+// Summary describes the result in one line, e.g. "3/4 steps passed, step
+// "write-file" failed".
+func (r *RunResult) Summary() string {
+	ran := r.Count(StepPassed) + r.Count(StepFailed)
+	summary := fmt.Sprintf("%d/%d steps passed", r.Count(StepPassed), ran)
+	if skipped := r.Count(StepSkipped); skipped > 0 {
+		summary += fmt.Sprintf(", %d skipped", skipped)
+	}
+	if retried := r.retried(); retried > 0 {
+		summary += fmt.Sprintf(", %d retried", retried)
+	}
+	for _, step := range r.Steps {
+		if step.Status == StepFailed {
+			return summary + fmt.Sprintf(", step %q failed", step.Id)
+		}
+	}
+	switch r.Kind {
+	case TestFailure, HarnessError, HookError:
+		return summary + ": " + r.Err.Error()
+	case ReportingError:
+		if r.ReportErr != nil {
+			return summary + ", but the results could not be uploaded: " + r.ReportErr.Error()
+		}
+		return summary + ": " + r.Err.Error()
+	}
+	return summary
+}
+
+// reportKey identifies what a report of the result shows the learner.
+func (r *RunResult) reportKey() string {
+	key := fmt.Sprint(r.CompletedStage)
+	for _, step := range r.Steps {
+		key += fmt.Sprintf(" %s:%s", step.Id, step.Status)
+	}
+	return key
+}
+
+// fail ends the result with err unless an earlier error already did.
+func (r *RunResult) fail(kind ErrorKind, err error) *RunResult {
+	if r.Kind == NoError {
+		r.Kind, r.Err = kind, err
+	}
+	return r
+}
+
+func (r *RunResult) hookFailed(err error) {
+	r.HookErrs = append(r.HookErrs, err)
+	r.fail(HookError, err)
+}
+
+// reportExtras adds the run's seed to a report's extras, as {"seed": n}, and
+// how many times each retried step was rerun, as {"retries": {"<step id>": n}}.
+func reportExtras(extras map[string]any, result *RunResult) map[string]any {
+	extras = maps.Clone(extras)
+	if extras == nil {
+		extras = map[string]any{}
+	}
+	extras["seed"] = result.Seed
+	retries := map[string]int{}
+	for _, step := range result.Steps {
+		if step.Attempts > 1 {
+			retries[step.Id] = step.Attempts - 1
+		}
+	}
+	if len(retries) > 0 {
+		extras["retries"] = retries
+	}
+	return extras
+}
@@ -0,0 +1,128 @@
+package runner
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/buildium-org/buildium_harness/meta"
+)
+
+func statuses(result *RunResult) []StepStatus {
+	var got []StepStatus
+	for _, step := range result.Steps {
+		got = append(got, step.Status)
+	}
+	return got
+}
+
+func TestExecuteResults(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+
+	pass := func(config string) error { return nil }
+	fail := func(config string) error { return errors.New("wrong output") }
+	cases := []struct {
+		name     string
+		meta     *meta.Meta
+		steps    []Step[string]
+		skip     []string
+		options  Options
+		statuses []StepStatus
+		stage    int
+		kind     ErrorKind
+		exitCode int
+		summary  string
+	}{
+		{
+			name:     "passes",
+			meta:     testMeta(2),
+			steps:    Steps(pass, pass, pass, pass),
+			skip:     []string{"step-1"},
+			statuses: []StepStatus{StepPassed, StepSkipped, StepPassed, StepNotRun},
+			stage:    2,
+			summary:  "2/2 steps passed, 1 skipped",
+		},
+		{
+			name:     "step fails",
+			meta:     testMeta(2),
+			steps:    Steps(pass, fail, pass),
+			statuses: []StepStatus{StepPassed, StepFailed, StepNotRun},
+			stage:    0,
+			kind:     TestFailure,
+			exitCode: ExitTestFailure,
+			summary:  `1/2 steps passed, step "step-1" failed`,
+		},
+		{
+			name:     "unknown step",
+			meta:     testMeta(2),
+			steps:    Steps(pass),
+			options:  Options{Step: "missing"},
+			statuses: []StepStatus{StepNotRun},
+			stage:    -1,
+			kind:     HarnessError,
+			exitCode: ExitHarnessError,
+			summary:  `0/0 steps passed: unknown step "missing"; run with -list to see the steps`,
+		},
+		{
+			name:     "build fails",
+			meta:     &meta.Meta{Stage: 0, ExecutableDir: "/", Build: &meta.BuildConfig{Command: "exit 1"}},
+			steps:    Steps(pass),
+			statuses: []StepStatus{StepNotRun},
+			stage:    -1,
+			kind:     TestFailure,
+			exitCode: ExitTestFailure,
+			summary:  "0/0 steps passed: build failed: exit status 1",
+		},
+	}
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			var calls []string
+			runner := New(test.meta, &fakeEnvironment{name: "env", calls: &calls}, test.steps, test.skip)
+			runner.SetOptions(test.options)
+			result := runner.Execute(newTestContext())
+			if got := statuses(result); !reflect.DeepEqual(got, test.statuses) {
+				t.Errorf("statuses = %v, want %v", got, test.statuses)
+			}
+			if result.CompletedStage != test.stage || result.Kind != test.kind || result.ExitCode() != test.exitCode {
+				t.Errorf("result = %+v, want stage %d, kind %d, exit code %d", result, test.stage, test.kind, test.exitCode)
+			}
+			if result.Summary() != test.summary {
+				t.Errorf("Summary() = %q, want %q", result.Summary(), test.summary)
+			}
+			if test.kind != NoError && result.Err == nil {
+				t.Error("Err is nil for a failed run")
+			}
+		})
+	}
+}
+
+func TestExecuteReportStatus(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+	var calls []string
+	steps := Steps(func(config string) error { return nil })
+	result := New(testMeta(0), &fakeEnvironment{name: "env", calls: &calls}, steps, nil).Execute(newTestContext())
+	if result.Report != ReportDisabled || result.Steps[0].Duration <= 0 || result.Duration < result.Steps[0].Duration {
+		t.Errorf("result = %+v, want a disabled report and durations", result)
+	}
+
+	// Without ENVIRONMENT=BUILDING the harness has to log in
+	t.Setenv("ENVIRONMENT", "")
+	t.Setenv("BUILDIUM_EMAIL", "")
+	result = New(testMeta(0), &fakeEnvironment{name: "env", calls: &calls}, steps, nil).Execute(newTestContext())
+	if result.Kind != ReportingError || result.ExitCode() != ExitReportingError || result.Steps[0].Status != StepNotRun {
+		t.Errorf("result = %+v, want a login failure before any step", result)
+	}
+}
+
+func TestReportingErrorSummary(t *testing.T) {
+	result := &RunResult{Steps: []StepResult{{Id: "a", Status: StepPassed}}}
+	result.Report, result.ReportErr = ReportFailed, errors.New("server responded 500 Internal Server Error")
+	result.fail(ReportingError, errors.New("failed to upload results"))
+	result.fail(TestFailure, errors.New("ignored"))
+	if result.ExitCode() != ExitReportingError {
+		t.Errorf("ExitCode() = %d, want the first error to win", result.ExitCode())
+	}
+	if want := "1/1 steps passed, but the results could not be uploaded: server responded 500 Internal Server Error"; result.Summary() != want {
+		t.Errorf("Summary() = %q, want %q", result.Summary(), want)
+	}
+}
@@ -0,0 +1,65 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Retry reruns a step that fails for reasons unrelated to the learner's code,
+// such as a slow network. Every attempt's logs are kept, tagged with the
+// attempt number.
+type Retry struct {
+	// Attempts is the most times the step runs. 0 and 1 both run it once.
+	Attempts int
+	// Backoff is the wait before the second attempt, doubling before each
+	// later one.
+	Backoff time.Duration
+	// If reports whether a failure is worth retrying. nil retries any failure.
+	If func(err error) bool
+}
+
+// RetryOn returns a Retry.If that retries errors matching one of targets, as
+// reported by errors.Is.
+func RetryOn(targets ...error) func(err error) bool {
+	return func(err error) bool {
+		for _, target := range targets {
+			if errors.Is(err, target) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (r Retry) attempts() int {
+	return max(r.Attempts, 1)
+}
+
+// runAttempts runs step until it passes, a failure is not worth retrying or
+// the attempts run out. It returns how many attempts ran and the last error.
+func (r *Runner[C]) runAttempts(ctx context.Context, s *Session, step Step[C], stepTimeout time.Duration) (int, error) {
+	attempts := step.Retry.attempts()
+	backoff := step.Retry.Backoff
+	for attempt := 1; ; attempt++ {
+		if attempts > 1 {
+			s.Logger.SetAttempt(attempt)
+		}
+		err := r.runStep(ctx, s, step, stepTimeout)
+		if err == nil || attempt == attempts || ctx.Err() != nil || (step.Retry.If != nil && !step.Retry.If(err)) {
+			return attempt, err
+		}
+		if backoff == 0 {
+			s.Logger.LogWarning(fmt.Sprintf("Attempt %d/%d failed: %v; retrying", attempt, attempts, err))
+			continue
+		}
+		s.Logger.LogWarning(fmt.Sprintf("Attempt %d/%d failed: %v; retrying in %v", attempt, attempts, err, backoff))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return attempt, context.Cause(ctx)
+		}
+		backoff *= 2
+	}
+}
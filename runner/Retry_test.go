@@ -0,0 +1,199 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/buildium-org/buildium_harness/logger"
+)
+
+var errFlaky = errors.New("connection reset")
+
+// flakyStep fails with err until it has run failures times.
+func flakyStep(failures int, err error) (func(config string) error, *int) {
+	runs := 0
+	return func(config string) error {
+		runs++
+		if runs <= failures {
+			return err
+		}
+		return nil
+	}, &runs
+}
+
+func TestRetry(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+
+	cases := []struct {
+		name     string
+		failures int
+		err      error
+		retry    Retry
+		runs     int
+		status   StepStatus
+		messages []string
+	}{
+		{
+			name:     "passes on a retry",
+			failures: 2, err: errFlaky,
+			retry:    Retry{Attempts: 3, Backoff: time.Millisecond},
+			runs:     3,
+			status:   StepPassed,
+			messages: []string{"Attempt 1/3 failed: connection reset; retrying in 1ms", "Attempt 2/3 failed: connection reset; retrying in 2ms", "Test passed on attempt 3/3"},
+		},
+		{
+			name:     "runs out of attempts",
+			failures: 5, err: errFlaky,
+			retry:    Retry{Attempts: 2},
+			runs:     2,
+			status:   StepFailed,
+			messages: []string{"Attempt 1/2 failed: connection reset; retrying", "Test failed after 2 attempts"},
+		},
+		{
+			name:     "only retries matching errors",
+			failures: 1, err: errors.New("wrong output"),
+			retry:    Retry{Attempts: 3, If: RetryOn(errFlaky)},
+			runs:     1,
+			status:   StepFailed,
+			messages: []string{"Test failed"},
+		},
+		{
+			name:     "no retry",
+			failures: 1, err: errFlaky,
+			runs:     1,
+			status:   StepFailed,
+			messages: []string{"Test failed"},
+		},
+	}
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			run, runs := flakyStep(test.failures, test.err)
+			steps := []Step[string]{{Id: "fetch", Run: run, Retry: test.retry}}
+			var calls []string
+			before := len(logger.GetAllLogs())
+			result := New(testMeta(0), &fakeEnvironment{name: "env", calls: &calls}, steps, nil).Execute(newTestContext())
+			if *runs != test.runs || result.Steps[0].Attempts != test.runs || result.Steps[0].Status != test.status {
+				t.Errorf("ran %d times, result %+v, want %d runs and status %q", *runs, result.Steps[0], test.runs, test.status)
+			}
+			var messages []string
+			for _, log := range logger.GetAllLogs()[before:] {
+				if log.Type != "INFO" {
+					messages = append(messages, log.Message)
+				}
+				if test.runs > 1 && log.Attempt == 0 {
+					t.Errorf("log %q has no attempt", log.Message)
+				}
+			}
+			if !reflect.DeepEqual(messages, test.messages) {
+				t.Errorf("messages = %q, want %q", messages, test.messages)
+			}
+		})
+	}
+}
+
+func TestRetryOnTimeout(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+
+	var runs atomic.Int32
+	steps := []Step[string]{{
+		Id:      "slow",
+		Timeout: 20 * time.Millisecond,
+		Retry:   Retry{Attempts: 2, If: RetryOn(context.DeadlineExceeded)},
+		RunContext: func(ctx context.Context, config string) error {
+			if runs.Add(1) == 1 {
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			return nil
+		},
+	}}
+	var calls []string
+	result := New(testMeta(0), &fakeEnvironment{name: "env", calls: &calls}, steps, nil).Execute(newTestContext())
+	if result.Err != nil || result.Steps[0].Attempts != 2 {
+		t.Errorf("result = %+v, want the timed out attempt retried", result.Steps[0])
+	}
+
+	steps[0].Retry = Retry{}
+	runs.Store(0)
+	err := New(testMeta(0), &fakeEnvironment{name: "env", calls: &calls}, steps, nil).Run(newTestContext())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run() error = %v, want it to match context.DeadlineExceeded", err)
+	}
+}
+
+func TestRetryAfterTimeoutSharesNothingWithTheAbandonedAttempt(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+
+	stop := make(chan struct{})
+	defer close(stop)
+	draws := make(chan int64, 2)
+	var runs atomic.Int32
+	steps := []Step[*Session]{{
+		Id:      "flaky",
+		Timeout: 20 * time.Millisecond,
+		Retry:   Retry{Attempts: 2},
+		Run: func(s *Session) error {
+			draws <- s.Rand.Int64()
+			if runs.Add(1) > 1 {
+				// Give the first attempt time to log during this one
+				time.Sleep(10 * time.Millisecond)
+				return nil
+			}
+			// The first attempt ignores its context and keeps going
+			for {
+				select {
+				case <-stop:
+					return nil
+				case <-time.After(time.Millisecond):
+					s.Rand.Int64()
+					s.Logger.LogInfo("first attempt still running")
+				}
+			}
+		},
+	}}
+	var calls []string
+	before := len(logger.GetAllLogs())
+	result := New[*Session](testMeta(0), &sessionEnvironment{fakeEnvironment{name: "env", calls: &calls}}, steps, nil).Execute(newTestContext())
+	if result.Err != nil || result.Steps[0].Attempts != 2 {
+		t.Fatalf("result = %+v, want the second attempt to pass", result.Steps[0])
+	}
+	if first, second := <-draws, <-draws; first != second {
+		t.Errorf("attempts drew %d and %d, want each to start from a fresh Rand", first, second)
+	}
+	for _, log := range logger.GetAllLogs()[before:] {
+		if log.Message == "first attempt still running" && log.Attempt != 1 {
+			t.Errorf("log = %+v, want it tagged with the first attempt", log)
+		}
+	}
+}
+
+func TestReportExtras(t *testing.T) {
+	result := &RunResult{Seed: 42, Steps: []StepResult{{Id: "a", Attempts: 1}, {Id: "b", Attempts: 3}, {Id: "c"}}}
+	env := map[string]any{"har": "..."}
+	extras := reportExtras(env, result)
+	want := map[string]any{"har": "...", "seed": int64(42), "retries": map[string]int{"b": 2}}
+	if !reflect.DeepEqual(extras, want) {
+		t.Errorf("reportExtras() = %v, want %v", extras, want)
+	}
+	if len(env) != 1 {
+		t.Errorf("reportExtras() changed the environment's extras: %v", env)
+	}
+	got := reportExtras(nil, &RunResult{Seed: 7, Steps: []StepResult{{Id: "a", Attempts: 1}}})
+	if !reflect.DeepEqual(got, map[string]any{"seed": int64(7)}) {
+		t.Errorf("reportExtras() = %v, want only the seed without retries", got)
+	}
+	if summary := result.Summary(); summary != "0/0 steps passed, 1 retried" {
+		t.Errorf("Summary() = %q", summary)
+	}
+}
+
+func TestValidateRetry(t *testing.T) {
+	steps := []Step[string]{{Id: "a", Run: func(config string) error { return nil }, Retry: Retry{Attempts: -1}}}
+	if err := validateSteps(steps, nil); err == nil {
+		t.Error("validateSteps() accepted negative attempts")
+	}
+}
@@ -0,0 +1,303 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/buildium-org/buildium_harness/build"
+	"github.com/buildium-org/buildium_harness/diagnostics"
+	"github.com/buildium-org/buildium_harness/logger"
+	"github.com/buildium-org/buildium_harness/meta"
+	"github.com/buildium-org/buildium_harness/process"
+	"github.com/buildium-org/buildium_harness/supabase"
+	"github.com/buildium-org/buildium_harness/toolchain"
+)
+
+// Session is the state shared by the runner and its environment for one run.
+type Session struct {
+	Meta   *meta.Meta
+	Logger *logger.Logger
+	// Setup is how the user's program is built and launched.
+	Setup *toolchain.Setup
+	// Step is the index of the step being run, and StepId and StepTitle describe it.
+	Step      int
+	StepId    string
+	StepTitle string
+	// Seed seeds the run's randomness, and replays it with -seed. Rand is
+	// seeded from it and the step's Id, afresh for every attempt, so that a
+	// step always gets the same inputs for a seed.
+	Seed int64
+	Rand *rand.Rand
+}
+
+// Environment is what a kind of step runs in, such as a CLI or a server. It
+// builds the config each step receives.
+type Environment[C any] interface {
+	// Setup runs once after the project is built. An error stops the run
+	// before the first step.
+	Setup(ctx context.Context, s *Session) error
+	// RunStep runs step with a config built for it.
+	RunStep(ctx context.Context, s *Session, step func(config C) error) error
+	// Extras returns data uploaded with the run's logs, or nil.
+	Extras(ctx context.Context, s *Session) map[string]any
+	// Teardown releases what Setup acquired.
+	Teardown(s *Session)
+}
+
+type Runner[C any] struct {
+	meta  *meta.Meta
+	env   Environment[C]
+	steps []Step[C]
+	// skipSteps are the Ids of steps that are logged as skipped instead of run.
+	skipSteps []string
+	// indexSkips is set when skipSteps came from indexes, so unknown ones only warn.
+	indexSkips  bool
+	stepTimeout time.Duration
+	timeout     time.Duration
+	options     Options
+	hooks       Hooks
+	// lastReport identifies the last uploaded result, so that watch mode only
+	// uploads changes.
+	lastReport string
+}
+
+func New[C any](meta *meta.Meta, env Environment[C], steps []Step[C], skipSteps []string) *Runner[C] {
+	return &Runner[C]{meta: meta, env: env, steps: steps, skipSteps: skipSteps, stepTimeout: DefaultStepTimeout}
+}
+
+// SetIndexSkips marks the skipped Ids as converted from indexes by IndexIds,
+// as older tutorials skip steps. Indexes that name no step are then logged as
+// warnings and ignored, instead of stopping the run.
+func (r *Runner[C]) SetIndexSkips(indexSkips bool) {
+	r.indexSkips = indexSkips
+}
+
+// SetStepTimeout sets how long each step may run, unless the step sets its own
+// Timeout. 0 means no limit. STEP_TIMEOUT, in milliseconds, overrides it.
+func (r *Runner[C]) SetStepTimeout(timeout time.Duration) {
+	r.stepTimeout = timeout
+}
+
+// SetTimeout limits the whole run, including the build. 0, the default, means
+// no limit. RUN_TIMEOUT, in milliseconds, overrides it.
+func (r *Runner[C]) SetTimeout(timeout time.Duration) {
+	r.timeout = timeout
+}
+
+// Run builds the project, then runs the steps up to the user's stage in order,
+// stopping at the first failure. It returns the error that ended the run.
+func (r *Runner[C]) Run(ctx context.Context) error {
+	return r.Execute(ctx).Err
+}
+
+// Execute is Run returning the full result. Progress is reported to Supabase
+// unless the run stops before the first step or only runs some steps.
+func (r *Runner[C]) Execute(ctx context.Context) *RunResult {
+	start := time.Now()
+	result := r.execute(ctx)
+	result.Duration = time.Since(start)
+	return result
+}
+
+func (r *Runner[C]) execute(ctx context.Context) *RunResult {
+	l := ctx.Value("logger").(*logger.Logger)
+	result := &RunResult{CompletedStage: -1, Report: ReportSkipped}
+	for i, step := range r.steps {
+		result.Steps = append(result.Steps, StepResult{Index: i, Id: step.Id, Title: step.Title, Status: StepNotRun})
+	}
+	harnessError := func(err error) *RunResult {
+		l.LogError(err.Error())
+		return result.fail(HarnessError, err)
+	}
+	skipSteps := r.skipSteps
+	if r.indexSkips {
+		skipSteps = knownSkips(l, r.steps, skipSteps)
+	}
+	if err := validateSteps(r.steps, skipSteps); err != nil {
+		return harnessError(err)
+	}
+	stepTimeout, err := timeoutFromEnv("STEP_TIMEOUT", r.stepTimeout)
+	if err != nil {
+		return harnessError(err)
+	}
+	timeout, err := timeoutFromEnv("RUN_TIMEOUT", r.timeout)
+	if err != nil {
+		return harnessError(err)
+	}
+	first, last, err := r.stepRange()
+	if err != nil {
+		return harnessError(err)
+	}
+	seed, err := seedFromEnv(r.options.Seed)
+	if err != nil {
+		return harnessError(err)
+	}
+	result.Seed = seed
+	l.LogHeader(fmt.Sprintf("Random seed: %d (rerun with -seed %d to replay it)", seed, seed))
+	l.LogDebug(fmt.Sprintf("Running steps %d to %d of %d (stage %d), step timeout %v, run timeout %v",
+		first, last, len(r.steps), r.meta.Stage, stepTimeout, timeout))
+	// Partial runs would misreport the user's progress
+	reporting := !r.options.Partial()
+	supaClient := supabase.NewSupaClient(ctx)
+	if reporting {
+		if err := supaClient.Login(ctx); err != nil {
+			l.LogError(fmt.Sprintf("failed to login: %v", err))
+			return result.fail(ReportingError, fmt.Errorf("failed to login: %v", err))
+		}
+	}
+	ctx = context.WithValue(ctx, "supaClient", supaClient)
+	report := func(stage int, extras map[string]any) {
+		result.CompletedStage = stage
+		if !reporting {
+			l.LogInfo("Only some steps ran, so this run was not reported")
+			return
+		}
+		key := result.reportKey()
+		if r.options.Watch && key == r.lastReport {
+			l.LogInfo("The result has not changed, so it was not uploaded again")
+			return
+		}
+		resp, err := supaClient.AddProjectRunWithExtras(ctx, r.meta.ProjectId, stage, logger.GetAllLogs(), reportExtras(extras, result))
+		switch {
+		case err == nil && resp == nil:
+			result.Report, r.lastReport = ReportDisabled, key
+			return
+		case err == nil:
+			resp.Body.Close()
+			if resp.StatusCode < 300 {
+				result.Report, r.lastReport = ReportUploaded, key
+				return
+			}
+			err = fmt.Errorf("server responded %s", resp.Status)
+		}
+		result.Report, result.ReportErr = ReportFailed, err
+		l.LogError(fmt.Sprintf("failed to upload results: %v", err))
+		result.fail(ReportingError, fmt.Errorf("failed to upload results: %v", err))
+	}
+	// Reports use ctx, so they are still sent after runCtx times out
+	runCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeoutCause(ctx, timeout, fmt.Errorf("run timed out after %v: %w", timeout, context.DeadlineExceeded))
+		defer cancel()
+	}
+	setup, err := toolchain.Resolve(r.meta)
+	if err != nil {
+		return harnessError(err)
+	}
+	l.LogDebug(fmt.Sprintf("Launching %s", setup.Command))
+	s := &Session{Meta: r.meta, Logger: l, Setup: setup, Seed: seed, Rand: stepRand(seed, "")}
+	if setup.Build != nil {
+		if buildResult := runBuild(runCtx, s); buildResult.Err != nil {
+			result.fail(TestFailure, buildResult.Err)
+			// No stage passed; the "build" extras say the build is what failed
+			report(-1, buildResult.Extras())
+			return result
+		}
+	}
+	if err := r.env.Setup(runCtx, s); err != nil {
+		return result.fail(HarnessError, err)
+	}
+	defer r.env.Teardown(s)
+	if r.meta.SourceDir != "" && !setup.Interpreted() {
+		diagnostics.Inspect(setup.Executable, r.meta.SourceDir).LogWarnings(l)
+	}
+	failOnOrphans, err := process.FailOnOrphans()
+	if err != nil {
+		return harnessError(err)
+	}
+	// Without a subreaper (non-linux) orphan detection is skipped
+	tracker, _ := process.NewTracker()
+	completedStage := first - 1
+	if err := r.hooks.beforeAll(runCtx, s); err != nil {
+		result.hookFailed(err)
+	}
+	for i := first; i <= last && result.Passed(); i++ {
+		step := r.steps[i]
+		s.Step, s.StepId, s.StepTitle = i, step.Id, step.Title
+		l.SetStep(i)
+		l.SetStepId(step.Id)
+		stepStart := time.Now()
+		var err error
+		attempts := 0
+		skipped := slices.Contains(r.skipSteps, step.Id)
+		if skipped {
+			err = skipStep(l)
+		} else {
+			if step.Title != "" {
+				l.LogTitle(step.Title)
+			}
+			if step.Description != "" {
+				l.LogInfo(step.Description)
+			}
+			if hookErr := r.hooks.beforeEach(runCtx, s); hookErr != nil {
+				result.hookFailed(hookErr)
+			} else {
+				attempts, err = r.runAttempts(runCtx, s, step, stepTimeout)
+			}
+		}
+		// Environments stop what they started, so anything left escaped them
+		if orphanErr := tracker.Check(l, failOnOrphans); err == nil {
+			err = orphanErr
+		}
+		stepResult := &result.Steps[i]
+		stepResult.Duration, stepResult.Err, stepResult.Attempts = time.Since(stepStart), err, attempts
+		switch {
+		case !result.Passed():
+			// BeforeEach failed, so the step did not run
+		case err != nil:
+			stepResult.Status = StepFailed
+			if attempts > 1 {
+				l.LogError(fmt.Sprintf("Test failed after %d attempts", attempts))
+			} else {
+				l.LogError("Test failed")
+			}
+			for _, hint := range step.Hints {
+				l.LogInfo("Hint: " + hint)
+			}
+			result.fail(TestFailure, err)
+		default:
+			stepResult.Status = StepPassed
+			if skipped {
+				stepResult.Status = StepSkipped
+			}
+			if attempts > 1 {
+				l.LogSuccess(fmt.Sprintf("Test passed on attempt %d/%d", attempts, step.Retry.attempts()))
+			} else {
+				l.LogSuccess("Test passed")
+			}
+			completedStage++
+		}
+		if !skipped {
+			if hookErr := r.hooks.afterEach(ctx, s, *stepResult); hookErr != nil {
+				result.hookFailed(hookErr)
+			}
+		}
+		if result.Passed() {
+			l.NextStep()
+		}
+	}
+	if err := r.hooks.afterAll(ctx, s, result); err != nil {
+		result.hookFailed(err)
+	}
+	report(completedStage, r.env.Extras(ctx, s))
+	return result
+}
+
+// runBuild compiles the project under its own log stage, before the first step.
+func runBuild(ctx context.Context, s *Session) *build.Result {
+	s.Logger.SetStep(build.LogStage)
+	defer s.Logger.SetStep(0)
+	result := build.Run(ctx, s.Setup.Build.Command, s.Setup.BuildDir)
+	result.Log(s.Logger)
+	return result
+}
+
+func skipStep(l *logger.Logger) error {
+	l.LogTitle("Skipping Step")
+	l.LogInfo("Skipping step")
+	return nil
+}
@@ -0,0 +1,206 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/buildium-org/buildium_harness/logger"
+	"github.com/buildium-org/buildium_harness/meta"
+)
+
+func newTestContext() context.Context {
+	return context.WithValue(context.Background(), "logger", logger.NewLogger())
+}
+
+// fakeEnvironment records what the runner asks of it and passes steps its name.
+type fakeEnvironment struct {
+	name     string
+	calls    *[]string
+	setupErr error
+	extras   map[string]any
+}
+
+func (f *fakeEnvironment) Setup(ctx context.Context, s *Session) error {
+	*f.calls = append(*f.calls, f.name+".setup")
+	return f.setupErr
+}
+
+func (f *fakeEnvironment) RunStep(ctx context.Context, s *Session, step func(config string) error) error {
+	*f.calls = append(*f.calls, f.name+".step")
+	return step(f.name)
+}
+
+func (f *fakeEnvironment) Extras(ctx context.Context, s *Session) map[string]any {
+	return f.extras
+}
+
+func (f *fakeEnvironment) Teardown(s *Session) {
+	*f.calls = append(*f.calls, f.name+".teardown")
+}
+
+func testMeta(stage int) *meta.Meta {
+	return &meta.Meta{Stage: stage, Entrypoint: "app", ExecutableDir: "/test/path", ProjectId: "test-project-123"}
+}
+
+func TestRunSteps(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+
+	var calls []string
+	var ran []int
+	env := &fakeEnvironment{name: "env", calls: &calls}
+	var steps []func(config string) error
+	for i := range 4 {
+		steps = append(steps, func(config string) error {
+			ran = append(ran, i)
+			return nil
+		})
+	}
+
+	if err := New(testMeta(2), env, Steps(steps...), IndexIds([]int{1})).Run(newTestContext()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !reflect.DeepEqual(ran, []int{0, 2}) {
+		t.Errorf("ran steps %v, want 0 and 2 with 1 skipped and 3 past the stage", ran)
+	}
+	want := []string{"env.setup", "env.step", "env.step", "env.teardown"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestRunIndexSkipsPastTheLastStep(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+
+	var calls []string
+	steps := Steps(func(config string) error { return nil }, func(config string) error { return nil })
+	if err := New(testMeta(1), &fakeEnvironment{name: "env", calls: &calls}, steps, IndexIds([]int{5})).Run(newTestContext()); err == nil {
+		t.Error("Run() error = nil, want unknown skipped Ids rejected")
+	}
+
+	before := len(logger.GetAllLogs())
+	runner := New(testMeta(1), &fakeEnvironment{name: "env", calls: &calls}, steps, IndexIds([]int{1, 5}))
+	runner.SetIndexSkips(true)
+	result := runner.Execute(newTestContext())
+	if result.Err != nil {
+		t.Fatalf("Run() error = %v, want the unknown index ignored", result.Err)
+	}
+	if got := statuses(result); !reflect.DeepEqual(got, []StepStatus{StepPassed, StepSkipped}) {
+		t.Errorf("statuses = %v, want step 1 still skipped", got)
+	}
+	warned := false
+	for _, log := range logger.GetAllLogs()[before:] {
+		warned = warned || (log.Type == "WARNING" && strings.Contains(log.Message, `"step-5"`))
+	}
+	if !warned {
+		t.Error("no warning about skipping step-5")
+	}
+}
+
+func TestRunStopsAtFailure(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+
+	var calls []string
+	env := &fakeEnvironment{name: "env", calls: &calls}
+	stepErr := errors.New("wrong output")
+	steps := []func(config string) error{
+		func(config string) error { return nil },
+		func(config string) error { return stepErr },
+		func(config string) error { t.Error("step 2 ran after a failure"); return nil },
+	}
+
+	before := len(logger.GetAllLogs())
+	if err := New(testMeta(2), env, Steps(steps...), nil).Run(newTestContext()); err != stepErr {
+		t.Fatalf("Run() error = %v, want %v", err, stepErr)
+	}
+	logs := logger.GetAllLogs()[before:]
+	if last := logs[len(logs)-1]; last.Message != "Test failed" || last.Stage != 1 {
+		t.Errorf("last log = %+v, want step 1 to fail", last)
+	}
+	if calls[len(calls)-1] != "env.teardown" {
+		t.Errorf("calls = %v, want the environment torn down", calls)
+	}
+}
+
+func TestRunSetupFails(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+
+	var calls []string
+	env := &fakeEnvironment{name: "env", calls: &calls, setupErr: errors.New("port in use")}
+	steps := []func(config string) error{
+		func(config string) error { t.Error("step ran after setup failed"); return nil },
+	}
+	if err := New(testMeta(0), env, Steps(steps...), nil).Run(newTestContext()); err == nil || err.Error() != "port in use" {
+		t.Errorf("Run() error = %v, want the setup error", err)
+	}
+	if !reflect.DeepEqual(calls, []string{"env.setup"}) {
+		t.Errorf("calls = %v, want only setup", calls)
+	}
+}
+
+func TestRunBuildFails(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+
+	var calls []string
+	m := testMeta(0)
+	m.ExecutableDir = t.TempDir()
+	m.Build = &meta.BuildConfig{Command: "exit 1"}
+	err := New[string](m, &fakeEnvironment{name: "env", calls: &calls}, nil, nil).Run(newTestContext())
+	if err == nil || !strings.Contains(err.Error(), "build failed") {
+		t.Errorf("Run() error = %v, want the build failure", err)
+	}
+	if len(calls) != 0 {
+		t.Errorf("calls = %v, want the environment untouched", calls)
+	}
+}
+
+func TestCombine(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+
+	var calls []string
+	outer := &fakeEnvironment{name: "server", calls: &calls, extras: map[string]any{"har": 1, "shared": "server"}}
+	inner := &fakeEnvironment{name: "cli", calls: &calls, extras: map[string]any{"shared": "cli"}}
+	env := Combine[string, string, string](outer, inner, func(a, b string) string { return a + "+" + b })
+
+	var config string
+	steps := []func(config string) error{
+		func(c string) error { config = c; return nil },
+	}
+	if err := New(testMeta(0), env, Steps(steps...), nil).Run(newTestContext()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if config != "server+cli" {
+		t.Errorf("config = %q, want server+cli", config)
+	}
+	want := []string{"server.setup", "cli.setup", "server.step", "cli.step", "cli.teardown", "server.teardown"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+	extras := env.Extras(context.Background(), nil)
+	if !reflect.DeepEqual(extras, map[string]any{"har": 1, "shared": "cli"}) {
+		t.Errorf("Extras() = %v", extras)
+	}
+
+	calls = nil
+	inner.setupErr = errors.New("no toolchain")
+	if err := env.Setup(context.Background(), nil); err == nil {
+		t.Fatal("Setup() should fail when inner fails")
+	}
+	if !reflect.DeepEqual(calls, []string{"server.setup", "cli.setup", "server.teardown"}) {
+		t.Errorf("calls = %v, want outer torn down after inner failed", calls)
+	}
+}
+
+func TestAdapt(t *testing.T) {
+	var calls []string
+	env := Adapt[string, int](&fakeEnvironment{name: "env", calls: &calls}, func(config string) int { return len(config) })
+	var got int
+	if err := env.RunStep(context.Background(), nil, func(config int) error { got = config; return nil }); err != nil {
+		t.Fatalf("RunStep() error = %v", err)
+	}
+	if got != 3 {
+		t.Errorf("config = %d, want len(\"env\")", got)
+	}
+}
@@ -0,0 +1,36 @@
+package runner
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"os"
+	"strconv"
+)
+
+// seedFromEnv returns seed if set, then BUILDIUM_SEED, and otherwise a new
+// random seed. Seeds are never 0, so 0 means unset.
+func seedFromEnv(seed int64) (int64, error) {
+	if seed != 0 {
+		return seed, nil
+	}
+	if value := os.Getenv("BUILDIUM_SEED"); value != "" {
+		seed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || seed == 0 {
+			return 0, fmt.Errorf("invalid BUILDIUM_SEED %q: expected a non-zero integer", value)
+		}
+		return seed, nil
+	}
+	for seed == 0 {
+		seed = rand.Int64()
+	}
+	return seed, nil
+}
+
+// stepRand returns the random source for the step with id in a run with seed.
+// Mixing in the Id gives a step the same inputs whichever steps run with it.
+func stepRand(seed int64, id string) *rand.Rand {
+	hash := fnv.New64a()
+	hash.Write([]byte(id))
+	return rand.New(rand.NewPCG(uint64(seed), hash.Sum64()))
+}
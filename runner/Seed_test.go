@@ -0,0 +1,102 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSeedFromEnv(t *testing.T) {
+	t.Setenv("BUILDIUM_SEED", "")
+	if seed, err := seedFromEnv(0); err != nil || seed == 0 {
+		t.Errorf("seedFromEnv(0) = %d, %v, want a new non-zero seed", seed, err)
+	}
+
+	t.Setenv("BUILDIUM_SEED", "1234")
+	if seed, _ := seedFromEnv(0); seed != 1234 {
+		t.Errorf("seedFromEnv(0) = %d, want BUILDIUM_SEED", seed)
+	}
+	if seed, _ := seedFromEnv(99); seed != 99 {
+		t.Errorf("seedFromEnv(99) = %d, want the flag to win", seed)
+	}
+
+	for _, value := range []string{"abc", "0"} {
+		t.Setenv("BUILDIUM_SEED", value)
+		if _, err := seedFromEnv(0); err == nil {
+			t.Errorf("seedFromEnv() accepted BUILDIUM_SEED=%q", value)
+		}
+	}
+}
+
+func TestStepRand(t *testing.T) {
+	if stepRand(1, "a").Int64() != stepRand(1, "a").Int64() {
+		t.Error("stepRand() is not deterministic")
+	}
+	if stepRand(1, "a").Int64() == stepRand(1, "b").Int64() || stepRand(1, "a").Int64() == stepRand(2, "a").Int64() {
+		t.Error("stepRand() ignores the seed or step Id")
+	}
+}
+
+// randomInputs runs steps "a" and "b", retrying "b" once, and returns what each
+// attempt drew from Session.Rand.
+func randomInputs(options Options) (*RunResult, map[string][]int64) {
+	drawn := map[string][]int64{}
+	env := &seedEnvironment{drawn: drawn}
+	failed := false
+	steps := []Step[string]{
+		{Id: "a", Run: func(config string) error { return nil }},
+		{Id: "b", Run: func(config string) error {
+			if !failed {
+				failed = true
+				return errors.New("flaky")
+			}
+			return nil
+		}, Retry: Retry{Attempts: 2}},
+	}
+	runner := New(testMeta(1), env, steps, nil)
+	runner.SetOptions(options)
+	return runner.Execute(newTestContext()), drawn
+}
+
+// seedEnvironment passes steps their Id and records a draw from each attempt's Rand.
+type seedEnvironment struct {
+	fakeEnvironment
+	drawn map[string][]int64
+}
+
+func (e *seedEnvironment) Setup(ctx context.Context, s *Session) error { return nil }
+
+func (e *seedEnvironment) Teardown(s *Session) {}
+
+func (e *seedEnvironment) RunStep(ctx context.Context, s *Session, step func(config string) error) error {
+	e.drawn[s.StepId] = append(e.drawn[s.StepId], s.Rand.Int64())
+	return step(s.StepId)
+}
+
+func TestSeededRuns(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+	t.Setenv("BUILDIUM_SEED", "")
+
+	first, drawn := randomInputs(Options{})
+	if first.Seed == 0 || !first.Passed() {
+		t.Fatalf("result = %+v, want a passing run with a seed", first)
+	}
+	if b := drawn["b"]; len(b) != 2 || b[0] != b[1] {
+		t.Errorf("step b drew %v, want the same input on each attempt", b)
+	}
+
+	replay, replayed := randomInputs(Options{Seed: first.Seed})
+	if replay.Seed != first.Seed || !reflect.DeepEqual(replayed, drawn) {
+		t.Errorf("replay drew %v with seed %d, want %v", replayed, replay.Seed, drawn)
+	}
+	_, single := randomInputs(Options{Seed: first.Seed, Step: "a"})
+	if !reflect.DeepEqual(single["a"], drawn["a"]) {
+		t.Errorf("running step a alone drew %v, want %v", single["a"], drawn["a"])
+	}
+
+	t.Setenv("BUILDIUM_SEED", "nope")
+	if result, _ := randomInputs(Options{}); result.Kind != HarnessError {
+		t.Errorf("result = %+v, want a harness error for an invalid BUILDIUM_SEED", result)
+	}
+}
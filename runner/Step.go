@@ -0,0 +1,109 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/buildium-org/buildium_harness/logger"
+)
+
+// Step is one test in a tutorial. Id identifies it across reorderings and in
+// reports, so it should not change once learners have run it.
+type Step[C any] struct {
+	Id          string
+	Title       string
+	Description string
+	// Hints are shown to the learner when the step fails.
+	Hints []string
+	Tags  []string
+	// Set one of Run and RunContext. RunContext's context is cancelled when the
+	// step times out, so network calls can stop early.
+	Run        func(config C) error
+	RunContext func(ctx context.Context, config C) error
+	// Timeout overrides the runner's step timeout for this step, and applies
+	// to each attempt.
+	Timeout time.Duration
+	// Retry reruns the step when it fails; by default it runs once.
+	Retry Retry
+}
+
+// HasTag reports whether the step is tagged with tag.
+func (s Step[C]) HasTag(tag string) bool {
+	return slices.Contains(s.Tags, tag)
+}
+
+func (s Step[C]) call(ctx context.Context, config C) error {
+	if s.RunContext != nil {
+		return s.RunContext(ctx, config)
+	}
+	return s.Run(config)
+}
+
+// Steps wraps bare step functions as Steps with the IDs "step-0", "step-1"...
+// Such steps log their own titles.
+func Steps[C any](funcs ...func(config C) error) []Step[C] {
+	steps := make([]Step[C], len(funcs))
+	for i, run := range funcs {
+		steps[i] = Step[C]{Id: IndexId(i), Run: run}
+	}
+	return steps
+}
+
+// IndexId is the ID Steps gives the step at index i.
+func IndexId(i int) string {
+	return fmt.Sprintf("step-%d", i)
+}
+
+// IndexIds converts step indexes, as skipped by older tutorials, to IDs.
+func IndexIds(indexes []int) []string {
+	ids := make([]string, len(indexes))
+	for i, index := range indexes {
+		ids[i] = IndexId(index)
+	}
+	return ids
+}
+
+// knownSkips returns the skipped Ids that name a step, warning about the rest.
+func knownSkips[C any](l *logger.Logger, steps []Step[C], skipSteps []string) []string {
+	var known []string
+	for _, id := range skipSteps {
+		if slices.ContainsFunc(steps, func(step Step[C]) bool { return step.Id == id }) {
+			known = append(known, id)
+		} else {
+			l.LogWarning(fmt.Sprintf("Ignoring skipped step %q: there are only %d steps", id, len(steps)))
+		}
+	}
+	return known
+}
+
+// validateSteps checks that every step has a unique ID and one function, and
+// that every skipped ID names a step.
+func validateSteps[C any](steps []Step[C], skipSteps []string) error {
+	seen := make(map[string]bool, len(steps))
+	for i, step := range steps {
+		if step.Id == "" {
+			return fmt.Errorf("step %d has no ID", i)
+		}
+		if seen[step.Id] {
+			return fmt.Errorf("duplicate step ID %q", step.Id)
+		}
+		if step.Run == nil && step.RunContext == nil {
+			return fmt.Errorf("step %q has no Run function", step.Id)
+		}
+		if step.Run != nil && step.RunContext != nil {
+			return fmt.Errorf("step %q sets both Run and RunContext", step.Id)
+		}
+		if step.Retry.Attempts < 0 || step.Retry.Backoff < 0 {
+			return fmt.Errorf("step %q has negative retry attempts or backoff", step.Id)
+		}
+		seen[step.Id] = true
+	}
+	for _, id := range skipSteps {
+		if !seen[id] {
+			return fmt.Errorf("cannot skip unknown step %q", id)
+		}
+	}
+	return nil
+}
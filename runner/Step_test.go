@@ -0,0 +1,89 @@
+package runner
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/buildium-org/buildium_harness/logger"
+)
+
+func TestRunNamedSteps(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+
+	var calls []string
+	var ran []string
+	record := func(config string) error {
+		ran = append(ran, "run")
+		return nil
+	}
+	steps := []Step[string]{
+		{Id: "parse-flags", Title: "Parse flags", Description: "Checks --name", Run: record},
+		{Id: "read-file", Title: "Read file", Run: func(config string) error {
+			t.Error("skipped step ran")
+			return nil
+		}},
+		{Id: "write-file", Title: "Write file", Hints: []string{"Open the file with O_CREATE"}, Run: func(config string) error {
+			return errors.New("file not written")
+		}},
+	}
+
+	before := len(logger.GetAllLogs())
+	err := New(testMeta(2), &fakeEnvironment{name: "env", calls: &calls}, steps, []string{"read-file"}).Run(newTestContext())
+	if err == nil || err.Error() != "file not written" {
+		t.Fatalf("Run() error = %v, want the write-file failure", err)
+	}
+	var got []logger.Log
+	for _, log := range logger.GetAllLogs()[before:] {
+		got = append(got, logger.Log{Stage: log.Stage, StepId: log.StepId, Message: log.Message})
+	}
+	want := []logger.Log{
+		{Stage: 0, StepId: "parse-flags", Message: "Parse flags"},
+		{Stage: 0, StepId: "parse-flags", Message: "Checks --name"},
+		{Stage: 0, StepId: "parse-flags", Message: "Test passed"},
+		{Stage: 1, StepId: "read-file", Message: "Skipping Step"},
+		{Stage: 1, StepId: "read-file", Message: "Skipping step"},
+		{Stage: 1, StepId: "read-file", Message: "Test passed"},
+		{Stage: 2, StepId: "write-file", Message: "Write file"},
+		{Stage: 2, StepId: "write-file", Message: "Test failed"},
+		{Stage: 2, StepId: "write-file", Message: "Hint: Open the file with O_CREATE"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("logs = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestValidateSteps(t *testing.T) {
+	run := func(config string) error { return nil }
+	cases := []struct {
+		steps []Step[string]
+		skip  []string
+		want  string
+	}{
+		{[]Step[string]{{Id: "a", Run: run}, {Id: "b", Run: run}}, []string{"b"}, ""},
+		{[]Step[string]{{Run: run}}, nil, "step 0 has no ID"},
+		{[]Step[string]{{Id: "a", Run: run}, {Id: "a", Run: run}}, nil, `duplicate step ID "a"`},
+		{[]Step[string]{{Id: "a"}}, nil, `step "a" has no Run function`},
+		{[]Step[string]{{Id: "a", Run: run}}, []string{"step-3"}, `cannot skip unknown step "step-3"`},
+	}
+	for _, test := range cases {
+		err := validateSteps(test.steps, test.skip)
+		if (test.want == "" && err != nil) || (test.want != "" && (err == nil || !strings.Contains(err.Error(), test.want))) {
+			t.Errorf("validateSteps(%v, %v) = %v, want %q", test.steps, test.skip, err, test.want)
+		}
+	}
+}
+
+func TestSteps(t *testing.T) {
+	steps := Steps(func(config string) error { return nil }, func(config string) error { return nil })
+	if len(steps) != 2 || steps[0].Id != "step-0" || steps[1].Id != "step-1" || steps[1].Title != "" {
+		t.Errorf("Steps() = %+v, want Ids by index and no titles", steps)
+	}
+	if ids := IndexIds([]int{1, 3}); !reflect.DeepEqual(ids, []string{"step-1", "step-3"}) {
+		t.Errorf("IndexIds() = %v", ids)
+	}
+	if !(Step[string]{Tags: []string{"http"}}).HasTag("http") {
+		t.Error("HasTag(\"http\") = false")
+	}
+}
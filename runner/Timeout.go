@@ -0,0 +1,84 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/buildium-org/buildium_harness/logger"
+)
+
+// DefaultStepTimeout is how long a step may run unless the tutorial or
+// STEP_TIMEOUT says otherwise.
+const DefaultStepTimeout = time.Minute
+
+// timeoutFromEnv reads a timeout in milliseconds from the environment variable
+// key, returning fallback when it is unset. 0 means no timeout.
+func timeoutFromEnv(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	ms, err := strconv.Atoi(value)
+	if err != nil || ms < 0 {
+		return 0, fmt.Errorf("invalid %s %q: expected a number of milliseconds", key, value)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// runStep runs step in the environment under its deadline. A panic in the step
+// or the environment fails the step instead of crashing the run.
+func (r *Runner[C]) runStep(ctx context.Context, s *Session, step Step[C], stepTimeout time.Duration) (err error) {
+	if step.Timeout > 0 {
+		stepTimeout = step.Timeout
+	}
+	if stepTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, stepTimeout, fmt.Errorf("step timed out after %v: %w", stepTimeout, context.DeadlineExceeded))
+		defer cancel()
+	}
+	defer recoverPanic(s.Logger, &err)
+	// Each attempt gets its own logger and Rand, so that an attempt abandoned
+	// after timing out shares neither with the next. Once the step returns, only
+	// an abandoned attempt can still log through the fork.
+	stepSession := *s
+	stepSession.Logger = s.Logger.Fork()
+	stepSession.Rand = stepRand(s.Seed, step.Id)
+	defer stepSession.Logger.Abandon()
+	return r.env.RunStep(ctx, &stepSession, func(config C) error {
+		return runWithContext(ctx, stepSession.Logger, func() error {
+			return step.call(ctx, config)
+		})
+	})
+}
+
+// runWithContext runs fn on its own goroutine so that a step which ignores its
+// context is abandoned, rather than waited for, once ctx is done.
+func runWithContext(ctx context.Context, l *logger.Logger, fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		defer func() { done <- err }()
+		defer recoverPanic(l, &err)
+		err = fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// recoverPanic turns a panic into *err, logging the stack trace. It must be
+// deferred directly.
+func recoverPanic(l *logger.Logger, err *error) {
+	if recovered := recover(); recovered != nil {
+		l.LogError(fmt.Sprintf("Step panicked: %v", recovered))
+		l.LogInfo(string(debug.Stack()))
+		*err = fmt.Errorf("step panicked: %v", recovered)
+	}
+}
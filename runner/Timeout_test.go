@@ -0,0 +1,195 @@
+package runner
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/buildium-org/buildium_harness/logger"
+)
+
+// panickingEnvironment panics while setting up each step.
+type panickingEnvironment struct {
+	fakeEnvironment
+}
+
+func (p *panickingEnvironment) RunStep(ctx context.Context, s *Session, step func(config string) error) error {
+	panic("environment broke")
+}
+
+// sessionEnvironment passes steps the session they run in.
+type sessionEnvironment struct {
+	fakeEnvironment
+}
+
+func (e *sessionEnvironment) RunStep(ctx context.Context, s *Session, step func(config *Session) error) error {
+	return step(s)
+}
+
+func TestAbandonedStepLogsAreNotCollected(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+
+	stop := make(chan struct{})
+	defer close(stop)
+	steps := []Step[*Session]{
+		{Id: "ignores-context", Timeout: 20 * time.Millisecond, Run: func(s *Session) error {
+			for {
+				select {
+				case <-stop:
+					return nil
+				case <-time.After(time.Millisecond):
+					s.Logger.LogInfo("still running")
+				}
+			}
+		}},
+	}
+	var calls []string
+	ctx := newTestContext()
+	before := len(logger.GetAllLogs())
+	err := New[*Session](testMeta(0), &sessionEnvironment{fakeEnvironment{name: "env", calls: &calls}}, steps, nil).Run(ctx)
+	if err == nil || err.Error() != "step timed out after 20ms: context deadline exceeded" {
+		t.Fatalf("Run() error = %v, want the step to time out", err)
+	}
+	count := func() int {
+		n := 0
+		for _, log := range logger.GetAllLogs()[before:] {
+			if log.Message == "still running" {
+				n++
+				if log.Stage != 0 || log.StepId != "ignores-context" {
+					t.Errorf("log = %+v, want it tagged with the step that logged it", log)
+				}
+			}
+		}
+		return n
+	}
+	after := count()
+	// The runner moves on while the step keeps logging
+	l := ctx.Value("logger").(*logger.Logger)
+	l.SetStep(1)
+	l.LogInfo("next step")
+	time.Sleep(30 * time.Millisecond)
+	if n := count(); n != after {
+		t.Errorf("%d logs collected after the step was abandoned, want none", n-after)
+	}
+}
+
+func TestStepTimeout(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+
+	var calls []string
+	// Steps that time out are abandoned on their own goroutine
+	var stepCtx atomic.Value
+	steps := []Step[string]{
+		{Id: "blocks", Timeout: 50 * time.Millisecond, Run: func(config string) error {
+			select {}
+		}},
+	}
+	start := time.Now()
+	err := New(testMeta(0), &fakeEnvironment{name: "env", calls: &calls}, steps, nil).Run(newTestContext())
+	if err == nil || err.Error() != "step timed out after 50ms: context deadline exceeded" {
+		t.Fatalf("Run() error = %v, want the step to time out", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Run() took %v for a 50ms timeout", elapsed)
+	}
+	if calls[len(calls)-1] != "env.teardown" {
+		t.Errorf("calls = %v, want the environment torn down", calls)
+	}
+
+	steps = []Step[string]{
+		{Id: "waits", RunContext: func(ctx context.Context, config string) error {
+			stepCtx.Store(ctx)
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+	}
+	runner := New(testMeta(0), &fakeEnvironment{name: "env", calls: &calls}, steps, nil)
+	runner.SetStepTimeout(20 * time.Millisecond)
+	if err := runner.Run(newTestContext()); err == nil || err.Error() != "step timed out after 20ms: context deadline exceeded" {
+		t.Fatalf("Run() error = %v, want the runner's step timeout", err)
+	}
+	if stepCtx.Load().(context.Context).Err() == nil {
+		t.Error("the step's context was not cancelled")
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+	t.Setenv("RUN_TIMEOUT", "60")
+
+	var calls []string
+	var ran atomic.Int32
+	sleep := func(ctx context.Context, config string) error {
+		ran.Add(1)
+		select {
+		case <-time.After(40 * time.Millisecond):
+			return nil
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+	steps := []Step[string]{{Id: "a", RunContext: sleep}, {Id: "b", RunContext: sleep}, {Id: "c", RunContext: sleep}}
+	err := New(testMeta(2), &fakeEnvironment{name: "env", calls: &calls}, steps, nil).Run(newTestContext())
+	if err == nil || err.Error() != "run timed out after 60ms: context deadline exceeded" {
+		t.Fatalf("Run() error = %v, want the run to time out", err)
+	}
+	if ran.Load() != 2 {
+		t.Errorf("ran %d steps, want the second to time out", ran.Load())
+	}
+}
+
+func TestInvalidTimeoutEnv(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+	t.Setenv("STEP_TIMEOUT", "soon")
+
+	var calls []string
+	err := New(testMeta(0), &fakeEnvironment{name: "env", calls: &calls}, nil, nil).Run(newTestContext())
+	if err == nil || !strings.Contains(err.Error(), `invalid STEP_TIMEOUT "soon"`) {
+		t.Errorf("Run() error = %v", err)
+	}
+}
+
+func TestStepPanics(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+
+	var calls []string
+	steps := []Step[string]{
+		{Id: "panics", Run: func(config string) error {
+			var values map[string]int
+			values["answer"] = 42
+			return nil
+		}},
+	}
+	before := len(logger.GetAllLogs())
+	err := New(testMeta(0), &fakeEnvironment{name: "env", calls: &calls}, steps, nil).Run(newTestContext())
+	if err == nil || !strings.HasPrefix(err.Error(), "step panicked: assignment to entry in nil map") {
+		t.Fatalf("Run() error = %v, want the panic as a failure", err)
+	}
+	logs := logger.GetAllLogs()[before:]
+	if !strings.HasPrefix(logs[0].Message, "Step panicked: ") || !strings.Contains(logs[1].Message, "Timeout_test.go") {
+		t.Errorf("logs = %+v, want the panic and its stack trace", logs)
+	}
+	if logs[len(logs)-1].Message != "Test failed" {
+		t.Errorf("last log = %+v, want the step to fail", logs[len(logs)-1])
+	}
+
+	env := &panickingEnvironment{fakeEnvironment{name: "env", calls: &calls}}
+	steps = Steps(func(config string) error { return nil })
+	err = New[string](testMeta(0), env, steps, nil).Run(newTestContext())
+	if err == nil || err.Error() != "step panicked: environment broke" {
+		t.Errorf("Run() error = %v, want the environment panic as a failure", err)
+	}
+}
+
+func TestValidateRunAndRunContext(t *testing.T) {
+	steps := []Step[string]{{
+		Id:         "both",
+		Run:        func(config string) error { return nil },
+		RunContext: func(ctx context.Context, config string) error { return nil },
+	}}
+	if err := validateSteps(steps, nil); err == nil || err.Error() != `step "both" sets both Run and RunContext` {
+		t.Errorf("validateSteps() = %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/buildium-org/buildium_harness/logger"
+	"github.com/buildium-org/buildium_harness/meta"
+	"github.com/buildium-org/buildium_harness/toolchain"
+)
+
+// Watch mode polls every watchInterval, and reruns once the files have stopped
+// changing for watchDebounce, so that a build in progress is not tested.
+var (
+	watchInterval = 500 * time.Millisecond
+	watchDebounce = 300 * time.Millisecond
+)
+
+const clearScreen = "\033[H\033[2J"
+
+// watchSkipDirs are directories that never hold the user's sources.
+var watchSkipDirs = map[string]bool{".git": true, "node_modules": true, "__pycache__": true}
+
+// Watch runs the steps, then reruns them on a cleared screen, writing to w,
+// whenever the user's program or meta.json changes. meta.json is reloaded
+// before each rerun, so that a new stage is picked up, and every run uses the
+// same seed. A result is only uploaded when it differs from the last one.
+// Watch stops when ctx is done, returning the last result.
+func (r *Runner[C]) Watch(ctx context.Context, w io.Writer) *RunResult {
+	l := ctx.Value("logger").(*logger.Logger)
+	r.options.Watch = true
+	// An invalid seed is reported by each run
+	if seed, err := seedFromEnv(r.options.Seed); err == nil {
+		r.options.Seed = seed
+	}
+	for {
+		paths := watchPaths(r.meta)
+		fmt.Fprint(w, clearScreen)
+		logger.ResetLogs()
+		l.SetStep(0)
+		result := r.Execute(ctx)
+		logResult(l, r.meta, result)
+		l.LogInfo(fmt.Sprintf("Watching %s for changes, press Ctrl-C to stop", strings.Join(paths, ", ")))
+		if err := waitForChange(ctx, paths, watchInterval, watchDebounce); err != nil {
+			return result
+		}
+		r.reloadMeta(l)
+	}
+}
+
+// reloadMeta rereads meta.json from the project directory. When it can't be
+// read, for example while it is being rewritten, the last one is kept.
+func (r *Runner[C]) reloadMeta(l *logger.Logger) {
+	m, err := meta.Load(r.meta.ExecutableDir)
+	if err != nil {
+		l.LogWarning(fmt.Sprintf("Keeping the previous meta.json: %v", err))
+		return
+	}
+	r.meta = m
+}
+
+// watchPaths returns meta.json, the user's program and, when known, its
+// sources.
+func watchPaths(m *meta.Meta) []string {
+	paths := []string{filepath.Join(m.ExecutableDir, "meta.json")}
+	setup, err := toolchain.Resolve(m)
+	if err != nil {
+		// The run reports the error, and a fixed PATH shows in the next one
+		paths = append(paths, m.Executable())
+		if m.SourceDir != "" {
+			paths = append(paths, m.SourceDir)
+		}
+		return paths
+	}
+	paths = append(paths, setup.Executable)
+	if setup.Build != nil {
+		paths = append(paths, setup.BuildDir)
+	}
+	if m.SourceDir != "" {
+		paths = append(paths, m.SourceDir)
+	}
+	return paths
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// snapshot records the files under paths. Missing paths are left out, so that
+// creating them counts as a change.
+func snapshot(paths []string) map[string]fileState {
+	files := map[string]fileState{}
+	for _, path := range paths {
+		filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if file != path && watchSkipDirs[d.Name()] {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				files[file] = fileState{modTime: info.ModTime(), size: info.Size()}
+			}
+			return nil
+		})
+	}
+	return files
+}
+
+// waitForChange polls paths every interval until their files change and then
+// stay unchanged for debounce. It returns ctx's error if ctx is done first.
+func waitForChange(ctx context.Context, paths []string, interval, debounce time.Duration) error {
+	last := snapshot(paths)
+	var changedAt time.Time
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		current := snapshot(paths)
+		if !maps.Equal(current, last) {
+			last, changedAt = current, time.Now()
+		} else if !changedAt.IsZero() && time.Since(changedAt) >= debounce {
+			return nil
+		}
+	}
+}
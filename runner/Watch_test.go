@@ -0,0 +1,173 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/buildium-org/buildium_harness/meta"
+)
+
+func shortWatchIntervals(t *testing.T) {
+	interval, debounce := watchInterval, watchDebounce
+	watchInterval, watchDebounce = 5*time.Millisecond, 20*time.Millisecond
+	t.Cleanup(func() { watchInterval, watchDebounce = interval, debounce })
+}
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	for _, file := range []string{"main.go", "lib/util.go", ".git/HEAD", "node_modules/x/index.js"} {
+		path := filepath.Join(dir, file)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		os.WriteFile(path, []byte(file), 0o644)
+	}
+
+	files := snapshot([]string{dir, filepath.Join(dir, "missing")})
+	var got []string
+	for file := range files {
+		got = append(got, strings.TrimPrefix(file, dir+"/"))
+	}
+	want := map[string]bool{"main.go": true, "lib/util.go": true}
+	if len(got) != len(want) || !want[got[0]] || !want[got[1]] {
+		t.Errorf("snapshot() files = %v, want main.go and lib/util.go", got)
+	}
+}
+
+func TestWaitForChange(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app")
+	os.WriteFile(file, []byte("v1"), 0o755)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		os.WriteFile(file, []byte("version 2"), 0o755)
+	}()
+	start := time.Now()
+	if err := waitForChange(context.Background(), []string{file}, 5*time.Millisecond, 30*time.Millisecond); err != nil {
+		t.Fatalf("waitForChange() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("waitForChange() returned after %v, before the debounce", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := waitForChange(ctx, []string{file}, 5*time.Millisecond, 30*time.Millisecond); err != context.DeadlineExceeded {
+		t.Errorf("waitForChange() error = %v, want the context's error without a change", err)
+	}
+}
+
+func TestWatchPaths(t *testing.T) {
+	m := &meta.Meta{Entrypoint: "app", ExecutableDir: "/project", SourceDir: "/project/src"}
+	if got, want := watchPaths(m), []string{"/project/meta.json", "/project/app", "/project/src"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("watchPaths() = %v, want %v", got, want)
+	}
+	m.Build = &meta.BuildConfig{Command: "make", Output: "bin/app"}
+	if got, want := watchPaths(m), []string{"/project/meta.json", "/project/bin/app", "/project", "/project/src"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("watchPaths() with a build = %v, want %v", got, want)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+	shortWatchIntervals(t)
+
+	dir := t.TempDir()
+	executable := filepath.Join(dir, "app")
+	os.WriteFile(executable, []byte("v1"), 0o755)
+	ctx, cancel := context.WithCancel(newTestContext())
+	defer cancel()
+
+	runs := 0
+	steps := Steps(func(config string) error {
+		runs++
+		if runs == 1 {
+			// Rebuilt while the steps run, so only the later write is a change
+			os.WriteFile(executable, []byte("v2"), 0o755)
+			go func() {
+				time.Sleep(30 * time.Millisecond)
+				os.WriteFile(executable, []byte("version 3"), 0o755)
+			}()
+		}
+		return nil
+	})
+	var calls []string
+	runner := New(&meta.Meta{Stage: 0, Entrypoint: "app", ExecutableDir: dir}, &fakeEnvironment{name: "env", calls: &calls}, steps, nil)
+	runner.SetHooks(Hooks{AfterAll: func(ctx context.Context, s *Session, result *RunResult) error {
+		if runs == 2 {
+			cancel()
+		}
+		return nil
+	}})
+	var out bytes.Buffer
+	result := runner.Watch(ctx, &out)
+
+	if runs != 2 || strings.Count(out.String(), clearScreen) != 2 {
+		t.Fatalf("ran %d times and cleared the screen %d times, want 2", runs, strings.Count(out.String(), clearScreen))
+	}
+	if !result.Passed() || result.Report != ReportSkipped {
+		t.Errorf("last result = %+v, want an unchanged result that was not uploaded again", result)
+	}
+}
+
+func TestWatchReloadsMetaAndKeepsTheSeed(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+	shortWatchIntervals(t)
+
+	dir := t.TempDir()
+	executable := filepath.Join(dir, "app")
+	os.WriteFile(executable, []byte("v1"), 0o755)
+	metaFile := filepath.Join(dir, "meta.json")
+	os.WriteFile(metaFile, []byte(`{"stage": 0, "entrypoint": "app"}`), 0o644)
+	m, err := meta.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(newTestContext())
+	defer cancel()
+
+	runs, laterRuns := 0, 0
+	steps := Steps(func(config string) error {
+		runs++
+		if runs == 1 {
+			// Moving to the next stage alone triggers a rerun
+			go func() {
+				time.Sleep(30 * time.Millisecond)
+				os.WriteFile(metaFile, []byte(`{"stage": 1, "entrypoint": "app"}`), 0o644)
+			}()
+		}
+		return nil
+	}, func(config string) error {
+		laterRuns++
+		return nil
+	})
+	var calls []string
+	var seeds []int64
+	runner := New(m, &fakeEnvironment{name: "env", calls: &calls}, steps, nil)
+	runner.SetHooks(Hooks{AfterAll: func(ctx context.Context, s *Session, result *RunResult) error {
+		seeds = append(seeds, s.Seed)
+		if runs == 2 {
+			cancel()
+		}
+		return nil
+	}})
+	result := runner.Watch(ctx, io.Discard)
+
+	if runs != 2 {
+		t.Fatalf("ran %d times, want 2", runs)
+	}
+	if laterRuns != 1 {
+		t.Errorf("step 1 ran %d times, want once after meta.json moved to stage 1", laterRuns)
+	}
+	if len(seeds) != 2 || seeds[0] != seeds[1] {
+		t.Errorf("seeds = %v, want one seed for the watch session", seeds)
+	}
+	if !result.Passed() || result.Report != ReportDisabled {
+		t.Errorf("last result = %+v, want a new result", result)
+	}
+}
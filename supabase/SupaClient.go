@@ -1,6 +1,7 @@
 package supabase
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -32,15 +33,28 @@ func NewSupaClient(ctx context.Context) *SupaClient {
 }
 
 func (c *SupaClient) AddProjectRun(ctx context.Context, projectId string, stage int, logs []logger.Log) (*http.Response, error) {
+	return c.AddProjectRunWithExtras(ctx, projectId, stage, logs, nil)
+}
+
+// AddProjectRunWithExtras reports a run with additional top-level fields in
+// the body, such as an attached HAR archive.
+func (c *SupaClient) AddProjectRunWithExtras(ctx context.Context, projectId string, stage int, logs []logger.Log, extras map[string]any) (*http.Response, error) {
 	if c.BaseUrl == "" {
 		return nil, nil
 	}
-	logsJson, err := json.Marshal(logs)
+	body := map[string]any{}
+	for key, value := range extras {
+		body[key] = value
+	}
+	body["projectId"] = projectId
+	body["stage"] = stage
+	body["logsJson"] = logs
+	body["token"] = c.Token
+	bodyJson, err := json.Marshal(body)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseUrl+"/functions/v1/create-project-run",
-		strings.NewReader(fmt.Sprintf(`{"projectId":"%s", "stage":%d, "logsJson":%s, "token":"%s"}`, projectId, stage, logsJson, c.Token)))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseUrl+"/functions/v1/create-project-run", bytes.NewReader(bodyJson))
 	if err != nil {
 		return nil, err
 	}
@@ -2,7 +2,10 @@ package supabase
 
 import (
 	"context"
+	"encoding/json"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 
@@ -50,3 +53,31 @@ func TestLogin(t *testing.T) {
 		t.Fatalf("Failed to get token")
 	}
 }
+
+func TestAddProjectRunWithExtras(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer server.Close()
+
+	supaClient := &SupaClient{Client: server.Client(), BaseUrl: server.URL, Token: "token-123"}
+	logs := []logger.Log{{Stage: 0, Message: "Health Check", Type: "HEADER"}}
+	extras := map[string]any{"har": map[string]any{"log": map[string]any{"version": "1.2"}}, "stage": 99}
+
+	resp, err := supaClient.AddProjectRunWithExtras(context.Background(), "project-1", 3, logs, extras)
+	if err != nil {
+		t.Fatalf("Failed to add project run: %v", err)
+	}
+	resp.Body.Close()
+
+	if body["projectId"] != "project-1" || body["stage"] != 3.0 || body["token"] != "token-123" {
+		t.Errorf("body = %v, want projectId, stage and token set", body)
+	}
+	if logsJson, ok := body["logsJson"].([]any); !ok || len(logsJson) != 1 {
+		t.Errorf("logsJson = %v, want one log", body["logsJson"])
+	}
+	if har, ok := body["har"].(map[string]any); !ok || har["log"] == nil {
+		t.Errorf("har = %v, want the attached archive", body["har"])
+	}
+}
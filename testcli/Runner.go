@@ -2,72 +2,56 @@ package testcli
 
 import (
 	"context"
-	"fmt"
-	"slices"
 
-	"github.com/buildium-org/buildium_harness/logger"
+	"github.com/buildium-org/buildium_harness/diagnostics"
 	"github.com/buildium-org/buildium_harness/meta"
-	"github.com/buildium-org/buildium_harness/supabase"
+	"github.com/buildium-org/buildium_harness/runner"
 )
 
-func SkipStep(config *CliTestConfig) error {
-	logger := *config.Logger
-	logger.LogTitle("Skipping Step")
-	logger.LogInfo("Skipping step")
-	return nil
+// Step is a named step; see runner.Step.
+type Step = runner.Step[*CliTestConfig]
+
+// Hooks run around the steps; see runner.Hooks.
+type Hooks = runner.Hooks
+
+// Runner runs CLI steps; see runner.Runner.
+type Runner = runner.Runner[*CliTestConfig]
+
+// NewRunner runs bare step functions, skipping steps by index. Their Ids are
+// "step-0", "step-1"...
+func NewRunner(meta *meta.Meta, steps []func(config *CliTestConfig) error, skipSteps []int) *Runner {
+	r := NewStepRunner(meta, runner.Steps(steps...), runner.IndexIds(skipSteps))
+	r.SetIndexSkips(true)
+	return r
 }
 
-type Runner struct {
-	meta      *meta.Meta
-	steps     []func(config *CliTestConfig) error
-	skipSteps []int
+// NewStepRunner runs named steps, skipping the steps with the given Ids.
+func NewStepRunner(meta *meta.Meta, steps []Step, skipSteps []string) *Runner {
+	return runner.New(meta, NewEnvironment(), steps, skipSteps)
 }
 
-func NewRunner(meta *meta.Meta, steps []func(config *CliTestConfig) error, skipSteps []int) *Runner {
-	return &Runner{meta: meta, steps: steps, skipSteps: skipSteps}
+// Environment runs CLI steps, which start the user's program themselves.
+type Environment struct{}
+
+func NewEnvironment() *Environment {
+	return &Environment{}
 }
 
-func (r *Runner) Run(ctx context.Context) error {
-	l := ctx.Value("logger").(*logger.Logger)
-	executable := r.meta.ExecutableDir + "/" + r.meta.Entrypoint
-	ctx = context.WithValue(ctx, "executable", executable)
-	supaClient := supabase.NewSupaClient(ctx)
-	err := supaClient.Login(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to login: %v", err)
-	}
-	ctx = context.WithValue(ctx, "supaClient", supaClient)
-	completedStage := -1
-	for i, step := range r.steps {
-		if i > r.meta.Stage {
-			break
-		}
-		var err error
-		if slices.Contains(r.skipSteps, i) {
-			err = runTest(ctx, SkipStep)
-		} else {
-			err = runTest(ctx, step)
-		}
-		if err != nil {
-			supaClient.AddProjectRun(ctx, r.meta.ProjectId, i-1, logger.GetAllLogs())
-			return err
-		}
-		l.NextStep()
-		completedStage++
-	}
-	supaClient.AddProjectRun(ctx, r.meta.ProjectId, completedStage, logger.GetAllLogs())
+func (e *Environment) Setup(ctx context.Context, s *runner.Session) error {
 	return nil
 }
 
-func runTest(ctx context.Context, step func(config *CliTestConfig) error) error {
-	logger := ctx.Value("logger").(*logger.Logger)
-	executable := ctx.Value("executable").(string)
-	err := step(&CliTestConfig{Logger: logger, Executable: executable})
-	if err != nil {
-		logger.LogError("Test failed")
-		return err
+func (e *Environment) RunStep(ctx context.Context, s *runner.Session, step func(config *CliTestConfig) error) error {
+	err := step(&CliTestConfig{Logger: s.Logger, Executable: s.Setup.Executable, Command: s.Setup.Command, Rand: s.Rand})
+	// Explain why the user's program could not be run at all
+	if diagnostics.IsExecError(err, s.Setup.Command.Path) {
+		diagnostics.Inspect(s.Setup.Command.Path, s.Meta.SourceDir).Log(s.Logger)
 	}
-	logger.LogSuccess("Test passed")
-	return nil
+	return err
+}
 
+func (e *Environment) Extras(ctx context.Context, s *runner.Session) map[string]any {
+	return nil
 }
+
+func (e *Environment) Teardown(s *runner.Session) {}
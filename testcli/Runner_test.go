@@ -4,10 +4,13 @@ import (
 	"context"
 	"errors"
 	"os"
+	"os/exec"
+	"strings"
 	"testing"
 
 	"github.com/buildium-org/buildium_harness/logger"
 	"github.com/buildium-org/buildium_harness/meta"
+	"github.com/buildium-org/buildium_harness/process"
 )
 
 // Helper to create a test context with logger
@@ -35,12 +38,10 @@ func TestNewRunner(t *testing.T) {
 		t.Fatal("NewRunner() returned nil")
 	}
 
-	if runner.meta != m {
-		t.Error("NewRunner() did not set meta correctly")
-	}
-
-	if len(runner.steps) != 2 {
-		t.Errorf("NewRunner() steps length = %d, want 2", len(runner.steps))
+	t.Setenv("ENVIRONMENT", "BUILDING")
+	result := runner.Execute(newTestContext())
+	if len(result.Steps) != 2 || result.Steps[0].Id != "step-0" || result.Steps[1].Id != "step-1" {
+		t.Errorf("NewRunner() steps = %+v, want 2 steps with Ids by index", result.Steps)
 	}
 }
 
@@ -60,8 +61,9 @@ func TestNewRunnerWithEmptySteps(t *testing.T) {
 		t.Fatal("NewRunner() returned nil")
 	}
 
-	if len(runner.steps) != 0 {
-		t.Errorf("NewRunner() steps length = %d, want 0", len(runner.steps))
+	t.Setenv("ENVIRONMENT", "BUILDING")
+	if result := runner.Execute(newTestContext()); len(result.Steps) != 0 {
+		t.Errorf("NewRunner() steps = %+v, want none", result.Steps)
 	}
 }
 
@@ -495,3 +497,190 @@ func TestRunWithHighStageAndFewerSteps(t *testing.T) {
 		t.Errorf("Expected 2 steps to be called, got %d", callCount)
 	}
 }
+
+func TestRunOrphanedProcesses(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+
+	m := &meta.Meta{
+		Stage:         1,
+		Entrypoint:    "app",
+		ExecutableDir: "/test/path",
+		ProjectId:     "test-project-123",
+	}
+
+	orphanSeen := false
+	steps := []func(config *CliTestConfig) error{
+		func(config *CliTestConfig) error {
+			// Double fork into a new session so no process group covers it
+			return exec.Command("/bin/sh", "-c", "(setsid sleep 30 &)").Run()
+		},
+		func(config *CliTestConfig) error {
+			for _, p := range process.Descendants(os.Getpid()) {
+				orphanSeen = orphanSeen || p.Command == "sleep"
+			}
+			return nil
+		},
+	}
+
+	t.Setenv("ORPHAN_PROCESSES", "warn")
+	if err := NewRunner(m, steps, []int{}).Run(newTestContext()); err != nil {
+		t.Fatalf("Run() returned error in warn mode: %v", err)
+	}
+	if orphanSeen {
+		t.Error("the orphan from step 0 was still running during step 1")
+	}
+
+	t.Setenv("ORPHAN_PROCESSES", "fail")
+	err := NewRunner(m, steps, []int{}).Run(newTestContext())
+	if err == nil || !strings.Contains(err.Error(), "left running after the step") {
+		t.Errorf("Run() error = %v, want the orphan to fail the step", err)
+	}
+}
+
+func TestRunExplainsExecErrors(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/app", []byte("echo hello\n"), 0755); err != nil {
+		t.Fatalf("failed to write app: %v", err)
+	}
+	m := &meta.Meta{
+		Stage:         0,
+		Entrypoint:    "app",
+		ExecutableDir: dir,
+		ProjectId:     "test-project-123",
+	}
+	steps := []func(config *CliTestConfig) error{
+		func(config *CliTestConfig) error {
+			return exec.Command(config.Executable).Run()
+		},
+	}
+
+	before := len(logger.GetAllLogs())
+	if err := NewRunner(m, steps, []int{}).Run(newTestContext()); err == nil {
+		t.Fatal("Run() should fail when the executable cannot run")
+	}
+	explained := false
+	for _, log := range logger.GetAllLogs()[before:] {
+		explained = explained || strings.Contains(log.Message, "has no shebang line")
+	}
+	if !explained {
+		t.Error("the missing shebang was not explained")
+	}
+}
+
+func TestRunBuildsBeforeFirstStep(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+
+	dir := t.TempDir()
+	m := &meta.Meta{
+		Stage:         0,
+		Entrypoint:    "unused",
+		ExecutableDir: dir,
+		ProjectId:     "test-project-123",
+		Build:         &meta.BuildConfig{Command: "printf '#!/bin/sh\\necho built\\n' > app && chmod +x app", Output: "app"},
+	}
+	var output []byte
+	steps := []func(config *CliTestConfig) error{
+		func(config *CliTestConfig) error {
+			var err error
+			output, err = exec.Command(config.Executable).Output()
+			return err
+		},
+	}
+	if err := NewRunner(m, steps, []int{}).Run(newTestContext()); err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+	if string(output) != "built\n" {
+		t.Errorf("step ran %q, want the freshly built executable", output)
+	}
+
+	m.Build.Command = "echo 'main.go:4:2: undefined: x' >&2; exit 1"
+	called := false
+	steps[0] = func(config *CliTestConfig) error {
+		called = true
+		return nil
+	}
+	before := len(logger.GetAllLogs())
+	err := NewRunner(m, steps, []int{}).Run(newTestContext())
+	if err == nil || called {
+		t.Fatalf("Run() error = %v, called = %v; want the build failure to stop the run", err, called)
+	}
+	logs := logger.GetAllLogs()[before:]
+	if logs[0].Stage != -1 || logs[2].Message != "main.go:4:2: error: undefined: x" {
+		t.Errorf("logged %+v, want the compiler error under stage -1", logs)
+	}
+}
+
+func TestRunInterpretedLanguage(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+
+	tools := t.TempDir()
+	if err := os.WriteFile(tools+"/python3", []byte("#!/bin/sh\necho \"python $*\"\n"), 0755); err != nil {
+		t.Fatalf("failed to write python3: %v", err)
+	}
+	t.Setenv("PATH", tools+":"+os.Getenv("PATH"))
+
+	m := &meta.Meta{
+		Stage:         0,
+		Entrypoint:    "main.py",
+		ExecutableDir: "/project",
+		ProjectId:     "test-project-123",
+		Language:      "python",
+	}
+	var output []byte
+	steps := []func(config *CliTestConfig) error{
+		func(config *CliTestConfig) error {
+			var err error
+			output, err = config.Cmd("add", "milk").Output()
+			return err
+		},
+	}
+	if err := NewRunner(m, steps, []int{}).Run(newTestContext()); err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+	if string(output) != "python /project/main.py add milk\n" {
+		t.Errorf("step ran %q, want the script run by python3", output)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	m.Language = "node"
+	err := NewRunner(m, steps, []int{}).Run(newTestContext())
+	if err == nil || !strings.Contains(err.Error(), "node projects need node") {
+		t.Errorf("Run() error = %v, want the missing toolchain", err)
+	}
+}
+
+func TestRunStepWithCases(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+
+	m := &meta.Meta{Stage: 0, Entrypoint: "sh", ExecutableDir: "/bin", ProjectId: "test-project-123"}
+	echo := func(input string) Case {
+		return Case{Name: input, Run: func(config *CliTestConfig) error {
+			output, err := config.Cmd("-c", "echo "+input).Output()
+			if err != nil {
+				return err
+			}
+			if string(output) != "hello\n" {
+				return errors.New("got " + strings.TrimSpace(string(output)))
+			}
+			return nil
+		}}
+	}
+	steps := []Step{{Id: "echo", Title: "Echo", Run: func(config *CliTestConfig) error {
+		return config.RunCases(echo("hello"), echo("world"), echo("hello"))
+	}}}
+
+	before := len(logger.GetAllLogs())
+	err := NewStepRunner(m, steps, nil).Run(newTestContext())
+	if err == nil || err.Error() != "1 of 3 cases failed: world" {
+		t.Fatalf("Run() error = %v, want one failing case", err)
+	}
+	summarized := false
+	for _, log := range logger.GetAllLogs()[before:] {
+		summarized = summarized || (log.Message == "2/3 cases passed" && log.StepId == "echo")
+	}
+	if !summarized {
+		t.Error("the case summary was not logged for the step")
+	}
+}
@@ -1,24 +1,50 @@
 package testcli
 
 import (
-	"context"
+	"math/rand/v2"
+	"os/exec"
 
 	"github.com/buildium-org/buildium_harness/logger"
-	"github.com/buildium-org/buildium_harness/meta"
-	"github.com/buildium-org/buildium_harness/utils"
+	"github.com/buildium-org/buildium_harness/runner"
+	"github.com/buildium-org/buildium_harness/toolchain"
 )
 
 type CliTestConfig struct {
-	Logger     *logger.Logger
+	Logger *logger.Logger
+	// Executable is the compiled binary, or the script for interpreted languages.
 	Executable string
+	// Command launches the user's program, through its interpreter if it has one.
+	Command toolchain.Command
+	// Rand generates random inputs that replay with the run's seed; see
+	// runner.Session.
+	Rand *rand.Rand
 }
 
-func RunCliTest(steps []func(config *CliTestConfig) error, skipSteps []int) {
-	meta := meta.NewMeta()
+// Case is one input checked within a step; see runner.Case.
+type Case = runner.Case[*CliTestConfig]
 
-	logger := logger.NewLogger()
-	ctx := context.WithValue(context.Background(), "logger", logger)
-	runner := NewRunner(meta, steps, skipSteps)
-	runner.Run(ctx)
-	logger.LogInfo("Testing complete! See results at " + utils.GetProjectUrl(meta.ProjectId))
+// RunCases runs each case and logs a per-case summary; see runner.RunCases.
+func (c *CliTestConfig) RunCases(cases ...Case) error {
+	return runner.RunCases(c.Logger, c, cases)
+}
+
+// Cmd returns an exec.Cmd running the user's program with args.
+func (c *CliTestConfig) Cmd(args ...string) *exec.Cmd {
+	return c.Command.Cmd(args...)
+}
+
+func RunCliTest(steps []func(config *CliTestConfig) error, skipSteps []int) *runner.RunResult {
+	return runner.MainWithIndexSkips(NewEnvironment(), runner.Steps(steps...), skipSteps, Hooks{})
+}
+
+// RunCliSteps is RunCliTest for named steps, skipping steps by Id.
+// The harness flags (-path, -step, -list...) are parsed from the command line;
+// see runner.ParseFlags.
+func RunCliSteps(steps []Step, skipSteps []string) *runner.RunResult {
+	return runner.Main(NewEnvironment(), steps, skipSteps)
+}
+
+// RunCliStepsWithHooks is RunCliSteps running hooks around the steps.
+func RunCliStepsWithHooks(steps []Step, skipSteps []string, hooks Hooks) *runner.RunResult {
+	return runner.MainWithHooks(NewEnvironment(), steps, skipSteps, hooks)
 }
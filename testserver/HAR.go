@@ -0,0 +1,479 @@
+package testserver
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultHARBodyLimit caps how many bytes of each request and response body
+// are kept in the archive. The full body is still delivered to the caller.
+const DefaultHARBodyLimit = 64 << 10
+
+const harFileName = "buildium-run.har"
+
+// HAR is an HTTP Archive 1.2 document.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+type HARLog struct {
+	Version string      `json:"version"`
+	Creator HARCreator  `json:"creator"`
+	Pages   []HARPage   `json:"pages"`
+	Entries []*HAREntry `json:"entries"`
+}
+
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HARPage struct {
+	StartedDateTime time.Time      `json:"startedDateTime"`
+	ID              string         `json:"id"`
+	Title           string         `json:"title"`
+	PageTimings     HARPageTimings `json:"pageTimings"`
+}
+
+type HARPageTimings struct {
+	OnContentLoad float64 `json:"onContentLoad"`
+	OnLoad        float64 `json:"onLoad"`
+}
+
+type HAREntry struct {
+	PageRef         string      `json:"pageref,omitempty"`
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARTimings are in milliseconds, with -1 for phases that did not happen
+// (for example DNS and connect on a reused connection).
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// HARRecorder records every exchange made through its transports.
+type HARRecorder struct {
+	BodyLimit int
+
+	mu      sync.Mutex
+	pages   []HARPage
+	entries []*HAREntry
+}
+
+func NewHARRecorder() *HARRecorder {
+	return &HARRecorder{BodyLimit: DefaultHARBodyLimit}
+}
+
+// StartPage groups the exchanges that follow under a new HAR page, one per step.
+func (r *HARRecorder) StartPage(id, title string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pages = append(r.pages, HARPage{StartedDateTime: time.Now(), ID: id, Title: title, PageTimings: HARPageTimings{OnContentLoad: -1, OnLoad: -1}})
+}
+
+// Transport wraps base (http.DefaultTransport when nil) so its exchanges are recorded.
+func (r *HARRecorder) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &harTransport{recorder: r, base: base}
+}
+
+func (r *HARRecorder) Client() *http.Client {
+	return &http.Client{Transport: r.Transport(nil)}
+}
+
+func (r *HARRecorder) Entries() []HAREntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := make([]HAREntry, len(r.entries))
+	for i, entry := range r.entries {
+		entries[i] = *entry
+	}
+	return entries
+}
+
+func (r *HARRecorder) HAR() HAR {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := make([]*HAREntry, len(r.entries))
+	for i, entry := range r.entries {
+		copied := *entry
+		entries[i] = &copied
+	}
+	return HAR{Log: HARLog{
+		Version: "1.2",
+		Creator: HARCreator{Name: "buildium_harness", Version: "1.0"},
+		Pages:   append([]HARPage{}, r.pages...),
+		Entries: entries,
+	}}
+}
+
+func (r *HARRecorder) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.HAR())
+}
+
+func (r *HARRecorder) WriteFile(path string) error {
+	data, err := json.MarshalIndent(r.HAR(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func (r *HARRecorder) add(entry *HAREntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pages) > 0 {
+		entry.PageRef = r.pages[len(r.pages)-1].ID
+	}
+	r.entries = append(r.entries, entry)
+}
+
+// addUpgrade records a WebSocket handshake. The connection then stops
+// speaking HTTP, so only the request and the server's response are archived.
+func (r *HARRecorder) addUpgrade(url string, req *http.Request, resp *http.Response, start time.Time, err error) {
+	if r == nil {
+		return
+	}
+	elapsed := harMillis(time.Since(start))
+	entry := &HAREntry{
+		StartedDateTime: start,
+		Time:            elapsed,
+		Request: HARRequest{
+			Method:      req.Method,
+			URL:         url,
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     harCookies(req.Cookies()),
+			Headers:     harHeaders(req.Header),
+			QueryString: harQuery(req),
+			HeadersSize: -1,
+		},
+		Timings: HARTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1, Wait: elapsed},
+		Comment: "WebSocket handshake; messages are not recorded",
+	}
+	if err != nil {
+		entry.Comment = err.Error()
+	}
+	if resp != nil {
+		entry.Response = HARResponse{
+			Status:      resp.StatusCode,
+			StatusText:  strings.TrimSpace(strings.TrimPrefix(resp.Status, fmt.Sprint(resp.StatusCode))),
+			HTTPVersion: resp.Proto,
+			Cookies:     harCookies(resp.Cookies()),
+			Headers:     harHeaders(resp.Header),
+			Content:     HARContent{MimeType: resp.Header.Get("Content-Type")},
+			HeadersSize: -1,
+		}
+	}
+	r.add(entry)
+}
+
+type harTransport struct {
+	recorder *HARRecorder
+	base     http.RoundTripper
+}
+
+type harTrace struct {
+	start, dnsStart, dnsDone, connectStart, connectDone time.Time
+	tlsStart, tlsDone, gotConn, wroteRequest, firstByte time.Time
+}
+
+func (t *harTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorder := t.recorder
+	entry := &HAREntry{StartedDateTime: time.Now()}
+
+	var requestBody []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		requestBody = body
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	entry.Request = HARRequest{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     harCookies(req.Cookies()),
+		Headers:     harHeaders(req.Header),
+		QueryString: harQuery(req),
+		HeadersSize: -1,
+		BodySize:    int64(len(requestBody)),
+	}
+	if requestBody != nil {
+		text, _, comment := recorder.capture(requestBody, int64(len(requestBody)))
+		entry.Request.PostData = &HARPostData{MimeType: req.Header.Get("Content-Type"), Text: text, Comment: comment}
+	}
+
+	trace := &harTrace{start: entry.StartedDateTime}
+	var traceMu sync.Mutex
+	at := func(field *time.Time) {
+		traceMu.Lock()
+		defer traceMu.Unlock()
+		if field.IsZero() {
+			*field = time.Now()
+		}
+	}
+	ctx := httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { at(&trace.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { at(&trace.dnsDone) },
+		ConnectStart:         func(string, string) { at(&trace.connectStart) },
+		ConnectDone:          func(string, string, error) { at(&trace.connectDone) },
+		TLSHandshakeStart:    func() { at(&trace.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { at(&trace.tlsDone) },
+		GotConn:              func(httptrace.GotConnInfo) { at(&trace.gotConn) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { at(&trace.wroteRequest) },
+		GotFirstResponseByte: func() { at(&trace.firstByte) },
+	})
+	req = req.WithContext(ctx)
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		entry.Comment = err.Error()
+		traceMu.Lock()
+		entry.Timings = trace.timings(time.Now())
+		traceMu.Unlock()
+		entry.Time = harMillis(time.Since(entry.StartedDateTime))
+		recorder.add(entry)
+		return nil, err
+	}
+	entry.Request.HTTPVersion = resp.Proto
+	entry.Response = HARResponse{
+		Status:      resp.StatusCode,
+		StatusText:  strings.TrimSpace(strings.TrimPrefix(resp.Status, fmt.Sprint(resp.StatusCode))),
+		HTTPVersion: resp.Proto,
+		Cookies:     harCookies(resp.Cookies()),
+		Headers:     harHeaders(resp.Header),
+		Content:     HARContent{Size: -1, MimeType: resp.Header.Get("Content-Type")},
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	recorder.add(entry)
+	resp.Body = &harBody{ReadCloser: resp.Body, limit: recorder.BodyLimit, finish: func(body []byte, size int64) {
+		traceMu.Lock()
+		timings := trace.timings(time.Now())
+		traceMu.Unlock()
+		text, encoding, comment := recorder.capture(body, size)
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		entry.Timings = timings
+		entry.Time = harMillis(time.Since(entry.StartedDateTime))
+		entry.Response.BodySize = size
+		entry.Response.Content.Size = size
+		entry.Response.Content.Text = text
+		entry.Response.Content.Encoding = encoding
+		entry.Response.Content.Comment = comment
+	}}
+	return resp, nil
+}
+
+// capture renders a body for the archive: text when it is valid UTF-8,
+// base64 otherwise, with a comment when it was cut at the body limit.
+func (r *HARRecorder) capture(body []byte, size int64) (text, encoding, comment string) {
+	if len(body) > r.BodyLimit {
+		body = body[:r.BodyLimit]
+	}
+	if int64(len(body)) < size {
+		comment = fmt.Sprintf("truncated to %d of %d bytes", len(body), size)
+	}
+	if utf8.Valid(body) {
+		return string(body), "", comment
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64", comment
+}
+
+func (t *harTrace) timings(end time.Time) HARTimings {
+	timings := HARTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1}
+	between := func(from, to time.Time) float64 {
+		if from.IsZero() || to.IsZero() {
+			return -1
+		}
+		return harMillis(to.Sub(from))
+	}
+	if !t.dnsStart.IsZero() {
+		timings.DNS = between(t.dnsStart, t.dnsDone)
+	}
+	if !t.connectStart.IsZero() {
+		timings.Connect = between(t.connectStart, t.connectDone)
+		if !t.tlsDone.IsZero() {
+			// HAR counts the TLS handshake as part of connect as well
+			timings.Connect = between(t.connectStart, t.tlsDone)
+		}
+	}
+	if !t.tlsStart.IsZero() {
+		timings.SSL = between(t.tlsStart, t.tlsDone)
+	}
+	if !t.gotConn.IsZero() && t.dnsStart.IsZero() && t.connectStart.IsZero() {
+		timings.Blocked = between(t.start, t.gotConn)
+	}
+	timings.Send = max(between(t.gotConn, t.wroteRequest), 0)
+	timings.Wait = max(between(t.wroteRequest, t.firstByte), 0)
+	timings.Receive = max(between(t.firstByte, end), 0)
+	return timings
+}
+
+type harBody struct {
+	io.ReadCloser
+	limit  int
+	buf    []byte
+	size   int64
+	once   sync.Once
+	finish func(body []byte, size int64)
+}
+
+func (b *harBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	if room := b.limit + 1 - len(b.buf); room > 0 {
+		b.buf = append(b.buf, p[:min(n, room)]...)
+	}
+	if err == io.EOF {
+		b.done()
+	}
+	return n, err
+}
+
+func (b *harBody) Close() error {
+	b.done()
+	return b.ReadCloser.Close()
+}
+
+func (b *harBody) done() {
+	b.once.Do(func() { b.finish(b.buf, b.size) })
+}
+
+func harHeaders(header http.Header) []HARNameValue {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	values := []HARNameValue{}
+	for _, name := range names {
+		for _, value := range header[name] {
+			values = append(values, HARNameValue{Name: name, Value: value})
+		}
+	}
+	return values
+}
+
+func harCookies(cookies []*http.Cookie) []HARNameValue {
+	values := []HARNameValue{}
+	for _, cookie := range cookies {
+		values = append(values, HARNameValue{Name: cookie.Name, Value: cookie.Value})
+	}
+	return values
+}
+
+func harQuery(req *http.Request) []HARNameValue {
+	query := req.URL.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	values := []HARNameValue{}
+	for _, name := range names {
+		for _, value := range query[name] {
+			values = append(values, HARNameValue{Name: name, Value: value})
+		}
+	}
+	return values
+}
+
+func harMillis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// HTTPClient returns a client whose exchanges are written to the run's HAR file.
+func (c *ServerTestConfig) HTTPClient() *http.Client {
+	if c.HAR == nil {
+		return &http.Client{}
+	}
+	return c.HAR.Client()
+}
+
+// HTTPSClient is like HTTPClient but trusts the run's certificate authority.
+// Without TLS material it trusts the system's roots.
+func (c *ServerTestConfig) HTTPSClient() *http.Client {
+	client := &http.Client{Timeout: 10 * time.Second, Transport: http.DefaultTransport.(*http.Transport).Clone()}
+	if c.TLS != nil {
+		client = c.TLS.HTTPSClient()
+	}
+	if c.HAR != nil {
+		client.Transport = c.HAR.Transport(client.Transport)
+	}
+	return client
+}
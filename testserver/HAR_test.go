@@ -0,0 +1,250 @@
+package testserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/buildium-org/buildium_harness/logger"
+	"github.com/buildium-org/buildium_harness/meta"
+)
+
+func newHARTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/echo":
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write(body)
+		case "/binary":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte{0xff, 0x00, 0xfe})
+		case "/large":
+			io.WriteString(w, strings.Repeat("x", 100))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestHARRecorderRecordsExchanges(t *testing.T) {
+	server := newHARTestServer()
+	defer server.Close()
+
+	recorder := NewHARRecorder()
+	recorder.StartPage("step_0", "Step 0")
+	client := recorder.Client()
+
+	resp, err := client.Post(server.URL+"/echo?name=ada&name=bob", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("Post() error = %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hello" {
+		t.Errorf("body = %q, the recorder should not alter it", body)
+	}
+
+	entries := recorder.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("recorded %d entries, want 1", len(entries))
+	}
+	entry := entries[0]
+	if entry.PageRef != "step_0" || entry.Request.Method != "POST" || entry.Response.Status != 200 {
+		t.Errorf("entry = %+v", entry)
+	}
+	if entry.Request.PostData == nil || entry.Request.PostData.Text != "hello" || entry.Request.BodySize != 5 {
+		t.Errorf("request postData = %+v, bodySize = %d", entry.Request.PostData, entry.Request.BodySize)
+	}
+	if len(entry.Request.QueryString) != 2 || entry.Request.QueryString[1].Value != "bob" {
+		t.Errorf("queryString = %v", entry.Request.QueryString)
+	}
+	if entry.Response.Content.Text != "hello" || entry.Response.Content.Size != 5 || entry.Response.StatusText != "OK" {
+		t.Errorf("response = %+v", entry.Response)
+	}
+	if entry.Timings.Send < 0 || entry.Timings.Wait < 0 || entry.Timings.Receive < 0 || entry.Time <= 0 {
+		t.Errorf("timings = %+v, time = %v", entry.Timings, entry.Time)
+	}
+	if entry.Timings.Connect < 0 {
+		t.Errorf("Connect = %v, want the new connection to be timed", entry.Timings.Connect)
+	}
+}
+
+func TestHARRecorderBodyLimitAndBinary(t *testing.T) {
+	server := newHARTestServer()
+	defer server.Close()
+
+	recorder := NewHARRecorder()
+	recorder.BodyLimit = 10
+	client := recorder.Client()
+	for _, path := range []string{"/large", "/binary"} {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Get(%s) error = %v", path, err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	entries := recorder.Entries()
+	large := entries[0].Response.Content
+	if large.Text != strings.Repeat("x", 10) || large.Size != 100 || large.Comment != "truncated to 10 of 100 bytes" {
+		t.Errorf("large content = %+v", large)
+	}
+	binary := entries[1].Response.Content
+	if binary.Encoding != "base64" || binary.Text != "/wD+" {
+		t.Errorf("binary content = %+v", binary)
+	}
+}
+
+func TestHARRecorderRecordsTransportErrors(t *testing.T) {
+	recorder := NewHARRecorder()
+	if _, err := recorder.Client().Get("http://127.0.0.1:1/"); err == nil {
+		t.Fatal("Get() should fail")
+	}
+	entries := recorder.Entries()
+	if len(entries) != 1 || entries[0].Comment == "" {
+		t.Errorf("entries = %+v, want one entry with the error", entries)
+	}
+}
+
+func TestHARRecordsStreamsAndUpgrades(t *testing.T) {
+	sseServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: hello\n\n")
+	}))
+	defer sseServer.Close()
+	wsUrl := newWebSocketTestServer(t)
+
+	recorder := NewHARRecorder()
+	recorder.StartPage("step-0", "Streams")
+	config := &ServerTestConfig{Logger: logger.NewLogger(), HAR: recorder}
+	stream, err := config.OpenSSE(sseServer.URL)
+	if err != nil {
+		t.Fatalf("OpenSSE() error = %v", err)
+	}
+	if _, err := stream.Next(time.Second); err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if _, err := config.DialWebSocket(wsUrl + "/chat"); err != nil {
+		t.Fatalf("DialWebSocket() error = %v", err)
+	}
+	config.runCleanups()
+
+	entries := recorder.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("recorded %d entries, want the stream and the handshake", len(entries))
+	}
+	if entries[0].Response.Content.Text != "data: hello\n\n" {
+		t.Errorf("stream entry = %+v, want the event stream body", entries[0].Response)
+	}
+	if entries[1].Request.URL != wsUrl+"/chat" || entries[1].Response.Status != http.StatusSwitchingProtocols || entries[1].PageRef != "step-0" {
+		t.Errorf("handshake entry = %+v, want a 101 response for %s", entries[1], wsUrl)
+	}
+}
+
+func TestHTTPSClientWithoutTLS(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	har := NewHARRecorder()
+	har.StartPage("step-0", "Step 0")
+	client := (&ServerTestConfig{HAR: har}).HTTPSClient()
+	if transport := client.Transport.(*harTransport).base.(*http.Transport); transport.TLSClientConfig != nil && transport.TLSClientConfig.RootCAs != nil {
+		t.Error("HTTPSClient() without TLS material should trust the system's roots")
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+	if len(har.Entries()) != 1 {
+		t.Errorf("recorded %d entries, want 1", len(har.Entries()))
+	}
+	if (&ServerTestConfig{}).HTTPSClient() == nil {
+		t.Error("HTTPSClient() = nil without TLS material or a HAR recorder")
+	}
+}
+
+func TestHARRecorderWriteFile(t *testing.T) {
+	server := newHARTestServer()
+	defer server.Close()
+
+	recorder := NewHARRecorder()
+	recorder.StartPage("step_0", "Step 0")
+	resp, err := recorder.Client().Get(server.URL + "/missing")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+
+	path := filepath.Join(t.TempDir(), "run.har")
+	if err := recorder.WriteFile(path); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read HAR: %v", err)
+	}
+	var har HAR
+	if err := json.Unmarshal(data, &har); err != nil {
+		t.Fatalf("HAR is not valid JSON: %v", err)
+	}
+	if har.Log.Version != "1.2" || len(har.Log.Pages) != 1 || len(har.Log.Entries) != 1 {
+		t.Errorf("HAR = %+v", har.Log)
+	}
+	if har.Log.Entries[0].Response.Status != 404 {
+		t.Errorf("status = %d, want 404", har.Log.Entries[0].Response.Status)
+	}
+}
+
+func TestRunWritesHARNextToMeta(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+	t.Setenv("SERVER_STARTUP_TIME", "1")
+	server := newHARTestServer()
+	defer server.Close()
+
+	dir := t.TempDir()
+	if err := os.Symlink("/usr/bin/true", filepath.Join(dir, "true")); err != nil {
+		t.Fatalf("failed to link executable: %v", err)
+	}
+	m := &meta.Meta{Stage: 1, Entrypoint: "true", ExecutableDir: dir, ProjectId: "test-project-123"}
+	steps := []func(config *ServerTestConfig) error{
+		func(config *ServerTestConfig) error {
+			resp, err := config.HTTPClient().Get(server.URL + "/echo")
+			if err != nil {
+				return err
+			}
+			return resp.Body.Close()
+		},
+		func(config *ServerTestConfig) error {
+			resp, err := config.HTTPClient().Get(server.URL + "/missing")
+			if err != nil {
+				return err
+			}
+			return resp.Body.Close()
+		},
+	}
+
+	if err := NewRunner(m, steps, []int{}).Run(newTestContext()); err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, harFileName))
+	if err != nil {
+		t.Fatalf("HAR was not written: %v", err)
+	}
+	var har HAR
+	if err := json.Unmarshal(data, &har); err != nil {
+		t.Fatalf("HAR is not valid JSON: %v", err)
+	}
+	if len(har.Log.Entries) != 2 || har.Log.Entries[0].PageRef != "step-0" || har.Log.Entries[1].PageRef != "step-1" {
+		t.Errorf("entries = %+v, want one per step", har.Log.Entries)
+	}
+}
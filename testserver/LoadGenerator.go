@@ -0,0 +1,262 @@
+package testserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/buildium-org/buildium_harness/logger"
+)
+
+// LoadTest drives Clients concurrent workers calling Do, either for Duration or
+// until Requests calls have been made in total.
+type LoadTest struct {
+	Clients  int
+	Duration time.Duration
+	Requests int
+	Do       func(ctx context.Context) error
+}
+
+type LoadReport struct {
+	Clients    int
+	Requests   int
+	Errors     int
+	Elapsed    time.Duration
+	Throughput float64
+	ErrorRate  float64
+	Mean       time.Duration
+	P50        time.Duration
+	P95        time.Duration
+	P99        time.Duration
+	Max        time.Duration
+	// ErrorSamples holds up to five distinct error messages seen during the run.
+	ErrorSamples []string
+}
+
+// SLO fields left at zero are not checked, except MaxErrorRate where zero means
+// no errors are allowed.
+type SLO struct {
+	P50           time.Duration
+	P95           time.Duration
+	P99           time.Duration
+	MaxErrorRate  float64
+	MinThroughput float64
+}
+
+type loadSample struct {
+	latency time.Duration
+	err     error
+}
+
+func RunLoad(ctx context.Context, test LoadTest) (*LoadReport, error) {
+	if test.Clients <= 0 {
+		return nil, fmt.Errorf("load test needs at least one client")
+	}
+	if test.Duration <= 0 && test.Requests <= 0 {
+		return nil, fmt.Errorf("load test needs a duration or a request count")
+	}
+	if test.Do == nil {
+		return nil, fmt.Errorf("load test has no request function")
+	}
+	if test.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, test.Duration)
+		defer cancel()
+	}
+
+	var issued atomic.Int64
+	results := make([][]loadSample, test.Clients)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for client := 0; client < test.Clients; client++ {
+		wg.Add(1)
+		go func(client int) {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				if test.Requests > 0 && issued.Add(1) > int64(test.Requests) {
+					return
+				}
+				requestStart := time.Now()
+				err := test.Do(ctx)
+				latency := time.Since(requestStart)
+				// Requests cut off by the end of a timed run are not counted
+				if err != nil && test.Duration > 0 && cutOff(ctx, err) {
+					return
+				}
+				results[client] = append(results[client], loadSample{latency: latency, err: err})
+			}
+		}(client)
+	}
+	wg.Wait()
+	return newLoadReport(test.Clients, time.Since(start), slices.Concat(results...)), nil
+}
+
+// cutOff reports whether err is a timeout caused by ctx's deadline, such as a
+// connection deadline set from it, rather than a slow server.
+func cutOff(ctx context.Context, err error) bool {
+	// Connection deadlines set from ctx can fire just before ctx itself is done
+	if deadline, ok := ctx.Deadline(); ctx.Err() == nil && (!ok || time.Now().Before(deadline)) {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func newLoadReport(clients int, elapsed time.Duration, samples []loadSample) *LoadReport {
+	report := &LoadReport{Clients: clients, Requests: len(samples), Elapsed: elapsed}
+	if len(samples) == 0 {
+		return report
+	}
+	latencies := make([]time.Duration, len(samples))
+	var total time.Duration
+	for i, sample := range samples {
+		latencies[i] = sample.latency
+		total += sample.latency
+		if sample.err != nil {
+			report.Errors++
+			if len(report.ErrorSamples) < 5 && !slices.Contains(report.ErrorSamples, sample.err.Error()) {
+				report.ErrorSamples = append(report.ErrorSamples, sample.err.Error())
+			}
+		}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	report.Mean = total / time.Duration(len(samples))
+	report.P50 = percentile(latencies, 50)
+	report.P95 = percentile(latencies, 95)
+	report.P99 = percentile(latencies, 99)
+	report.Max = latencies[len(latencies)-1]
+	report.ErrorRate = float64(report.Errors) / float64(report.Requests)
+	if elapsed > 0 {
+		report.Throughput = float64(report.Requests) / elapsed.Seconds()
+	}
+	return report
+}
+
+// percentile uses the nearest-rank method on sorted latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank-1, 0)]
+}
+
+func (r *LoadReport) Log(l *logger.Logger) {
+	l.LogInfo(fmt.Sprintf("%-10s %-10s %-8s %-8s %-10s %-10s %-10s %-10s %-10s", "clients", "requests", "errors", "error %", "req/s", "p50", "p95", "p99", "max"))
+	l.LogInfo(fmt.Sprintf("%-10d %-10d %-8d %-8s %-10.1f %-10s %-10s %-10s %-10s", r.Clients, r.Requests, r.Errors, fmt.Sprintf("%.2f%%", r.ErrorRate*100), r.Throughput,
+		roundLatency(r.P50), roundLatency(r.P95), roundLatency(r.P99), roundLatency(r.Max)))
+	for _, sample := range r.ErrorSamples {
+		l.LogError("Load error: " + sample)
+	}
+}
+
+func roundLatency(d time.Duration) string {
+	return d.Round(10 * time.Microsecond).String()
+}
+
+func (r *LoadReport) AssertSLO(slo SLO) error {
+	var errs []error
+	if r.Requests == 0 {
+		return fmt.Errorf("no requests completed during the load test")
+	}
+	if slo.P50 > 0 && r.P50 > slo.P50 {
+		errs = append(errs, fmt.Errorf("p50 latency %v exceeds %v", roundLatency(r.P50), slo.P50))
+	}
+	if slo.P95 > 0 && r.P95 > slo.P95 {
+		errs = append(errs, fmt.Errorf("p95 latency %v exceeds %v", roundLatency(r.P95), slo.P95))
+	}
+	if slo.P99 > 0 && r.P99 > slo.P99 {
+		errs = append(errs, fmt.Errorf("p99 latency %v exceeds %v with %d clients", roundLatency(r.P99), slo.P99, r.Clients))
+	}
+	if r.ErrorRate > slo.MaxErrorRate {
+		errs = append(errs, fmt.Errorf("error rate %.2f%% exceeds %.2f%% (%d of %d requests failed)", r.ErrorRate*100, slo.MaxErrorRate*100, r.Errors, r.Requests))
+	}
+	if slo.MinThroughput > 0 && r.Throughput < slo.MinThroughput {
+		errs = append(errs, fmt.Errorf("throughput %.1f req/s is below %.1f req/s", r.Throughput, slo.MinThroughput))
+	}
+	return errors.Join(errs...)
+}
+
+// HTTPLoad makes one request per call and fails on any status other than expectStatus.
+func HTTPLoad(client *http.Client, method, url string, body []byte, expectStatus int) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+		if resp.StatusCode != expectStatus {
+			return fmt.Errorf("expected status %d, got %d", expectStatus, resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// NewLoadHTTPClient returns a client whose connection pool is sized for clients workers.
+func NewLoadHTTPClient(clients int) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = clients
+	transport.MaxIdleConnsPerHost = clients
+	return &http.Client{Transport: transport, Timeout: 10 * time.Second}
+}
+
+// TCPLoad opens a connection per call, writes payload and expects to read back expect.
+func TCPLoad(addr string, payload []byte, expect []byte) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		} else {
+			conn.SetDeadline(time.Now().Add(10 * time.Second))
+		}
+		if _, err := conn.Write(payload); err != nil {
+			return err
+		}
+		got := make([]byte, len(expect))
+		if _, err := io.ReadFull(conn, got); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if !bytes.Equal(got, expect) {
+			return fmt.Errorf("expected %q, got %q", expect, got)
+		}
+		return nil
+	}
+}
+
+// RunLoad runs test against the user's server, stopping early if the step
+// times out.
+func (c *ServerTestConfig) RunLoad(test LoadTest) (*LoadReport, error) {
+	if test.Duration > 0 {
+		c.Logger.LogInfo(fmt.Sprintf("Running load test with %d clients for %v", test.Clients, test.Duration))
+	} else {
+		c.Logger.LogInfo(fmt.Sprintf("Running load test with %d clients for %d requests", test.Clients, test.Requests))
+	}
+	report, err := RunLoad(c.Context(), test)
+	if err != nil {
+		c.Logger.LogError(err.Error())
+		return nil, err
+	}
+	report.Log(c.Logger)
+	return report, nil
+}
@@ -0,0 +1,250 @@
+package testserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/buildium-org/buildium_harness/logger"
+)
+
+func TestRunLoadRequestCount(t *testing.T) {
+	var calls atomic.Int64
+	report, err := RunLoad(context.Background(), LoadTest{
+		Clients:  4,
+		Requests: 100,
+		Do: func(ctx context.Context) error {
+			calls.Add(1)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("RunLoad() error = %v", err)
+	}
+	if calls.Load() != 100 || report.Requests != 100 {
+		t.Errorf("made %d calls and reported %d requests, want 100", calls.Load(), report.Requests)
+	}
+	if report.Errors != 0 || report.ErrorRate != 0 {
+		t.Errorf("Errors = %d, ErrorRate = %v, want 0", report.Errors, report.ErrorRate)
+	}
+}
+
+func TestRunLoadDuration(t *testing.T) {
+	start := time.Now()
+	report, err := RunLoad(context.Background(), LoadTest{
+		Clients:  2,
+		Duration: 50 * time.Millisecond,
+		Do: func(ctx context.Context) error {
+			time.Sleep(time.Millisecond)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("RunLoad() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("load test ran for %v, want about 50ms", elapsed)
+	}
+	if report.Requests == 0 || report.Throughput == 0 {
+		t.Errorf("Requests = %d, Throughput = %v, want both > 0", report.Requests, report.Throughput)
+	}
+}
+
+func TestRunLoadInvalidConfig(t *testing.T) {
+	noop := func(ctx context.Context) error { return nil }
+	cases := []LoadTest{
+		{Clients: 0, Requests: 1, Do: noop},
+		{Clients: 1, Do: noop},
+		{Clients: 1, Requests: 1},
+	}
+	for _, test := range cases {
+		if _, err := RunLoad(context.Background(), test); err == nil {
+			t.Errorf("RunLoad(%+v) should fail", test)
+		}
+	}
+}
+
+func TestNewLoadReportPercentiles(t *testing.T) {
+	samples := make([]loadSample, 100)
+	for i := range samples {
+		samples[i] = loadSample{latency: time.Duration(i+1) * time.Millisecond}
+	}
+	samples[0].err = errors.New("boom")
+	samples[1].err = errors.New("boom")
+
+	report := newLoadReport(10, time.Second, samples)
+	if report.P50 != 50*time.Millisecond || report.P95 != 95*time.Millisecond || report.P99 != 99*time.Millisecond {
+		t.Errorf("p50/p95/p99 = %v/%v/%v, want 50ms/95ms/99ms", report.P50, report.P95, report.P99)
+	}
+	if report.Max != 100*time.Millisecond {
+		t.Errorf("Max = %v, want 100ms", report.Max)
+	}
+	if report.Errors != 2 || report.ErrorRate != 0.02 {
+		t.Errorf("Errors = %d, ErrorRate = %v, want 2 and 0.02", report.Errors, report.ErrorRate)
+	}
+	if len(report.ErrorSamples) != 1 {
+		t.Errorf("ErrorSamples = %v, want one distinct message", report.ErrorSamples)
+	}
+	if report.Throughput != 100 {
+		t.Errorf("Throughput = %v, want 100", report.Throughput)
+	}
+}
+
+func TestLoadReportAssertSLO(t *testing.T) {
+	report := &LoadReport{Clients: 100, Requests: 1000, Errors: 5, ErrorRate: 0.005, P99: 80 * time.Millisecond, Throughput: 500}
+
+	if err := report.AssertSLO(SLO{P99: 100 * time.Millisecond, MaxErrorRate: 0.01}); err != nil {
+		t.Errorf("AssertSLO() error = %v, want nil", err)
+	}
+	if err := report.AssertSLO(SLO{P99: 50 * time.Millisecond, MaxErrorRate: 0.01}); err == nil {
+		t.Error("AssertSLO() should fail when p99 is too high")
+	}
+	if err := report.AssertSLO(SLO{P99: 100 * time.Millisecond}); err == nil {
+		t.Error("AssertSLO() should fail on errors when MaxErrorRate is zero")
+	}
+	if err := report.AssertSLO(SLO{MaxErrorRate: 0.01, MinThroughput: 1000}); err == nil {
+		t.Error("AssertSLO() should fail when throughput is too low")
+	}
+}
+
+func TestHTTPLoad(t *testing.T) {
+	var hits atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1)%10 == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+
+	report, err := RunLoad(context.Background(), LoadTest{
+		Clients:  5,
+		Requests: 50,
+		Do:       HTTPLoad(NewLoadHTTPClient(5), "GET", server.URL, nil, http.StatusOK),
+	})
+	if err != nil {
+		t.Fatalf("RunLoad() error = %v", err)
+	}
+	if report.Requests != 50 || report.Errors != 5 {
+		t.Errorf("Requests = %d, Errors = %d, want 50 and 5", report.Requests, report.Errors)
+	}
+}
+
+func TestTCPLoad(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.CopyN(conn, conn, 4)
+			}()
+		}
+	}()
+
+	report, err := RunLoad(context.Background(), LoadTest{
+		Clients:  3,
+		Requests: 30,
+		Do:       TCPLoad(listener.Addr().String(), []byte("ping"), []byte("ping")),
+	})
+	if err != nil {
+		t.Fatalf("RunLoad() error = %v", err)
+	}
+	if err := report.AssertSLO(SLO{P99: time.Second}); err != nil {
+		t.Errorf("AssertSLO() error = %v", err)
+	}
+}
+
+func TestTCPLoadCutOffAtTheDeadline(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+	// The server never answers, so every request is still waiting at the deadline
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	// A hand-written request returns the connection's deadline error as is
+	rawTCP := func(ctx context.Context) error {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		deadline, _ := ctx.Deadline()
+		conn.SetDeadline(deadline)
+		conn.Write([]byte("ping"))
+		_, err = io.ReadFull(conn, make([]byte, 4))
+		return err
+	}
+	for name, do := range map[string]func(ctx context.Context) error{
+		"TCPLoad": TCPLoad(listener.Addr().String(), []byte("ping"), []byte("ping")),
+		"raw":     rawTCP,
+	} {
+		report, err := RunLoad(context.Background(), LoadTest{Clients: 4, Duration: 50 * time.Millisecond, Do: do})
+		if err != nil {
+			t.Fatalf("RunLoad() error = %v", err)
+		}
+		if report.Errors != 0 {
+			t.Errorf("%s: report has %d errors %v, want requests cut off by the deadline left out", name, report.Errors, report.ErrorSamples)
+		}
+	}
+}
+
+func TestConfigRunLoadStopsWithStep(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	config := &ServerTestConfig{Logger: logger.NewLogger(), ctx: ctx}
+
+	start := time.Now()
+	report, err := config.RunLoad(LoadTest{
+		Clients:  2,
+		Duration: 10 * time.Second,
+		Do: func(ctx context.Context) error {
+			time.Sleep(time.Millisecond)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("RunLoad() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second || report.Requests == 0 {
+		t.Errorf("RunLoad() took %v for %d requests, want it to stop with the step's context", elapsed, report.Requests)
+	}
+}
+
+func TestLoadReportLogIncludesErrorRate(t *testing.T) {
+	before := len(logger.GetAllLogs())
+	report := newLoadReport(1, time.Second, []loadSample{{latency: time.Millisecond}, {latency: time.Millisecond, err: errors.New("500")}})
+	report.Log(logger.NewLogger())
+	logs := logger.GetAllLogs()[before:]
+	if !strings.Contains(logs[0].Message, "error %") || !strings.Contains(logs[1].Message, "50.00%") {
+		t.Errorf("logs = %+v, want an error rate column", logs)
+	}
+}
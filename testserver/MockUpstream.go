@@ -0,0 +1,256 @@
+package testserver
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+type MockResponse struct {
+	Status  int
+	Headers map[string]string
+	Body    string
+	Latency time.Duration
+	// Fail drops the connection without sending a response.
+	Fail bool
+}
+
+type RecordedRequest struct {
+	Method     string
+	Path       string
+	Query      string
+	Header     http.Header
+	Body       []byte
+	ReceivedAt time.Time
+	Matched    bool
+}
+
+func (r RecordedRequest) String() string {
+	return r.Method + " " + r.Path
+}
+
+// MockUpstream is a local HTTP service the user's server is expected to call.
+// Responses are scripted per route and every request received is recorded.
+type MockUpstream struct {
+	Name     string
+	URL      string
+	server   *httptest.Server
+	mu       sync.Mutex
+	routes   map[string][]MockResponse
+	served   map[string]int
+	requests []RecordedRequest
+}
+
+func NewMockUpstream(name string) *MockUpstream {
+	m := &MockUpstream{Name: name, routes: map[string][]MockResponse{}, served: map[string]int{}}
+	m.server = httptest.NewServer(http.HandlerFunc(m.serveHTTP))
+	m.URL = m.server.URL
+	return m
+}
+
+// On scripts the responses for a route. Responses are served in order and the
+// last one repeats once the script runs out.
+func (m *MockUpstream) On(method, path string, responses ...MockResponse) *MockUpstream {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.routes[method+" "+path] = responses
+	return m
+}
+
+// EnvName is the variable the upstream's URL is passed to the user's server in,
+// e.g. BUILDIUM_UPSTREAM_PAYMENTS_URL for "payments".
+func (m *MockUpstream) EnvName() string {
+	return "BUILDIUM_UPSTREAM_" + strings.ToUpper(nonAlphanumeric.ReplaceAllString(m.Name, "_")) + "_URL"
+}
+
+var nonAlphanumeric = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+func (m *MockUpstream) Requests() []RecordedRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]RecordedRequest{}, m.requests...)
+}
+
+func (m *MockUpstream) Close() {
+	m.server.CloseClientConnections()
+	m.server.Close()
+}
+
+func (m *MockUpstream) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	key := r.Method + " " + r.URL.Path
+
+	m.mu.Lock()
+	responses, ok := m.routes[key]
+	m.requests = append(m.requests, RecordedRequest{
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Query:      r.URL.RawQuery,
+		Header:     r.Header.Clone(),
+		Body:       body,
+		ReceivedAt: time.Now(),
+		Matched:    ok && len(responses) > 0,
+	})
+	var response MockResponse
+	if ok && len(responses) > 0 {
+		response = responses[min(m.served[key], len(responses)-1)]
+		m.served[key]++
+	}
+	m.mu.Unlock()
+
+	if !ok || len(responses) == 0 {
+		http.Error(w, fmt.Sprintf("mock upstream %q has no response for %s", m.Name, key), http.StatusNotImplemented)
+		return
+	}
+	if response.Latency > 0 {
+		select {
+		case <-time.After(response.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if response.Fail {
+		if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+			conn.Close()
+		}
+		return
+	}
+	for name, value := range response.Headers {
+		w.Header().Set(name, value)
+	}
+	status := response.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, response.Body)
+}
+
+func (m *MockUpstream) matching(method, path string) []RecordedRequest {
+	var matches []RecordedRequest
+	for _, request := range m.Requests() {
+		if request.Method == method && request.Path == path {
+			matches = append(matches, request)
+		}
+	}
+	return matches
+}
+
+func (m *MockUpstream) AssertRequested(method, path string) error {
+	if len(m.matching(method, path)) == 0 {
+		return fmt.Errorf("expected %s %s to be called on %s, received: %s", method, path, m.Name, m.describeRequests())
+	}
+	return nil
+}
+
+func (m *MockUpstream) AssertRequestCount(method, path string, count int) error {
+	if got := len(m.matching(method, path)); got != count {
+		return fmt.Errorf("expected %s %s to be called %d times on %s, got %d", method, path, count, m.Name, got)
+	}
+	return nil
+}
+
+func (m *MockUpstream) AssertTotalRequests(count int) error {
+	if got := len(m.Requests()); got != count {
+		return fmt.Errorf("expected %d requests to %s, got %d: %s", count, m.Name, got, m.describeRequests())
+	}
+	return nil
+}
+
+// AssertRequestOrder checks the requests received, in order, were exactly calls
+// such as "GET /users" and "POST /audit".
+func (m *MockUpstream) AssertRequestOrder(calls ...string) error {
+	requests := m.Requests()
+	if len(requests) != len(calls) {
+		return fmt.Errorf("expected %d requests to %s, got %d: %s", len(calls), m.Name, len(requests), m.describeRequests())
+	}
+	for i, request := range requests {
+		if request.String() != calls[i] {
+			return fmt.Errorf("request %d to %s: expected %s, got %s", i, m.Name, calls[i], request)
+		}
+	}
+	return nil
+}
+
+// AssertHeader checks every matching request carried header with value.
+func (m *MockUpstream) AssertHeader(method, path, header, value string) error {
+	matches := m.matching(method, path)
+	if len(matches) == 0 {
+		return fmt.Errorf("expected %s %s to be called on %s", method, path, m.Name)
+	}
+	for i, request := range matches {
+		if got := request.Header.Get(header); got != value {
+			return fmt.Errorf("%s %s call %d to %s: expected header %s %q, got %q", method, path, i, m.Name, header, value, got)
+		}
+	}
+	return nil
+}
+
+// AssertBody checks every matching request had exactly body.
+func (m *MockUpstream) AssertBody(method, path, body string) error {
+	matches := m.matching(method, path)
+	if len(matches) == 0 {
+		return fmt.Errorf("expected %s %s to be called on %s", method, path, m.Name)
+	}
+	for i, request := range matches {
+		if string(request.Body) != body {
+			return fmt.Errorf("%s %s call %d to %s: expected body %q, got %q", method, path, i, m.Name, body, request.Body)
+		}
+	}
+	return nil
+}
+
+func (m *MockUpstream) AssertNoUnexpectedRequests() error {
+	var unexpected []string
+	for _, request := range m.Requests() {
+		if !request.Matched {
+			unexpected = append(unexpected, request.String())
+		}
+	}
+	if len(unexpected) > 0 {
+		return fmt.Errorf("unexpected requests to %s: %s", m.Name, strings.Join(unexpected, ", "))
+	}
+	return nil
+}
+
+func (m *MockUpstream) describeRequests() string {
+	requests := m.Requests()
+	if len(requests) == 0 {
+		return "no requests"
+	}
+	calls := make([]string, len(requests))
+	for i, request := range requests {
+		calls[i] = request.String()
+	}
+	return strings.Join(calls, ", ")
+}
+
+// MockUpstream starts a mock service for the rest of the step and passes its URL
+// to the user's server. Call RestartServer once all upstreams are configured so
+// the server sees the new environment.
+func (c *ServerTestConfig) MockUpstream(name string) *MockUpstream {
+	upstream := NewMockUpstream(name)
+	c.Logger.LogInfo(fmt.Sprintf("Started mock upstream %q at %s (%s)", name, upstream.URL, upstream.EnvName()))
+	c.Server.SetEnv(upstream.EnvName(), upstream.URL)
+	c.addCleanup(func() {
+		c.Server.UnsetEnv(upstream.EnvName())
+		upstream.Close()
+	})
+	return upstream
+}
+
+func (c *ServerTestConfig) RestartServer() error {
+	c.Logger.LogInfo("Restarting server")
+	c.Server.Restart()
+	serverStartupTime, err := getServerStartupTime()
+	if err != nil {
+		return err
+	}
+	time.Sleep(serverStartupTime)
+	return nil
+}
@@ -0,0 +1,197 @@
+package testserver
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/buildium-org/buildium_harness/logger"
+	"github.com/buildium-org/buildium_harness/meta"
+)
+
+func TestMockUpstreamScriptedResponses(t *testing.T) {
+	upstream := NewMockUpstream("payments").On("POST", "/charge",
+		MockResponse{Status: 503, Body: "busy"},
+		MockResponse{Status: 200, Headers: map[string]string{"Content-Type": "application/json"}, Body: `{"ok":true}`},
+	)
+	defer upstream.Close()
+
+	statuses := []int{}
+	for i := 0; i < 3; i++ {
+		resp, err := http.Post(upstream.URL+"/charge", "application/json", strings.NewReader(`{"amount":5}`))
+		if err != nil {
+			t.Fatalf("Post() error = %v", err)
+		}
+		resp.Body.Close()
+		statuses = append(statuses, resp.StatusCode)
+	}
+	if statuses[0] != 503 || statuses[1] != 200 || statuses[2] != 200 {
+		t.Errorf("statuses = %v, want [503 200 200]", statuses)
+	}
+
+	if err := upstream.AssertRequestCount("POST", "/charge", 3); err != nil {
+		t.Error(err)
+	}
+	if err := upstream.AssertBody("POST", "/charge", `{"amount":5}`); err != nil {
+		t.Error(err)
+	}
+	if err := upstream.AssertHeader("POST", "/charge", "Content-Type", "application/json"); err != nil {
+		t.Error(err)
+	}
+	if err := upstream.AssertNoUnexpectedRequests(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMockUpstreamUnexpectedRequest(t *testing.T) {
+	upstream := NewMockUpstream("users")
+	defer upstream.Close()
+
+	resp, err := http.Get(upstream.URL + "/missing")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotImplemented {
+		t.Errorf("StatusCode = %d, want %d", resp.StatusCode, http.StatusNotImplemented)
+	}
+	if err := upstream.AssertNoUnexpectedRequests(); err == nil {
+		t.Error("AssertNoUnexpectedRequests() should fail for an unscripted route")
+	}
+	if err := upstream.AssertRequested("GET", "/other"); err == nil {
+		t.Error("AssertRequested() should fail for a route that was not called")
+	}
+}
+
+func TestMockUpstreamRequestOrder(t *testing.T) {
+	upstream := NewMockUpstream("api").On("GET", "/a", MockResponse{}).On("GET", "/b", MockResponse{})
+	defer upstream.Close()
+
+	for _, path := range []string{"/a", "/b", "/a"} {
+		resp, err := http.Get(upstream.URL + path)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		resp.Body.Close()
+	}
+	if err := upstream.AssertRequestOrder("GET /a", "GET /b", "GET /a"); err != nil {
+		t.Error(err)
+	}
+	if err := upstream.AssertRequestOrder("GET /a", "GET /a", "GET /b"); err == nil {
+		t.Error("AssertRequestOrder() should fail for the wrong order")
+	}
+	if err := upstream.AssertTotalRequests(3); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMockUpstreamLatencyAndFailure(t *testing.T) {
+	upstream := NewMockUpstream("slow").
+		On("GET", "/slow", MockResponse{Latency: 50 * time.Millisecond, Body: "done"}).
+		On("GET", "/broken", MockResponse{Fail: true})
+	defer upstream.Close()
+
+	start := time.Now()
+	resp, err := http.Get(upstream.URL + "/slow")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("response arrived before the scripted latency")
+	}
+	if string(body) != "done" {
+		t.Errorf("body = %q, want %q", body, "done")
+	}
+
+	if _, err := http.Get(upstream.URL + "/broken"); err == nil {
+		t.Error("Get() should fail when the upstream drops the connection")
+	}
+}
+
+func TestMockUpstreamEnvName(t *testing.T) {
+	upstream := NewMockUpstream("user-service")
+	defer upstream.Close()
+
+	if upstream.EnvName() != "BUILDIUM_UPSTREAM_USER_SERVICE_URL" {
+		t.Errorf("EnvName() = %q, want %q", upstream.EnvName(), "BUILDIUM_UPSTREAM_USER_SERVICE_URL")
+	}
+}
+
+func TestRunMockUpstreamPassedToServer(t *testing.T) {
+	// Set ENVIRONMENT to BUILDING to disable supabase calls
+	originalEnv := os.Getenv("ENVIRONMENT")
+	os.Setenv("ENVIRONMENT", "BUILDING")
+	defer os.Setenv("ENVIRONMENT", originalEnv)
+
+	// Use a very short startup time for tests
+	originalStartup := os.Getenv("SERVER_STARTUP_TIME")
+	os.Setenv("SERVER_STARTUP_TIME", "50")
+	defer os.Setenv("SERVER_STARTUP_TIME", originalStartup)
+
+	dir := t.TempDir()
+	outFile := filepath.Join(dir, "upstream.txt")
+	script := "#!/bin/sh\n[ -n \"$BUILDIUM_UPSTREAM_PAYMENTS_URL\" ] && echo \"$BUILDIUM_UPSTREAM_PAYMENTS_URL\" >> " + outFile + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "server"), []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write server script: %v", err)
+	}
+
+	m := &meta.Meta{
+		Stage:         1,
+		Entrypoint:    "server",
+		ExecutableDir: dir,
+		ProjectId:     "test-project-123",
+	}
+
+	var upstreamURL string
+	var envAfterStep []string
+	steps := []func(config *ServerTestConfig) error{
+		func(config *ServerTestConfig) error {
+			upstreamURL = config.MockUpstream("payments").URL
+			return config.RestartServer()
+		},
+		func(config *ServerTestConfig) error {
+			envAfterStep = config.Server.env
+			return nil
+		},
+	}
+
+	runner := NewRunner(m, steps, []int{})
+	err := runner.Run(newTestContext())
+	if err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+
+	written, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("server did not write its environment: %v", err)
+	}
+	if strings.TrimSpace(string(written)) != upstreamURL {
+		t.Errorf("server saw upstream URL %q, want %q", strings.TrimSpace(string(written)), upstreamURL)
+	}
+	for _, entry := range envAfterStep {
+		if strings.HasPrefix(entry, "BUILDIUM_UPSTREAM_PAYMENTS_URL=") {
+			t.Error("upstream env var should be removed after the step that created it")
+		}
+	}
+}
+
+func TestTestServerSetEnvReplaces(t *testing.T) {
+	server := NewTestServer("/usr/bin/true", logger.NewLogger())
+	server.SetEnv("KEY", "one")
+	server.SetEnv("KEY", "two")
+	server.SetEnv("OTHER", "x")
+
+	if len(server.env) != 2 || server.env[0] != "KEY=two" {
+		t.Errorf("env = %v, want [KEY=two OTHER=x]", server.env)
+	}
+	server.UnsetEnv("KEY")
+	if len(server.env) != 1 || server.env[0] != "OTHER=x" {
+		t.Errorf("env after UnsetEnv = %v, want [OTHER=x]", server.env)
+	}
+}
@@ -0,0 +1,570 @@
+package testserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/buildium-org/buildium_harness/jsonschema"
+	"github.com/buildium-org/buildium_harness/logger"
+)
+
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// OpenAPISpec is an OpenAPI 3 document in JSON form.
+type OpenAPISpec struct {
+	doc        map[string]any
+	basePath   string
+	Operations []*OpenAPIOperation
+}
+
+type OpenAPIOperation struct {
+	ID          string
+	Method      string
+	Path        string
+	Pointer     string
+	Parameters  []map[string]any
+	RequestBody map[string]any
+	Responses   map[string]any
+	pattern     *regexp.Regexp
+	paramCount  int
+}
+
+type ContractViolation struct {
+	OperationID string
+	// Pointer locates the problem: a JSON pointer into the response body for
+	// schema errors, or into the OpenAPI document otherwise.
+	Pointer string
+	Message string
+}
+
+func (v ContractViolation) String() string {
+	pointer := v.Pointer
+	if pointer == "" {
+		pointer = "/"
+	}
+	return fmt.Sprintf("[%s] %s: %s", v.OperationID, pointer, v.Message)
+}
+
+func LoadOpenAPI(path string) (*OpenAPISpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OpenAPI document: %v", err)
+	}
+	return ParseOpenAPI(data)
+}
+
+func ParseOpenAPI(data []byte) (*OpenAPISpec, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI document (only JSON is supported): %v", err)
+	}
+	version, _ := doc["openapi"].(string)
+	if !strings.HasPrefix(version, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version %q, expected 3.x", version)
+	}
+	spec := &OpenAPISpec{doc: doc}
+	if servers, ok := doc["servers"].([]any); ok && len(servers) > 0 {
+		if server, ok := servers[0].(map[string]any); ok {
+			if serverUrl, ok := server["url"].(string); ok {
+				if u, err := url.Parse(serverUrl); err == nil {
+					spec.basePath = strings.TrimSuffix(u.Path, "/")
+				}
+			}
+		}
+	}
+
+	paths, _ := doc["paths"].(map[string]any)
+	for path, item := range paths {
+		pathItem, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		sharedParams, _ := pathItem["parameters"].([]any)
+		for _, method := range openAPIMethods {
+			raw, ok := pathItem[method].(map[string]any)
+			if !ok {
+				continue
+			}
+			op := &OpenAPIOperation{
+				Method:  strings.ToUpper(method),
+				Path:    path,
+				Pointer: "/paths/" + jsonschema.EscapePointer(path) + "/" + method,
+			}
+			op.ID, _ = raw["operationId"].(string)
+			if op.ID == "" {
+				op.ID = op.Method + " " + path
+			}
+			for _, param := range append(append([]any{}, sharedParams...), asSlice(raw["parameters"])...) {
+				if resolved, err := spec.resolveObject(param); err == nil {
+					op.Parameters = append(op.Parameters, resolved)
+				}
+			}
+			if body, err := spec.resolveObject(raw["requestBody"]); err == nil {
+				op.RequestBody = body
+			}
+			op.Responses, _ = raw["responses"].(map[string]any)
+			op.pattern, op.paramCount = pathPattern(path)
+			spec.Operations = append(spec.Operations, op)
+		}
+	}
+	// Literal paths win over templated ones, e.g. /users/me before /users/{id}
+	sort.SliceStable(spec.Operations, func(i, j int) bool {
+		if spec.Operations[i].paramCount != spec.Operations[j].paramCount {
+			return spec.Operations[i].paramCount < spec.Operations[j].paramCount
+		}
+		return spec.Operations[i].Pointer < spec.Operations[j].Pointer
+	})
+	return spec, nil
+}
+
+func pathPattern(path string) (*regexp.Regexp, int) {
+	count := 0
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" {
+			continue
+		}
+		pattern.WriteString("/")
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			pattern.WriteString("[^/]+")
+			count++
+		} else {
+			pattern.WriteString(regexp.QuoteMeta(segment))
+		}
+	}
+	if pattern.Len() == 1 {
+		pattern.WriteString("/")
+	}
+	pattern.WriteString("$")
+	return regexp.MustCompile(pattern.String()), count
+}
+
+func (s *OpenAPISpec) FindOperation(method, path string) *OpenAPIOperation {
+	path = strings.TrimPrefix(path, s.basePath)
+	if path == "" {
+		path = "/"
+	}
+	for _, op := range s.Operations {
+		if op.Method == method && op.pattern.MatchString(path) {
+			return op
+		}
+	}
+	return nil
+}
+
+// CheckResponse validates a response captured for method and path against the
+// documented status codes, content types, headers and body schema.
+func (s *OpenAPISpec) CheckResponse(method, path string, resp *http.Response, body []byte) []ContractViolation {
+	op := s.FindOperation(method, path)
+	if op == nil {
+		return []ContractViolation{{OperationID: method + " " + path, Message: "no operation in the OpenAPI document matches this request"}}
+	}
+	var violations []ContractViolation
+	add := func(pointer, format string, args ...any) {
+		violations = append(violations, ContractViolation{OperationID: op.ID, Pointer: pointer, Message: fmt.Sprintf(format, args...)})
+	}
+
+	code, response := op.findResponse(resp.StatusCode)
+	if response == nil {
+		add(op.Pointer+"/responses", "status %d is not documented", resp.StatusCode)
+		return violations
+	}
+	responsePointer := op.Pointer + "/responses/" + code
+	resolved, err := s.resolveObject(response)
+	if err != nil {
+		add(responsePointer, "%v", err)
+		return violations
+	}
+
+	headers, _ := resolved["headers"].(map[string]any)
+	for name, raw := range headers {
+		header, err := s.resolveObject(raw)
+		if err != nil {
+			continue
+		}
+		if header["required"] == true && resp.Header.Get(name) == "" {
+			add(responsePointer+"/headers/"+jsonschema.EscapePointer(name), "missing required header %s", name)
+		}
+	}
+
+	content, _ := resolved["content"].(map[string]any)
+	if len(content) == 0 {
+		if len(body) > 0 {
+			add(responsePointer, "response has a %d byte body but no content is documented", len(body))
+		}
+		return violations
+	}
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	key, media := matchMediaType(content, mediaType)
+	if media == nil {
+		documented := make([]string, 0, len(content))
+		for name := range content {
+			documented = append(documented, name)
+		}
+		sort.Strings(documented)
+		add(responsePointer+"/content", "Content-Type %q is not one of %s", contentType, strings.Join(documented, ", "))
+		return violations
+	}
+	mediaObject, _ := media.(map[string]any)
+	schema, ok := mediaObject["schema"]
+	if !ok || !isJSONMediaType(mediaType) {
+		return violations
+	}
+	var instance any
+	if err := json.Unmarshal(body, &instance); err != nil {
+		add(responsePointer+"/content/"+jsonschema.EscapePointer(key), "response body is not valid JSON: %v", err)
+		return violations
+	}
+	validator, err := jsonschema.New(schema, s.doc)
+	if err != nil {
+		add(responsePointer+"/content/"+jsonschema.EscapePointer(key)+"/schema", "%v", err)
+		return violations
+	}
+	for _, schemaErr := range validator.Validate(instance) {
+		add(schemaErr.InstancePath, "%s", schemaErr.Message)
+	}
+	return violations
+}
+
+func (op *OpenAPIOperation) findResponse(status int) (string, any) {
+	code := strconv.Itoa(status)
+	if response, ok := op.Responses[code]; ok {
+		return code, response
+	}
+	for _, wildcard := range []string{code[:1] + "XX", code[:1] + "xx"} {
+		if response, ok := op.Responses[wildcard]; ok {
+			return wildcard, response
+		}
+	}
+	if response, ok := op.Responses["default"]; ok {
+		return "default", response
+	}
+	return "", nil
+}
+
+func matchMediaType(content map[string]any, mediaType string) (string, any) {
+	if media, ok := content[mediaType]; ok {
+		return mediaType, media
+	}
+	major, _, _ := strings.Cut(mediaType, "/")
+	if media, ok := content[major+"/*"]; ok {
+		return major + "/*", media
+	}
+	if media, ok := content["*/*"]; ok {
+		return "*/*", media
+	}
+	return "", nil
+}
+
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func (s *OpenAPISpec) resolveRef(ref string) (any, error) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported $ref %q, only local references are supported", ref)
+	}
+	var current any = s.doc
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+		current, ok = object[jsonschema.UnescapePointer(token)]
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+	}
+	return current, nil
+}
+
+func (s *OpenAPISpec) resolveObject(value any) (map[string]any, error) {
+	for i := 0; i < 16; i++ {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("expected an object")
+		}
+		ref, ok := object["$ref"].(string)
+		if !ok {
+			return object, nil
+		}
+		resolved, err := s.resolveRef(ref)
+		if err != nil {
+			return nil, err
+		}
+		value = resolved
+	}
+	return nil, fmt.Errorf("$ref chain is too deep")
+}
+
+func asSlice(value any) []any {
+	slice, _ := value.([]any)
+	return slice
+}
+
+// ContractRecorder is an http.RoundTripper that checks every response it sees
+// against the spec.
+type ContractRecorder struct {
+	spec       *OpenAPISpec
+	base       http.RoundTripper
+	mu         sync.Mutex
+	checked    int
+	violations []ContractViolation
+}
+
+func (s *OpenAPISpec) NewRecorder(base http.RoundTripper) *ContractRecorder {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &ContractRecorder{spec: s, base: base}
+}
+
+// Client returns an http.Client whose responses are checked against the spec.
+func (s *OpenAPISpec) Client() (*http.Client, *ContractRecorder) {
+	recorder := s.NewRecorder(nil)
+	return &http.Client{Transport: recorder}, recorder
+}
+
+func (r *ContractRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	violations := r.spec.CheckResponse(req.Method, req.URL.Path, resp, body)
+	r.mu.Lock()
+	r.checked++
+	r.violations = append(r.violations, violations...)
+	r.mu.Unlock()
+	return resp, nil
+}
+
+func (r *ContractRecorder) Violations() []ContractViolation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]ContractViolation{}, r.violations...)
+}
+
+func (r *ContractRecorder) Checked() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.checked
+}
+
+func (r *ContractRecorder) Err() error {
+	return contractError(r.Violations())
+}
+
+func contractError(violations []ContractViolation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d contract violations, first: %s", len(violations), violations[0])
+}
+
+func LogContractViolations(l *logger.Logger, violations []ContractViolation) {
+	for _, violation := range violations {
+		l.LogError("Contract violation " + violation.String())
+	}
+}
+
+// ConformanceRequests builds one request per operation, filling parameters and
+// bodies from examples, defaults or the schema.
+func (s *OpenAPISpec) ConformanceRequests(baseURL string) ([]*http.Request, error) {
+	requests := make([]*http.Request, 0, len(s.Operations))
+	for _, op := range s.Operations {
+		path := op.Path
+		query := url.Values{}
+		header := http.Header{}
+		for _, param := range op.Parameters {
+			name, _ := param["name"].(string)
+			in, _ := param["in"].(string)
+			required, _ := param["required"].(bool)
+			if in != "path" && !required {
+				continue
+			}
+			value := fmt.Sprint(s.sampleParameter(param))
+			switch in {
+			case "path":
+				path = strings.ReplaceAll(path, "{"+name+"}", url.PathEscape(value))
+			case "query":
+				query.Set(name, value)
+			case "header":
+				header.Set(name, value)
+			}
+		}
+		target := strings.TrimSuffix(baseURL, "/") + s.basePath + path
+		if len(query) > 0 {
+			target += "?" + query.Encode()
+		}
+		var body io.Reader
+		if content, ok := op.RequestBody["content"].(map[string]any); ok {
+			if media, ok := content["application/json"].(map[string]any); ok {
+				sample := media["example"]
+				if sample == nil {
+					sample = s.sampleValue(media["schema"], 0)
+				}
+				data, err := json.Marshal(sample)
+				if err != nil {
+					return nil, err
+				}
+				body = bytes.NewReader(data)
+				header.Set("Content-Type", "application/json")
+			}
+		}
+		req, err := http.NewRequest(op.Method, target, body)
+		if err != nil {
+			return nil, fmt.Errorf("[%s] failed to build request: %v", op.ID, err)
+		}
+		req.Header = header
+		requests = append(requests, req)
+	}
+	return requests, nil
+}
+
+// RunConformance sends the generated requests and returns every violation found.
+func (s *OpenAPISpec) RunConformance(client *http.Client, baseURL string) ([]ContractViolation, error) {
+	requests, err := s.ConformanceRequests(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	var violations []ContractViolation
+	for _, req := range requests {
+		resp, err := client.Do(req)
+		if err != nil {
+			violation := ContractViolation{OperationID: req.Method + " " + req.URL.Path, Message: fmt.Sprintf("request failed: %v", err)}
+			if op := s.FindOperation(req.Method, req.URL.Path); op != nil {
+				violation.OperationID, violation.Pointer = op.ID, op.Pointer
+			}
+			violations = append(violations, violation)
+			continue
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		violations = append(violations, s.CheckResponse(req.Method, req.URL.Path, resp, body)...)
+	}
+	return violations, nil
+}
+
+func (s *OpenAPISpec) sampleParameter(param map[string]any) any {
+	if example, ok := param["example"]; ok {
+		return example
+	}
+	return s.sampleValue(param["schema"], 0)
+}
+
+func (s *OpenAPISpec) sampleValue(schema any, depth int) any {
+	object, err := s.resolveObject(schema)
+	if err != nil || depth > 8 {
+		return nil
+	}
+	for _, key := range []string{"example", "default"} {
+		if value, ok := object[key]; ok {
+			return value
+		}
+	}
+	if enum, ok := object["enum"].([]any); ok && len(enum) > 0 {
+		return enum[0]
+	}
+	if allOf, ok := object["allOf"].([]any); ok {
+		merged := map[string]any{}
+		for _, sub := range allOf {
+			if value, ok := s.sampleValue(sub, depth+1).(map[string]any); ok {
+				for k, v := range value {
+					merged[k] = v
+				}
+			}
+		}
+		return merged
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if options, ok := object[key].([]any); ok && len(options) > 0 {
+			return s.sampleValue(options[0], depth+1)
+		}
+	}
+	types := schemaTypes(object["type"])
+	schemaType := ""
+	if len(types) > 0 {
+		schemaType = types[0]
+	}
+	switch schemaType {
+	case "integer", "number":
+		if minimum, ok := object["minimum"].(float64); ok {
+			return minimum
+		}
+		return 1
+	case "boolean":
+		return true
+	case "array":
+		return []any{s.sampleValue(object["items"], depth+1)}
+	case "object", "":
+		result := map[string]any{}
+		properties, _ := object["properties"].(map[string]any)
+		for _, name := range asSlice(object["required"]) {
+			// A malformed required entry can't name a property, so it is skipped
+			if key, ok := name.(string); ok {
+				result[key] = s.sampleValue(properties[key], depth+1)
+			}
+		}
+		return result
+	}
+	switch object["format"] {
+	case "uuid":
+		return "00000000-0000-4000-8000-000000000000"
+	case "date-time":
+		return "2024-01-01T00:00:00Z"
+	case "date":
+		return "2024-01-01"
+	case "email":
+		return "learner@example.com"
+	}
+	return "string"
+}
+
+// OpenAPIClient returns a client whose responses are checked against spec;
+// violations are logged when the step ends.
+func (c *ServerTestConfig) OpenAPIClient(spec *OpenAPISpec) (*http.Client, *ContractRecorder) {
+	client, recorder := spec.Client()
+	if c.HAR != nil {
+		recorder.base = c.HAR.Transport(nil)
+	}
+	c.addCleanup(func() {
+		c.Logger.LogInfo(fmt.Sprintf("Checked %d responses against the OpenAPI document", recorder.Checked()))
+		LogContractViolations(c.Logger, recorder.Violations())
+	})
+	return client, recorder
+}
+
+func schemaTypes(value any) []string {
+	switch t := value.(type) {
+	case string:
+		return []string{t}
+	case []any:
+		types := make([]string, 0, len(t))
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package testserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testOpenAPIDocument = `{
+  "openapi": "3.0.3",
+  "info": {"title": "Users", "version": "1.0.0"},
+  "servers": [{"url": "http://localhost:8080/api"}],
+  "paths": {
+    "/users": {
+      "get": {
+        "operationId": "listUsers",
+        "responses": {
+          "200": {
+            "description": "ok",
+            "headers": {"X-Total-Count": {"required": true, "schema": {"type": "integer"}}},
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/User"}}}}
+          }
+        }
+      },
+      "post": {
+        "operationId": "createUser",
+        "requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/NewUser"}}}},
+        "responses": {
+          "201": {"description": "created", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}},
+          "4XX": {"description": "bad request"}
+        }
+      }
+    },
+    "/users/me": {
+      "get": {
+        "operationId": "currentUser",
+        "responses": {"200": {"description": "ok", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}}}
+      }
+    },
+    "/users/{id}": {
+      "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "integer", "example": 7}}],
+      "get": {
+        "operationId": "getUser",
+        "responses": {
+          "200": {"description": "ok", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}},
+          "default": {"description": "error", "content": {"application/problem+json": {"schema": {"type": "object", "required": ["title"]}}}}
+        }
+      }
+    }
+  },
+  "components": {
+    "schemas": {
+      "User": {
+        "type": "object",
+        "required": ["id", "name"],
+        "properties": {
+          "id": {"type": "integer", "minimum": 1},
+          "name": {"type": "string", "minLength": 1},
+          "email": {"type": "string", "nullable": true},
+          "role": {"type": "string", "enum": ["admin", "member"]}
+        }
+      },
+      "NewUser": {
+        "type": "object",
+        "required": ["name"],
+        "properties": {"name": {"type": "string", "example": "Ada"}}
+      }
+    }
+  }
+}`
+
+func mustParseOpenAPI(t *testing.T) *OpenAPISpec {
+	spec, err := ParseOpenAPI([]byte(testOpenAPIDocument))
+	if err != nil {
+		t.Fatalf("ParseOpenAPI() error = %v", err)
+	}
+	return spec
+}
+
+func jsonResponse(status int, contentType string, headers map[string]string) *http.Response {
+	resp := &http.Response{StatusCode: status, Header: http.Header{}}
+	resp.Header.Set("Content-Type", contentType)
+	for name, value := range headers {
+		resp.Header.Set(name, value)
+	}
+	return resp
+}
+
+func TestParseOpenAPIRejectsSwagger2(t *testing.T) {
+	if _, err := ParseOpenAPI([]byte(`{"swagger": "2.0"}`)); err == nil {
+		t.Error("ParseOpenAPI() should reject Swagger 2 documents")
+	}
+}
+
+func TestSampleValueSkipsMalformedRequired(t *testing.T) {
+	spec := mustParseOpenAPI(t)
+	schema := map[string]any{
+		"type":       "object",
+		"required":   []any{"name", 42, map[string]any{"bad": true}},
+		"properties": map[string]any{"name": map[string]any{"type": "string"}},
+	}
+	sample, ok := spec.sampleValue(schema, 0).(map[string]any)
+	if !ok || len(sample) != 1 || sample["name"] != "string" {
+		t.Errorf("sampleValue() = %v, want only the string-named property", sample)
+	}
+}
+
+func TestFindOperationPrefersLiteralPaths(t *testing.T) {
+	spec := mustParseOpenAPI(t)
+
+	cases := map[string]string{
+		"/api/users":    "listUsers",
+		"/api/users/me": "currentUser",
+		"/api/users/42": "getUser",
+	}
+	for path, want := range cases {
+		op := spec.FindOperation("GET", path)
+		if op == nil || op.ID != want {
+			t.Errorf("FindOperation(GET, %s) = %v, want %s", path, op, want)
+		}
+	}
+	if op := spec.FindOperation("DELETE", "/api/users/42"); op != nil {
+		t.Errorf("FindOperation(DELETE) = %s, want nil", op.ID)
+	}
+}
+
+func TestCheckResponseValid(t *testing.T) {
+	spec := mustParseOpenAPI(t)
+	resp := jsonResponse(200, "application/json; charset=utf-8", map[string]string{"X-Total-Count": "1"})
+	body := []byte(`[{"id": 1, "name": "Ada", "email": null, "role": "admin"}]`)
+
+	if violations := spec.CheckResponse("GET", "/api/users", resp, body); len(violations) != 0 {
+		t.Errorf("CheckResponse() = %v, want no violations", violations)
+	}
+}
+
+func TestCheckResponseSchemaViolations(t *testing.T) {
+	spec := mustParseOpenAPI(t)
+	resp := jsonResponse(200, "application/json", nil)
+	body := []byte(`[{"id": 0, "role": "owner"}]`)
+
+	violations := spec.CheckResponse("GET", "/api/users", resp, body)
+	messages := []string{}
+	for _, violation := range violations {
+		if violation.OperationID != "listUsers" {
+			t.Errorf("OperationID = %q, want listUsers", violation.OperationID)
+		}
+		messages = append(messages, violation.String())
+	}
+	joined := strings.Join(messages, "\n")
+	for _, want := range []string{
+		"/paths/~1users/get/responses/200/headers/X-Total-Count: missing required header",
+		"/0: missing required property \"name\"",
+		"/0/id: value 0 is less than minimum 1",
+		"/0/role: value owner is not one of",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("violations missing %q, got:\n%s", want, joined)
+		}
+	}
+}
+
+func TestCheckResponseStatusAndContentType(t *testing.T) {
+	spec := mustParseOpenAPI(t)
+
+	violations := spec.CheckResponse("POST", "/api/users", jsonResponse(500, "application/json", nil), []byte(`{}`))
+	if len(violations) != 1 || !strings.Contains(violations[0].Message, "status 500 is not documented") {
+		t.Errorf("violations = %v, want undocumented status", violations)
+	}
+
+	violations = spec.CheckResponse("POST", "/api/users", jsonResponse(422, "text/plain", nil), nil)
+	if len(violations) != 0 {
+		t.Errorf("violations = %v, want 4XX to match without content", violations)
+	}
+
+	violations = spec.CheckResponse("GET", "/api/users/1", jsonResponse(200, "text/html", nil), []byte("<p>"))
+	if len(violations) != 1 || !strings.Contains(violations[0].Message, "Content-Type") {
+		t.Errorf("violations = %v, want wrong content type", violations)
+	}
+
+	violations = spec.CheckResponse("GET", "/api/users/1", jsonResponse(404, "application/problem+json", nil), []byte(`{"detail": "x"}`))
+	if len(violations) != 1 || !strings.Contains(violations[0].Message, "title") {
+		t.Errorf("violations = %v, want default response schema to be checked", violations)
+	}
+
+	violations = spec.CheckResponse("GET", "/unknown", jsonResponse(200, "application/json", nil), nil)
+	if len(violations) != 1 || !strings.Contains(violations[0].Message, "no operation") {
+		t.Errorf("violations = %v, want unknown operation", violations)
+	}
+}
+
+func TestContractRecorderAndConformance(t *testing.T) {
+	spec := mustParseOpenAPI(t)
+	var createdBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/users":
+			w.Header().Set("X-Total-Count", "1")
+			fmt.Fprint(w, `[{"id": 1, "name": "Ada"}]`)
+		case r.Method == "POST" && r.URL.Path == "/api/users":
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &createdBody)
+			w.WriteHeader(201)
+			fmt.Fprint(w, `{"id": 2, "name": "Ada"}`)
+		case r.URL.Path == "/api/users/me":
+			fmt.Fprint(w, `{"id": 1, "name": "Ada"}`)
+		case r.URL.Path == "/api/users/7":
+			// Missing the required name
+			fmt.Fprint(w, `{"id": 7}`)
+		default:
+			w.WriteHeader(500)
+		}
+	}))
+	defer server.Close()
+
+	client, recorder := spec.Client()
+	violations, err := spec.RunConformance(client, server.URL)
+	if err != nil {
+		t.Fatalf("RunConformance() error = %v", err)
+	}
+	if recorder.Checked() != 4 {
+		t.Errorf("Checked() = %d, want 4", recorder.Checked())
+	}
+	if createdBody["name"] != "Ada" {
+		t.Errorf("createUser request body = %v, want example name", createdBody)
+	}
+	if len(violations) != 1 || violations[0].OperationID != "getUser" || violations[0].Pointer != "" {
+		t.Errorf("violations = %v, want one getUser schema violation", violations)
+	}
+	if recorder.Err() == nil {
+		t.Error("recorder.Err() should report the violation it saw")
+	}
+}
@@ -0,0 +1,88 @@
+package testserver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/buildium-org/buildium_harness/diagnostics"
+	"github.com/buildium-org/buildium_harness/logger"
+	"github.com/buildium-org/buildium_harness/process"
+	"github.com/buildium-org/buildium_harness/toolchain"
+)
+
+// PreflightProblem is an environment issue that would make every server step fail.
+type PreflightProblem struct {
+	Message    string
+	Suggestion string
+}
+
+// Preflight checks that the executable can be run on this machine and, when port is set, that
+// nothing else is listening on it.
+func Preflight(executable string, port int) []PreflightProblem {
+	problems := checkExecutable(executable)
+	if port > 0 {
+		if problem := checkPort(port); problem != nil {
+			problems = append(problems, *problem)
+		}
+	}
+	return problems
+}
+
+// PreflightCommand is Preflight for a launch command. For interpreted languages the
+// interpreter is checked as the executable, and the script only needs to exist.
+func PreflightCommand(command toolchain.Command, port int) []PreflightProblem {
+	var problems []PreflightProblem
+	for _, script := range command.Args {
+		if info, err := os.Stat(script); err != nil || info.IsDir() {
+			problems = append(problems, PreflightProblem{
+				Message:    fmt.Sprintf("Script %s does not exist", script),
+				Suggestion: "Check that entrypoint in meta.json names your main source file",
+			})
+		}
+	}
+	return append(problems, Preflight(command.Path, port)...)
+}
+
+func checkExecutable(executable string) []PreflightProblem {
+	var problems []PreflightProblem
+	for _, finding := range diagnostics.Inspect(executable, "").Errors() {
+		problems = append(problems, PreflightProblem{Message: finding.Message, Suggestion: finding.Suggestion})
+	}
+	return problems
+}
+
+func checkPort(port int) *PreflightProblem {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err == nil {
+		listener.Close()
+		return nil
+	}
+	if errors.Is(err, syscall.EACCES) {
+		return &PreflightProblem{
+			Message:    fmt.Sprintf("Port %d needs elevated privileges to listen on", port),
+			Suggestion: "Use a port above 1023",
+		}
+	}
+	if owner, ok := process.PortOwner(port); ok {
+		return &PreflightProblem{
+			Message: fmt.Sprintf("Port %d is already in use by process %s, so your server could not start", port, owner),
+			Suggestion: fmt.Sprintf("Stop it with `kill %d` (perhaps an earlier run of your server is still going), then run the tests again",
+				owner.Pid),
+		}
+	}
+	return &PreflightProblem{
+		Message:    fmt.Sprintf("Port %d is already in use, so your server could not start", port),
+		Suggestion: fmt.Sprintf("Find the program using it with `lsof -i :%d` or `ss -ltnp`, stop it, then run the tests again", port),
+	}
+}
+
+func LogPreflightProblems(l *logger.Logger, problems []PreflightProblem) {
+	l.LogTitle("Preflight checks")
+	for _, problem := range problems {
+		l.LogError(problem.Message)
+		l.LogInfo("Suggested fix: " + problem.Suggestion)
+	}
+}
@@ -0,0 +1,111 @@
+package testserver
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/buildium-org/buildium_harness/meta"
+	"github.com/buildium-org/buildium_harness/toolchain"
+)
+
+func TestPreflightExecutable(t *testing.T) {
+	dir := t.TempDir()
+	notExecutable := filepath.Join(dir, "server.txt")
+	if err := os.WriteFile(notExecutable, []byte("#!/bin/sh\necho hello\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	cases := []struct {
+		executable string
+		want       string
+	}{
+		{"/usr/bin/true", ""},
+		{filepath.Join(dir, "missing"), "does not exist"},
+		{dir, "is a directory"},
+		{notExecutable, "is not executable"},
+	}
+	for _, test := range cases {
+		problems := Preflight(test.executable, 0)
+		if test.want == "" {
+			if len(problems) != 0 {
+				t.Errorf("Preflight(%s) = %v, want no problems", test.executable, problems)
+			}
+			continue
+		}
+		if len(problems) != 1 || !strings.Contains(problems[0].Message, test.want) || problems[0].Suggestion == "" {
+			t.Errorf("Preflight(%s) = %v, want %q with a suggestion", test.executable, problems, test.want)
+		}
+	}
+}
+
+func TestPreflightPortInUse(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	problems := Preflight("/usr/bin/true", port)
+	if len(problems) != 1 {
+		t.Fatalf("Preflight() = %v, want the port problem", problems)
+	}
+	if !strings.Contains(problems[0].Message, fmt.Sprintf("Port %d is already in use by process %d", port, os.Getpid())) {
+		t.Errorf("Message = %q, want the owning process", problems[0].Message)
+	}
+	if !strings.Contains(problems[0].Suggestion, fmt.Sprintf("kill %d", os.Getpid())) {
+		t.Errorf("Suggestion = %q", problems[0].Suggestion)
+	}
+
+	listener.Close()
+	if problems := Preflight("/usr/bin/true", port); len(problems) != 0 {
+		t.Errorf("Preflight() = %v once the port is free, want none", problems)
+	}
+}
+
+func TestRunStopsOnPreflightProblems(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+	t.Setenv("SERVER_STARTUP_TIME", "1")
+
+	m := &meta.Meta{
+		Stage:         0,
+		Entrypoint:    "missing-server",
+		ExecutableDir: t.TempDir(),
+		ProjectId:     "test-project-123",
+	}
+	stepCalled := false
+	steps := []func(config *ServerTestConfig) error{
+		func(config *ServerTestConfig) error {
+			stepCalled = true
+			return nil
+		},
+	}
+
+	err := NewRunner(m, steps, []int{}).Run(newTestContext())
+	if err == nil || !strings.Contains(err.Error(), "preflight checks failed") {
+		t.Errorf("Run() error = %v, want a preflight failure", err)
+	}
+	if stepCalled {
+		t.Error("steps should not run when preflight checks fail")
+	}
+}
+
+func TestPreflightCommand(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "server.py")
+	if err := os.WriteFile(script, []byte("print('hello')\n"), 0644); err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+
+	if problems := PreflightCommand(toolchain.Command{Path: "/bin/sh", Args: []string{script}}, 0); len(problems) != 0 {
+		t.Errorf("PreflightCommand() = %v, want no problems for a script without an executable bit", problems)
+	}
+	problems := PreflightCommand(toolchain.Command{Path: "/bin/sh", Args: []string{filepath.Join(dir, "missing.py")}}, 0)
+	if len(problems) != 1 || !strings.Contains(problems[0].Message, "does not exist") {
+		t.Errorf("PreflightCommand() = %v, want the missing script", problems)
+	}
+}
@@ -0,0 +1,244 @@
+package testserver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buildium-org/buildium_harness/process"
+)
+
+// ProcessStats is a snapshot of the server's process tree read from /proc.
+type ProcessStats struct {
+	SampledAt time.Time
+	Processes int
+	// RSS is the resident set size in bytes, summed over the tree.
+	RSS     int64
+	Threads int
+	FDs     int
+	Sockets int
+	CPUTime time.Duration
+}
+
+type ResourceMetric string
+
+const (
+	MetricRSS       ResourceMetric = "rss"
+	MetricThreads   ResourceMetric = "threads"
+	MetricFDs       ResourceMetric = "fd count"
+	MetricSockets   ResourceMetric = "socket count"
+	MetricProcesses ResourceMetric = "process count"
+)
+
+// Linux reports /proc times in USER_HZ, which is 100 on every supported architecture.
+const clockTicksPerSecond = 100
+
+func (s ProcessStats) Value(metric ResourceMetric) int64 {
+	switch metric {
+	case MetricRSS:
+		return s.RSS
+	case MetricThreads:
+		return int64(s.Threads)
+	case MetricFDs:
+		return int64(s.FDs)
+	case MetricSockets:
+		return int64(s.Sockets)
+	case MetricProcesses:
+		return int64(s.Processes)
+	}
+	return 0
+}
+
+func (s ProcessStats) String() string {
+	return fmt.Sprintf("%d processes, rss %.1f MiB, %d threads, %d fds, %d sockets, cpu %v",
+		s.Processes, float64(s.RSS)/(1<<20), s.Threads, s.FDs, s.Sockets, s.CPUTime.Round(time.Millisecond))
+}
+
+// SampleProcessTree sums the stats of pid and all of its descendants.
+func SampleProcessTree(pid int) (ProcessStats, error) {
+	if pid <= 0 {
+		return ProcessStats{}, fmt.Errorf("server is not running")
+	}
+	stats := ProcessStats{SampledAt: time.Now()}
+	tree := []int{pid}
+	for _, descendant := range process.Descendants(pid) {
+		tree = append(tree, descendant.Pid)
+	}
+	for _, p := range tree {
+		if err := addProcessStats(&stats, p); err != nil {
+			if p == pid {
+				return ProcessStats{}, err
+			}
+			// A descendant exited while sampling
+			continue
+		}
+		stats.Processes++
+	}
+	return stats, nil
+}
+
+func addProcessStats(stats *ProcessStats, pid int) error {
+	fields, err := process.StatFields(pid)
+	if err != nil {
+		return err
+	}
+	if fields[0] == "Z" {
+		return fmt.Errorf("process %d has exited", pid)
+	}
+	utime, _ := strconv.ParseInt(fields[11], 10, 64)
+	stime, _ := strconv.ParseInt(fields[12], 10, 64)
+	threads, _ := strconv.Atoi(fields[17])
+	rssPages, _ := strconv.ParseInt(fields[21], 10, 64)
+	stats.CPUTime += time.Duration(utime+stime) * time.Second / clockTicksPerSecond
+	stats.Threads += threads
+	stats.RSS += rssPages * int64(os.Getpagesize())
+
+	fdDir := fmt.Sprintf("/proc/%d/fd", pid)
+	fds, err := os.ReadDir(fdDir)
+	if err != nil {
+		return err
+	}
+	for _, fd := range fds {
+		stats.FDs++
+		if target, err := os.Readlink(filepath.Join(fdDir, fd.Name())); err == nil && strings.HasPrefix(target, "socket:") {
+			stats.Sockets++
+		}
+	}
+	return nil
+}
+
+// Stats samples the running server's process tree.
+func (t *TestServer) Stats() (ProcessStats, error) {
+	return SampleProcessTree(t.Pid())
+}
+
+// ResourceMonitor samples the server in the background while a step runs.
+type ResourceMonitor struct {
+	server   *TestServer
+	interval time.Duration
+
+	mu       sync.Mutex
+	baseline *ProcessStats
+	samples  []ProcessStats
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func NewResourceMonitor(server *TestServer, interval time.Duration) *ResourceMonitor {
+	return &ResourceMonitor{server: server, interval: interval}
+}
+
+// Start takes the baseline sample and keeps sampling until Stop.
+func (m *ResourceMonitor) Start() {
+	m.SetBaseline()
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				m.Sample()
+			}
+		}
+	}()
+}
+
+func (m *ResourceMonitor) Stop() {
+	if m.stop == nil {
+		return
+	}
+	close(m.stop)
+	<-m.done
+	m.stop = nil
+}
+
+// Sample reads the server's current stats and records them.
+func (m *ResourceMonitor) Sample() (ProcessStats, error) {
+	stats, err := m.server.Stats()
+	if err != nil {
+		return stats, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.samples = append(m.samples, stats)
+	return stats, nil
+}
+
+// SetBaseline samples now and uses the result as the baseline for
+// AssertReturnsToBaseline.
+func (m *ResourceMonitor) SetBaseline() (ProcessStats, error) {
+	stats, err := m.Sample()
+	if err != nil {
+		return stats, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.baseline = &stats
+	return stats, nil
+}
+
+func (m *ResourceMonitor) Baseline() (ProcessStats, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.baseline == nil {
+		return ProcessStats{}, false
+	}
+	return *m.baseline, true
+}
+
+func (m *ResourceMonitor) Samples() []ProcessStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]ProcessStats{}, m.samples...)
+}
+
+// Peak returns the highest value of each metric seen so far.
+func (m *ResourceMonitor) Peak() ProcessStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var peak ProcessStats
+	for _, sample := range m.samples {
+		peak.Processes = max(peak.Processes, sample.Processes)
+		peak.RSS = max(peak.RSS, sample.RSS)
+		peak.Threads = max(peak.Threads, sample.Threads)
+		peak.FDs = max(peak.FDs, sample.FDs)
+		peak.Sockets = max(peak.Sockets, sample.Sockets)
+		peak.CPUTime = max(peak.CPUTime, sample.CPUTime)
+		peak.SampledAt = sample.SampledAt
+	}
+	return peak
+}
+
+// AssertReturnsToBaseline waits up to timeout for metric to come back within
+// tolerance of the baseline, e.g. the fd count after a burst of requests.
+func (m *ResourceMonitor) AssertReturnsToBaseline(metric ResourceMetric, tolerance int64, timeout time.Duration) error {
+	baseline, ok := m.Baseline()
+	if !ok {
+		return fmt.Errorf("no %s baseline was recorded", metric)
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		stats, err := m.Sample()
+		if err != nil {
+			return fmt.Errorf("failed to sample the server: %v", err)
+		}
+		current := stats.Value(metric)
+		if current <= baseline.Value(metric)+tolerance {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s is %d, baseline was %d (tolerance %d), still above after %v",
+				metric, current, baseline.Value(metric), tolerance, timeout)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,102 @@
+package testserver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/buildium-org/buildium_harness/logger"
+)
+
+func startScriptServer(t *testing.T, script string) *TestServer {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "server")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+	server := NewTestServer(path, logger.NewLogger())
+	server.Start()
+	t.Cleanup(server.Stop)
+	deadline := time.Now().Add(2 * time.Second)
+	for server.Pid() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("server did not start")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return server
+}
+
+func TestSampleProcessTreeSelf(t *testing.T) {
+	stats, err := SampleProcessTree(os.Getpid())
+	if err != nil {
+		t.Fatalf("SampleProcessTree() error = %v", err)
+	}
+	if stats.Processes < 1 || stats.RSS <= 0 || stats.Threads <= 0 || stats.FDs <= 0 {
+		t.Errorf("stats = %+v, want positive values", stats)
+	}
+	if _, err := SampleProcessTree(0); err == nil {
+		t.Error("SampleProcessTree(0) should fail")
+	}
+}
+
+func TestTestServerStatsIncludesChildren(t *testing.T) {
+	server := startScriptServer(t, "sleep 5 &\nsleep 5 &\nwait\n")
+	time.Sleep(100 * time.Millisecond)
+
+	stats, err := server.Stats()
+	if err != nil {
+		t.Fatalf("Stats() error = %v", err)
+	}
+	if stats.Processes != 3 {
+		t.Errorf("Processes = %d, want the shell and two children", stats.Processes)
+	}
+
+	server.Stop()
+	if server.Pid() != 0 {
+		t.Errorf("Pid() = %d after Stop, want 0", server.Pid())
+	}
+	if _, err := server.Stats(); err == nil {
+		t.Error("Stats() should fail once the server has stopped")
+	}
+}
+
+func TestResourceMonitorReturnsToBaseline(t *testing.T) {
+	server := startScriptServer(t, "sleep 0.2\nexec 3</dev/null 4</dev/null\nsleep 0.3\nexec 3<&- 4<&-\nsleep 5\n")
+	monitor := NewResourceMonitor(server, 20*time.Millisecond)
+	monitor.Start()
+	defer monitor.Stop()
+
+	baseline, ok := monitor.Baseline()
+	if !ok {
+		t.Fatal("Start() did not record a baseline")
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	if err := monitor.AssertReturnsToBaseline(MetricFDs, 0, 10*time.Millisecond); err == nil {
+		t.Error("AssertReturnsToBaseline() should fail while the extra fds are open")
+	}
+	if err := monitor.AssertReturnsToBaseline(MetricFDs, 0, 2*time.Second); err != nil {
+		t.Errorf("AssertReturnsToBaseline() error = %v", err)
+	}
+	// The sleep child inherits the extra fds too
+	if peak := monitor.Peak(); peak.FDs < baseline.FDs+2 {
+		t.Errorf("peak FDs = %d, want at least %d", peak.FDs, baseline.FDs+2)
+	}
+	if len(monitor.Samples()) < 5 {
+		t.Errorf("recorded %d samples, want the monitor to keep sampling", len(monitor.Samples()))
+	}
+}
+
+func TestResourceMonitorWithoutServer(t *testing.T) {
+	monitor := NewResourceMonitor(NewTestServer("/usr/bin/true", logger.NewLogger()), time.Millisecond)
+	monitor.Start()
+	monitor.Stop()
+	if _, ok := monitor.Baseline(); ok {
+		t.Error("Baseline() should be unset when the server is not running")
+	}
+	if err := monitor.AssertReturnsToBaseline(MetricFDs, 0, time.Millisecond); err == nil {
+		t.Error("AssertReturnsToBaseline() should fail without a baseline")
+	}
+}
@@ -0,0 +1,415 @@
+package testserver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/buildium-org/buildium_harness/logger"
+)
+
+type ProtocolViolation struct {
+	Offset  int
+	Message string
+}
+
+func (v ProtocolViolation) String() string {
+	return fmt.Sprintf("byte %d: %s", v.Offset, v.Message)
+}
+
+type RawHeader struct {
+	Name  string
+	Value string
+}
+
+type RawResponse struct {
+	Proto      string
+	StatusCode int
+	Reason     string
+	Headers    []RawHeader
+	Header     http.Header
+	Body       []byte
+	Chunked    bool
+	Trailers   []RawHeader
+	// Offset is where the response started in the bytes read from the connection.
+	Offset     int
+	Raw        []byte
+	Violations []ProtocolViolation
+}
+
+func (r *RawResponse) Err() error {
+	if len(r.Violations) == 0 {
+		return nil
+	}
+	errs := make([]error, len(r.Violations))
+	for i, violation := range r.Violations {
+		errs[i] = errors.New(violation.String())
+	}
+	return errors.Join(errs...)
+}
+
+func (r *RawResponse) LogViolations(l *logger.Logger) {
+	for _, violation := range r.Violations {
+		l.LogError("Protocol violation at " + violation.String())
+	}
+}
+
+// DefaultRawMaxBody is the largest response body a RawHTTPProbe reads.
+const DefaultRawMaxBody = 16 << 20
+
+// RawHTTPProbe sends exact bytes over a single TCP connection and parses the
+// responses strictly, without any of the leniency of net/http.
+type RawHTTPProbe struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	offset  int
+	Timeout time.Duration
+	// MaxBody caps the bytes read for one response body, so that a bogus
+	// length cannot exhaust memory. Larger bodies are a violation.
+	MaxBody int64
+}
+
+func DialRawHTTP(addr string) (*RawHTTPProbe, error) {
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", addr, err)
+	}
+	return &RawHTTPProbe{conn: conn, reader: bufio.NewReader(conn), Timeout: 5 * time.Second, MaxBody: DefaultRawMaxBody}, nil
+}
+
+// RawRequest sends one request on a fresh connection and reads one response,
+// flagging any bytes the server sends after the response as a violation.
+func RawRequest(addr string, request []byte) (*RawResponse, error) {
+	probe, err := DialRawHTTP(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer probe.Close()
+	if err := probe.Send(request); err != nil {
+		return nil, err
+	}
+	resp, err := probe.ReadResponse(requestMethod(request))
+	if err != nil {
+		return nil, err
+	}
+	if violation := probe.CheckTrailingBytes(100 * time.Millisecond); violation != nil {
+		resp.Violations = append(resp.Violations, *violation)
+	}
+	return resp, nil
+}
+
+// RawHTTPRequest joins request lines with CRLF and terminates the header block.
+func RawHTTPRequest(lines ...string) []byte {
+	return []byte(strings.Join(lines, "\r\n") + "\r\n\r\n")
+}
+
+func (p *RawHTTPProbe) Send(raw []byte) error {
+	p.conn.SetWriteDeadline(time.Now().Add(p.Timeout))
+	if _, err := p.conn.Write(raw); err != nil {
+		return fmt.Errorf("failed to send request: %v", err)
+	}
+	return nil
+}
+
+// SendSlowly writes raw in chunks with a delay between them, like a slowloris client.
+func (p *RawHTTPProbe) SendSlowly(raw []byte, chunkSize int, delay time.Duration) error {
+	for start := 0; start < len(raw); start += chunkSize {
+		end := min(start+chunkSize, len(raw))
+		if err := p.Send(raw[start:end]); err != nil {
+			return err
+		}
+		if end < len(raw) {
+			time.Sleep(delay)
+		}
+	}
+	return nil
+}
+
+// ReadResponse parses the next response on the connection. method is the
+// request method the response answers, which decides whether a body follows.
+func (p *RawHTTPProbe) ReadResponse(method string) (*RawResponse, error) {
+	p.conn.SetReadDeadline(time.Now().Add(p.Timeout))
+	resp := &RawResponse{Offset: p.offset, Header: http.Header{}}
+
+	line, lineOffset, err := p.readLine(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read status line: %v", err)
+	}
+	p.parseStatusLine(resp, line, lineOffset)
+
+	resp.Headers, err = p.readHeaders(resp)
+	if err != nil {
+		return resp, fmt.Errorf("failed to read headers: %v", err)
+	}
+	for _, header := range resp.Headers {
+		resp.Header.Add(header.Name, header.Value)
+	}
+
+	if err := p.readBody(resp, method); err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
+
+// ReadResponses reads one response per method, for pipelined requests.
+func (p *RawHTTPProbe) ReadResponses(methods ...string) ([]*RawResponse, error) {
+	responses := make([]*RawResponse, 0, len(methods))
+	for i, method := range methods {
+		resp, err := p.ReadResponse(method)
+		if err != nil {
+			return responses, fmt.Errorf("response %d: %v", i, err)
+		}
+		responses = append(responses, resp)
+	}
+	return responses, nil
+}
+
+// CheckTrailingBytes reports a violation if the server sends anything beyond
+// the responses read so far, which usually means a wrong Content-Length.
+func (p *RawHTTPProbe) CheckTrailingBytes(wait time.Duration) *ProtocolViolation {
+	p.conn.SetReadDeadline(time.Now().Add(wait))
+	extra, _ := p.reader.Peek(1)
+	if len(extra) == 0 {
+		return nil
+	}
+	buffered := p.reader.Buffered()
+	return &ProtocolViolation{Offset: p.offset, Message: fmt.Sprintf("%d unexpected bytes after the end of the response (is Content-Length correct?)", buffered)}
+}
+
+// IsClosedByServer reports whether the server closed the connection within wait.
+func (p *RawHTTPProbe) IsClosedByServer(wait time.Duration) bool {
+	p.conn.SetReadDeadline(time.Now().Add(wait))
+	_, err := p.reader.Peek(1)
+	return errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) || isConnReset(err)
+}
+
+func (p *RawHTTPProbe) Close() error {
+	return p.conn.Close()
+}
+
+func (p *RawHTTPProbe) readLine(resp *RawResponse) (string, int, error) {
+	start := p.offset
+	line, err := p.reader.ReadBytes('\n')
+	p.offset += len(line)
+	resp.Raw = append(resp.Raw, line...)
+	if err != nil {
+		if len(line) > 0 {
+			resp.Violations = append(resp.Violations, ProtocolViolation{Offset: start + len(line), Message: "connection closed in the middle of a line"})
+		}
+		return "", start, err
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		resp.Violations = append(resp.Violations, ProtocolViolation{Offset: start + len(line) - 1, Message: "line terminated by LF without CR"})
+		return string(line[:len(line)-1]), start, nil
+	}
+	return string(line[:len(line)-2]), start, nil
+}
+
+func (p *RawHTTPProbe) parseStatusLine(resp *RawResponse, line string, offset int) {
+	proto, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		resp.Violations = append(resp.Violations, ProtocolViolation{Offset: offset, Message: fmt.Sprintf("malformed status line %q", line)})
+		return
+	}
+	resp.Proto = proto
+	if proto != "HTTP/1.1" && proto != "HTTP/1.0" {
+		resp.Violations = append(resp.Violations, ProtocolViolation{Offset: offset, Message: fmt.Sprintf("unexpected protocol version %q", proto)})
+	}
+	code, reason, hasReason := strings.Cut(rest, " ")
+	statusCode, err := strconv.Atoi(code)
+	if err != nil || len(code) != 3 {
+		resp.Violations = append(resp.Violations, ProtocolViolation{Offset: offset + len(proto) + 1, Message: fmt.Sprintf("status code %q is not three digits", code)})
+		return
+	}
+	resp.StatusCode = statusCode
+	resp.Reason = reason
+	if !hasReason {
+		resp.Violations = append(resp.Violations, ProtocolViolation{Offset: offset + len(line), Message: "missing space after status code"})
+	}
+}
+
+func (p *RawHTTPProbe) readHeaders(resp *RawResponse) ([]RawHeader, error) {
+	var headers []RawHeader
+	for {
+		line, offset, err := p.readLine(resp)
+		if err != nil {
+			return headers, err
+		}
+		if line == "" {
+			return headers, nil
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			resp.Violations = append(resp.Violations, ProtocolViolation{Offset: offset, Message: "obsolete line folding in header"})
+			if len(headers) > 0 {
+				headers[len(headers)-1].Value += " " + strings.TrimSpace(line)
+			}
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			resp.Violations = append(resp.Violations, ProtocolViolation{Offset: offset, Message: fmt.Sprintf("header line without colon %q", line)})
+			continue
+		}
+		if name == "" || strings.ContainsAny(name, " \t") {
+			resp.Violations = append(resp.Violations, ProtocolViolation{Offset: offset, Message: fmt.Sprintf("invalid header name %q", name)})
+		}
+		headers = append(headers, RawHeader{Name: name, Value: strings.Trim(value, " \t")})
+	}
+}
+
+func (p *RawHTTPProbe) readBody(resp *RawResponse, method string) error {
+	if method == "HEAD" || resp.StatusCode/100 == 1 || resp.StatusCode == 204 || resp.StatusCode == 304 {
+		if resp.StatusCode == 204 && resp.Header.Get("Content-Length") != "" && resp.Header.Get("Content-Length") != "0" {
+			resp.Violations = append(resp.Violations, ProtocolViolation{Offset: p.offset, Message: "204 response must not declare a body"})
+		}
+		return nil
+	}
+
+	transferEncoding := resp.Header.Get("Transfer-Encoding")
+	contentLengths := resp.Header.Values("Content-Length")
+	if transferEncoding != "" && len(contentLengths) > 0 {
+		resp.Violations = append(resp.Violations, ProtocolViolation{Offset: resp.Offset, Message: "both Transfer-Encoding and Content-Length are set"})
+	}
+	if strings.EqualFold(transferEncoding, "chunked") {
+		resp.Chunked = true
+		return p.readChunkedBody(resp)
+	}
+	if transferEncoding != "" {
+		resp.Violations = append(resp.Violations, ProtocolViolation{Offset: resp.Offset, Message: fmt.Sprintf("unsupported Transfer-Encoding %q", transferEncoding)})
+	}
+
+	if len(contentLengths) == 0 {
+		// No framing: the body runs until the server closes the connection
+		body, err := p.readN(resp, p.maxBody()+1)
+		if err == nil {
+			resp.Body = body[:p.maxBody()]
+			resp.Violations = append(resp.Violations, ProtocolViolation{Offset: p.offset, Message: fmt.Sprintf("body is larger than %d bytes", p.maxBody())})
+			return nil
+		}
+		resp.Body = body
+		if err != io.EOF && !isTimeout(err) {
+			return fmt.Errorf("failed to read body: %v", err)
+		}
+		if isTimeout(err) {
+			resp.Violations = append(resp.Violations, ProtocolViolation{Offset: p.offset, Message: "response has neither Content-Length nor chunked encoding and the connection was not closed"})
+		}
+		return nil
+	}
+	for _, value := range contentLengths[1:] {
+		if value != contentLengths[0] {
+			resp.Violations = append(resp.Violations, ProtocolViolation{Offset: resp.Offset, Message: fmt.Sprintf("conflicting Content-Length values %q and %q", contentLengths[0], value)})
+		}
+	}
+	// Content-Length is 1*DIGIT; ParseUint, unlike ParseInt, rejects a sign
+	n, err := strconv.ParseUint(contentLengths[0], 10, 63)
+	length := int64(n)
+	if err != nil {
+		resp.Violations = append(resp.Violations, ProtocolViolation{Offset: resp.Offset, Message: fmt.Sprintf("invalid Content-Length %q", contentLengths[0])})
+		return nil
+	}
+	if length > p.maxBody() {
+		resp.Violations = append(resp.Violations, ProtocolViolation{Offset: resp.Offset, Message: fmt.Sprintf("Content-Length %d is larger than %d bytes", length, p.maxBody())})
+		return nil
+	}
+	body, err := p.readN(resp, length)
+	resp.Body = body
+	if err != nil {
+		resp.Violations = append(resp.Violations, ProtocolViolation{Offset: p.offset, Message: fmt.Sprintf("body is shorter than Content-Length: got %d bytes, expected %d", len(body), length)})
+	}
+	return nil
+}
+
+func (p *RawHTTPProbe) maxBody() int64 {
+	if p.MaxBody <= 0 {
+		return DefaultRawMaxBody
+	}
+	return p.MaxBody
+}
+
+// readN reads up to n bytes of body, growing the buffer only as bytes arrive.
+// Like io.CopyN it returns io.EOF if the connection ends first.
+func (p *RawHTTPProbe) readN(resp *RawResponse, n int64) ([]byte, error) {
+	var body bytes.Buffer
+	read, err := io.CopyN(&body, p.reader, n)
+	p.offset += int(read)
+	resp.Raw = append(resp.Raw, body.Bytes()...)
+	return body.Bytes(), err
+}
+
+func (p *RawHTTPProbe) readChunkedBody(resp *RawResponse) error {
+	for {
+		line, offset, err := p.readLine(resp)
+		if err != nil {
+			resp.Violations = append(resp.Violations, ProtocolViolation{Offset: p.offset, Message: "connection closed before the final chunk"})
+			return nil
+		}
+		sizeText, _, _ := strings.Cut(line, ";")
+		n, err := strconv.ParseUint(strings.TrimSpace(sizeText), 16, 63)
+		size := int64(n)
+		if err != nil {
+			resp.Violations = append(resp.Violations, ProtocolViolation{Offset: offset, Message: fmt.Sprintf("invalid chunk size %q", line)})
+			return nil
+		}
+		if size == 0 {
+			break
+		}
+		if size > p.maxBody()-int64(len(resp.Body)) {
+			resp.Violations = append(resp.Violations, ProtocolViolation{Offset: offset, Message: fmt.Sprintf("chunk of %d bytes makes the body larger than %d bytes", size, p.maxBody())})
+			return nil
+		}
+		chunk, err := p.readN(resp, size)
+		resp.Body = append(resp.Body, chunk...)
+		if err != nil {
+			resp.Violations = append(resp.Violations, ProtocolViolation{Offset: p.offset, Message: fmt.Sprintf("chunk is shorter than its declared size: got %d bytes, expected %d", len(chunk), size)})
+			return nil
+		}
+		end := p.offset
+		line, _, err = p.readLine(resp)
+		if err != nil {
+			resp.Violations = append(resp.Violations, ProtocolViolation{Offset: end, Message: "missing CRLF after chunk data"})
+			return nil
+		}
+		if line != "" {
+			resp.Violations = append(resp.Violations, ProtocolViolation{Offset: end, Message: fmt.Sprintf("missing CRLF after chunk data, found %q (is the chunk size correct?)", line)})
+			return nil
+		}
+	}
+	trailers, err := p.readHeaders(resp)
+	resp.Trailers = trailers
+	if err != nil {
+		resp.Violations = append(resp.Violations, ProtocolViolation{Offset: p.offset, Message: "missing final CRLF after the last chunk"})
+	}
+	return nil
+}
+
+func requestMethod(request []byte) string {
+	method, _, _ := bytes.Cut(request, []byte(" "))
+	return string(method)
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func isConnReset(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "connection reset")
+}
+
+func (c *ServerTestConfig) DialRawHTTP(addr string) (*RawHTTPProbe, error) {
+	c.Logger.LogInfo("Opening raw TCP connection to " + addr)
+	probe, err := DialRawHTTP(addr)
+	if err != nil {
+		c.Logger.LogError(fmt.Sprintf("failed to connect: %v", err))
+		return nil, err
+	}
+	c.addCleanup(func() { probe.Close() })
+	return probe, nil
+}
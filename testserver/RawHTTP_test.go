@@ -0,0 +1,265 @@
+package testserver
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newCannedServer accepts connections, waits for a request head and replies with
+// the canned bytes once per request head received.
+func newCannedServer(t *testing.T, response string, closeAfter bool) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					for {
+						line, err := reader.ReadString('\n')
+						if err != nil {
+							return
+						}
+						if line == "\r\n" {
+							break
+						}
+					}
+					conn.Write([]byte(response))
+					if closeAfter {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestRawRequestValidResponse(t *testing.T) {
+	addr := newCannedServer(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nContent-Type: text/plain\r\n\r\nhello", false)
+
+	resp, err := RawRequest(addr, RawHTTPRequest("GET / HTTP/1.1", "Host: localhost"))
+	if err != nil {
+		t.Fatalf("RawRequest() error = %v", err)
+	}
+	if resp.StatusCode != 200 || resp.Reason != "OK" {
+		t.Errorf("status = %d %q, want 200 OK", resp.StatusCode, resp.Reason)
+	}
+	if string(resp.Body) != "hello" {
+		t.Errorf("Body = %q, want %q", resp.Body, "hello")
+	}
+	if resp.Header.Get("Content-Type") != "text/plain" {
+		t.Errorf("Content-Type = %q, want text/plain", resp.Header.Get("Content-Type"))
+	}
+	if err := resp.Err(); err != nil {
+		t.Errorf("unexpected violations: %v", err)
+	}
+}
+
+func TestRawRequestMissingCR(t *testing.T) {
+	addr := newCannedServer(t, "HTTP/1.1 200 OK\nContent-Length: 2\r\n\r\nok", false)
+
+	resp, err := RawRequest(addr, RawHTTPRequest("GET / HTTP/1.1", "Host: localhost"))
+	if err != nil {
+		t.Fatalf("RawRequest() error = %v", err)
+	}
+	if len(resp.Violations) != 1 {
+		t.Fatalf("expected 1 violation, got %v", resp.Violations)
+	}
+	if resp.Violations[0].Offset != 15 {
+		t.Errorf("violation offset = %d, want 15", resp.Violations[0].Offset)
+	}
+	if !strings.Contains(resp.Violations[0].Message, "without CR") {
+		t.Errorf("violation = %q, want missing CR", resp.Violations[0].Message)
+	}
+}
+
+func TestRawRequestContentLengthTooShort(t *testing.T) {
+	addr := newCannedServer(t, "HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\nhello", false)
+
+	resp, err := RawRequest(addr, RawHTTPRequest("GET / HTTP/1.1", "Host: localhost"))
+	if err != nil {
+		t.Fatalf("RawRequest() error = %v", err)
+	}
+	if resp.Err() == nil {
+		t.Fatal("expected a violation for trailing bytes")
+	}
+	if !strings.Contains(resp.Err().Error(), "Content-Length") {
+		t.Errorf("violation = %v, want mention of Content-Length", resp.Err())
+	}
+}
+
+func TestRawRequestContentLengthTooLong(t *testing.T) {
+	addr := newCannedServer(t, "HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nhello", true)
+
+	resp, err := RawRequest(addr, RawHTTPRequest("GET / HTTP/1.1", "Host: localhost"))
+	if err != nil {
+		t.Fatalf("RawRequest() error = %v", err)
+	}
+	if len(resp.Violations) != 1 || !strings.Contains(resp.Violations[0].Message, "shorter than Content-Length") {
+		t.Errorf("violations = %v, want short body", resp.Violations)
+	}
+}
+
+func TestRawRequestHugeBodyLengths(t *testing.T) {
+	for name, response := range map[string]string{
+		"Content-Length": "HTTP/1.1 200 OK\r\nContent-Length: 9000000000000000000\r\n\r\nhello",
+		"chunk size":     "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n7fffffffffffffff\r\nhello",
+	} {
+		t.Run(name, func(t *testing.T) {
+			addr := newCannedServer(t, response, true)
+			resp, err := RawRequest(addr, RawHTTPRequest("GET / HTTP/1.1", "Host: localhost"))
+			if err != nil {
+				t.Fatalf("RawRequest() error = %v", err)
+			}
+			if len(resp.Violations) == 0 || !strings.Contains(resp.Violations[0].Message, "larger than 16777216 bytes") {
+				t.Errorf("violations = %v, want the length rejected", resp.Violations)
+			}
+		})
+	}
+}
+
+func TestRawRequestSignedLengths(t *testing.T) {
+	for name, test := range map[string]struct{ response, want string }{
+		"plus Content-Length":  {"HTTP/1.1 200 OK\r\nContent-Length: +5\r\n\r\nhello", `invalid Content-Length "+5"`},
+		"minus Content-Length": {"HTTP/1.1 200 OK\r\nContent-Length: -5\r\n\r\nhello", `invalid Content-Length "-5"`},
+		"plus chunk size":      {"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n+5\r\nhello\r\n0\r\n\r\n", `invalid chunk size "+5"`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			addr := newCannedServer(t, test.response, true)
+			resp, err := RawRequest(addr, RawHTTPRequest("GET / HTTP/1.1", "Host: localhost"))
+			if err != nil {
+				t.Fatalf("RawRequest() error = %v", err)
+			}
+			if len(resp.Violations) == 0 || resp.Violations[0].Message != test.want {
+				t.Errorf("violations = %v, want %s", resp.Violations, test.want)
+			}
+		})
+	}
+}
+
+func TestRawHTTPProbeMaxBody(t *testing.T) {
+	addr := newCannedServer(t, "HTTP/1.1 200 OK\r\nConnection: close\r\n\r\n"+strings.Repeat("x", 100), true)
+	probe, err := DialRawHTTP(addr)
+	if err != nil {
+		t.Fatalf("DialRawHTTP() error = %v", err)
+	}
+	defer probe.Close()
+	probe.MaxBody = 10
+	probe.Send(RawHTTPRequest("GET / HTTP/1.1", "Host: localhost"))
+	resp, err := probe.ReadResponse("GET")
+	if err != nil {
+		t.Fatalf("ReadResponse() error = %v", err)
+	}
+	if len(resp.Body) != 10 || len(resp.Violations) != 1 || resp.Violations[0].Message != "body is larger than 10 bytes" {
+		t.Errorf("body %q, violations %v, want 10 bytes and a violation", resp.Body, resp.Violations)
+	}
+}
+
+func TestRawRequestChunked(t *testing.T) {
+	addr := newCannedServer(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n6;ext=1\r\n world\r\n0\r\nX-Trailer: yes\r\n\r\n", false)
+
+	resp, err := RawRequest(addr, RawHTTPRequest("GET / HTTP/1.1", "Host: localhost"))
+	if err != nil {
+		t.Fatalf("RawRequest() error = %v", err)
+	}
+	if !resp.Chunked {
+		t.Error("Chunked = false, want true")
+	}
+	if string(resp.Body) != "hello world" {
+		t.Errorf("Body = %q, want %q", resp.Body, "hello world")
+	}
+	if len(resp.Trailers) != 1 || resp.Trailers[0].Name != "X-Trailer" {
+		t.Errorf("Trailers = %v, want X-Trailer", resp.Trailers)
+	}
+	if err := resp.Err(); err != nil {
+		t.Errorf("unexpected violations: %v", err)
+	}
+}
+
+func TestRawRequestBadChunkSize(t *testing.T) {
+	addr := newCannedServer(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nhello\r\n0\r\n\r\n", false)
+
+	resp, err := RawRequest(addr, RawHTTPRequest("GET / HTTP/1.1", "Host: localhost"))
+	if err != nil {
+		t.Fatalf("RawRequest() error = %v", err)
+	}
+	if len(resp.Violations) == 0 || !strings.Contains(resp.Violations[0].Message, "missing CRLF after chunk data") {
+		t.Errorf("violations = %v, want missing CRLF after chunk", resp.Violations)
+	}
+	// "HTTP/1.1 200 OK\r\n" + "Transfer-Encoding: chunked\r\n" + "\r\n" + "3\r\n" + "hel"
+	if resp.Violations[0].Offset != 17+28+2+3+3 {
+		t.Errorf("violation offset = %d, want %d", resp.Violations[0].Offset, 17+28+2+3+3)
+	}
+}
+
+func TestRawHTTPProbePipelinedKeepAlive(t *testing.T) {
+	addr := newCannedServer(t, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok", false)
+
+	probe, err := DialRawHTTP(addr)
+	if err != nil {
+		t.Fatalf("DialRawHTTP() error = %v", err)
+	}
+	defer probe.Close()
+
+	request := RawHTTPRequest("GET /a HTTP/1.1", "Host: localhost")
+	pipelined := append(append([]byte{}, request...), RawHTTPRequest("HEAD /b HTTP/1.1", "Host: localhost")...)
+	if err := probe.SendSlowly(pipelined, 7, time.Millisecond); err != nil {
+		t.Fatalf("SendSlowly() error = %v", err)
+	}
+	// The canned server sends a body for HEAD too, so read both as GET
+	responses, err := probe.ReadResponses("GET", "GET")
+	if err != nil {
+		t.Fatalf("ReadResponses() error = %v", err)
+	}
+	if responses[1].Offset != len(responses[0].Raw) {
+		t.Errorf("second response offset = %d, want %d", responses[1].Offset, len(responses[0].Raw))
+	}
+	if probe.IsClosedByServer(50 * time.Millisecond) {
+		t.Error("IsClosedByServer() = true, want connection kept alive")
+	}
+}
+
+func TestRawHTTPProbeServerCloses(t *testing.T) {
+	addr := newCannedServer(t, "HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\nConnection: close\r\n\r\n", true)
+
+	probe, err := DialRawHTTP(addr)
+	if err != nil {
+		t.Fatalf("DialRawHTTP() error = %v", err)
+	}
+	defer probe.Close()
+	probe.Send(RawHTTPRequest("GARBAGE"))
+	resp, err := probe.ReadResponse("GET")
+	if err != nil {
+		t.Fatalf("ReadResponse() error = %v", err)
+	}
+	if resp.StatusCode != 400 {
+		t.Errorf("StatusCode = %d, want 400", resp.StatusCode)
+	}
+	if !probe.IsClosedByServer(time.Second) {
+		t.Error("IsClosedByServer() = false, want true")
+	}
+}
+
+func TestRawRequestMalformedStatusLine(t *testing.T) {
+	addr := newCannedServer(t, "HTTP/1.1 20 OK\r\nContent-Length: 0\r\n\r\n", false)
+
+	resp, err := RawRequest(addr, RawHTTPRequest("GET / HTTP/1.1", "Host: localhost"))
+	if err != nil {
+		t.Fatalf("RawRequest() error = %v", err)
+	}
+	if len(resp.Violations) == 0 || resp.Violations[0].Offset != 9 {
+		t.Errorf("violations = %v, want status code violation at byte 9", resp.Violations)
+	}
+}
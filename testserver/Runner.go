@@ -4,89 +4,136 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"slices"
+	"path/filepath"
 	"strconv"
 	"time"
 
-	"github.com/buildium-org/buildium_harness/logger"
 	"github.com/buildium-org/buildium_harness/meta"
-	"github.com/buildium-org/buildium_harness/supabase"
+	"github.com/buildium-org/buildium_harness/runner"
 )
 
-func SkipStep(config *ServerTestConfig) error {
-	logger := *config.Logger
-	logger.LogTitle("Skipping Step")
-	logger.LogInfo("Skipping step")
-	return nil
+// Step is a named step; see runner.Step.
+type Step = runner.Step[*ServerTestConfig]
+
+// Hooks run around the steps; see runner.Hooks.
+type Hooks = runner.Hooks
+
+// Runner runs server steps; see runner.Runner.
+type Runner = runner.Runner[*ServerTestConfig]
+
+// NewRunner runs bare step functions, skipping steps by index. Their Ids are
+// "step-0", "step-1"...
+func NewRunner(meta *meta.Meta, steps []func(config *ServerTestConfig) error, skipSteps []int) *Runner {
+	r := NewStepRunner(meta, runner.Steps(steps...), runner.IndexIds(skipSteps))
+	r.SetIndexSkips(true)
+	return r
 }
 
-type Runner struct {
-	meta      *meta.Meta
-	steps     []func(config *ServerTestConfig) error
-	skipSteps []int
+// NewStepRunner runs named steps, skipping the steps with the given Ids.
+func NewStepRunner(meta *meta.Meta, steps []Step, skipSteps []string) *Runner {
+	return runner.New(meta, NewEnvironment(), steps, skipSteps)
 }
 
-func NewRunner(meta *meta.Meta, steps []func(config *ServerTestConfig) error, skipSteps []int) *Runner {
-	return &Runner{meta: meta, steps: steps, skipSteps: skipSteps}
+// Environment starts the user's server before each step and stops it after.
+type Environment struct {
+	server *TestServer
+	tls    *TLSMaterial
+	har    *HARRecorder
+}
+
+func NewEnvironment() *Environment {
+	return &Environment{}
 }
 
-func (r *Runner) Run(ctx context.Context) error {
-	l := ctx.Value("logger").(*logger.Logger)
-	executable := r.meta.ExecutableDir + "/" + r.meta.Entrypoint
-	server := NewTestServer(executable, l)
-	ctx = context.WithValue(ctx, "testServer", server)
-	supaClient := supabase.NewSupaClient(ctx)
-	err := supaClient.Login(ctx)
+func (e *Environment) Setup(ctx context.Context, s *runner.Session) error {
+	l := s.Logger
+	// Environment problems would fail every step, so explain them instead of running steps
+	if problems := PreflightCommand(s.Setup.Command, s.Meta.Port); len(problems) > 0 {
+		LogPreflightProblems(l, problems)
+		return fmt.Errorf("preflight checks failed: %s", problems[0].Message)
+	}
+	e.server = NewTestServer(s.Setup.Command.Path, l)
+	e.server.SetArgs(s.Setup.Command.Args...)
+	e.server.SetSourceDir(s.Meta.SourceDir)
+	tlsMaterial, err := newRunTLSMaterial()
 	if err != nil {
-		fmt.Printf("failed to login: %v", err)
-		return fmt.Errorf("failed to login: %v", err)
+		l.LogError(fmt.Sprintf("failed to generate TLS certificates: %v", err))
+		return fmt.Errorf("failed to generate TLS certificates: %v", err)
 	}
-	ctx = context.WithValue(ctx, "supaClient", supaClient)
-	completedStage := -1
-	for i, step := range r.steps {
-		if i > r.meta.Stage {
-			break
-		}
-		var err error
-		if slices.Contains(r.skipSteps, i) {
-			err = r.runTest(ctx, SkipStep)
-		} else {
-			err = r.runTest(ctx, step)
-		}
-		if err != nil {
-			supaClient.AddProjectRun(ctx, r.meta.ProjectId, i-1, logger.GetAllLogs())
-			return err
-		}
-		l.NextStep()
-		completedStage++
+	for key, value := range tlsMaterial.Env() {
+		e.server.SetEnv(key, value)
 	}
-	supaClient.AddProjectRun(ctx, r.meta.ProjectId, completedStage, logger.GetAllLogs())
+	e.tls = tlsMaterial
+	e.har = NewHARRecorder()
 	return nil
 }
 
-func (r *Runner) runTest(ctx context.Context, step func(config *ServerTestConfig) error) error {
-	logger := ctx.Value("logger").(*logger.Logger)
-	testServer := ctx.Value("testServer").(*TestServer)
-	testServer.Start()
-	defer testServer.Stop()
-
-	serverStartupTimeStr := os.Getenv("SERVER_STARTUP_TIME")
-	var serverStartupTimeMs int = 500
-	var err error
-	if serverStartupTimeStr != "" {
-		serverStartupTimeMs, err = strconv.Atoi(serverStartupTimeStr)
-		if err != nil {
-			logger.LogError(fmt.Sprintf("invalid server startup time: %v", err))
-			return fmt.Errorf("invalid server startup time: %v", err)
-		}
+func (e *Environment) RunStep(ctx context.Context, s *runner.Session, step func(config *ServerTestConfig) error) error {
+	title := s.StepTitle
+	if title == "" {
+		title = fmt.Sprintf("Step %d", s.Step)
 	}
-	time.Sleep(time.Duration(serverStartupTimeMs) * time.Millisecond)
+	e.har.StartPage(s.StepId, title)
+	e.server.Start()
+	defer e.server.Stop()
 
-	err = step(&ServerTestConfig{Logger: logger, Server: testServer})
+	serverStartupTime, err := getServerStartupTime()
 	if err != nil {
-		logger.LogError("Test failed")
+		s.Logger.LogError(err.Error())
 		return err
 	}
-	logger.LogSuccess("Test passed")
+	time.Sleep(serverStartupTime)
+
+	resources := NewResourceMonitor(e.server, 250*time.Millisecond)
+	resources.Start()
+	defer resources.Stop()
+
+	config := &ServerTestConfig{Logger: s.Logger, Server: e.server, TLS: e.tls, HAR: e.har, Resources: resources, Rand: s.Rand, ctx: ctx}
+	defer config.runCleanups()
+	return step(config)
+}
+
+// Extras writes the run's HAR file next to meta.json, and attaches the HAR to
+// the report when BUILDIUM_ATTACH_HAR is set.
+func (e *Environment) Extras(ctx context.Context, s *runner.Session) map[string]any {
+	if len(e.har.Entries()) == 0 {
+		return nil
+	}
+	harPath := filepath.Join(s.Meta.ExecutableDir, harFileName)
+	if err := e.har.WriteFile(harPath); err != nil {
+		s.Logger.LogError(fmt.Sprintf("failed to write %s: %v", harPath, err))
+	}
+	if os.Getenv("BUILDIUM_ATTACH_HAR") == "true" {
+		return map[string]any{"har": e.har}
+	}
 	return nil
 }
+
+func (e *Environment) Teardown(s *runner.Session) {
+	e.tls.Close()
+}
+
+func newRunTLSMaterial() (*TLSMaterial, error) {
+	dir, err := os.MkdirTemp("", "buildium-tls-")
+	if err != nil {
+		return nil, err
+	}
+	material, err := GenerateTLSMaterial(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return material, nil
+}
+
+func getServerStartupTime() (time.Duration, error) {
+	serverStartupTimeStr := os.Getenv("SERVER_STARTUP_TIME")
+	if serverStartupTimeStr == "" {
+		return 500 * time.Millisecond, nil
+	}
+	serverStartupTimeMs, err := strconv.Atoi(serverStartupTimeStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid server startup time: %v", err)
+	}
+	return time.Duration(serverStartupTimeMs) * time.Millisecond, nil
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"errors"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/buildium-org/buildium_harness/logger"
 	"github.com/buildium-org/buildium_harness/meta"
+	"github.com/buildium-org/buildium_harness/process"
 )
 
 // Helper to create a test context with logger
@@ -35,12 +37,10 @@ func TestNewRunner(t *testing.T) {
 		t.Fatal("NewRunner() returned nil")
 	}
 
-	if runner.meta != m {
-		t.Error("NewRunner() did not set meta correctly")
-	}
-
-	if len(runner.steps) != 2 {
-		t.Errorf("NewRunner() steps length = %d, want 2", len(runner.steps))
+	t.Setenv("ENVIRONMENT", "BUILDING")
+	result := runner.Execute(newTestContext())
+	if len(result.Steps) != 2 || result.Steps[0].Id != "step-0" || result.Steps[1].Id != "step-1" {
+		t.Errorf("NewRunner() steps = %+v, want 2 steps with Ids by index", result.Steps)
 	}
 }
 
@@ -60,8 +60,9 @@ func TestNewRunnerWithEmptySteps(t *testing.T) {
 		t.Fatal("NewRunner() returned nil")
 	}
 
-	if len(runner.steps) != 0 {
-		t.Errorf("NewRunner() steps length = %d, want 0", len(runner.steps))
+	t.Setenv("ENVIRONMENT", "BUILDING")
+	if result := runner.Execute(newTestContext()); len(result.Steps) != 0 {
+		t.Errorf("NewRunner() steps = %+v, want none", result.Steps)
 	}
 }
 
@@ -766,3 +767,83 @@ func TestServerExecutablePath(t *testing.T) {
 		t.Errorf("Server executable = %q, want %q", serverExecutable, expectedPath)
 	}
 }
+
+func TestRunConfigHasTLS(t *testing.T) {
+	// Set ENVIRONMENT to BUILDING to disable supabase calls
+	originalEnv := os.Getenv("ENVIRONMENT")
+	os.Setenv("ENVIRONMENT", "BUILDING")
+	defer os.Setenv("ENVIRONMENT", originalEnv)
+
+	// Use a very short startup time for tests
+	originalStartup := os.Getenv("SERVER_STARTUP_TIME")
+	os.Setenv("SERVER_STARTUP_TIME", "1")
+	defer os.Setenv("SERVER_STARTUP_TIME", originalStartup)
+
+	m := &meta.Meta{
+		Stage:         0,
+		Entrypoint:    "true",
+		ExecutableDir: "/usr/bin",
+		ProjectId:     "test-project-123",
+	}
+
+	var receivedTLS *TLSMaterial
+	var certExisted bool
+	steps := []func(config *ServerTestConfig) error{
+		func(config *ServerTestConfig) error {
+			receivedTLS = config.TLS
+			_, err := os.Stat(config.TLS.CertPath)
+			certExisted = err == nil
+			return nil
+		},
+	}
+
+	runner := NewRunner(m, steps, []int{})
+	ctx := newTestContext()
+
+	err := runner.Run(ctx)
+	if err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+
+	if receivedTLS == nil {
+		t.Fatal("config.TLS was nil")
+	}
+	if !certExisted {
+		t.Error("certificate did not exist during the step")
+	}
+	if _, err := os.Stat(receivedTLS.Dir); !os.IsNotExist(err) {
+		t.Error("TLS directory should be removed after the run")
+	}
+}
+
+func TestRunKillsProcessesOutsideServerGroup(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "BUILDING")
+	t.Setenv("SERVER_STARTUP_TIME", "100")
+	t.Setenv("ORPHAN_PROCESSES", "fail")
+
+	dir := t.TempDir()
+	// setsid moves the sleep out of the server's process group
+	script := "#!/bin/sh\nsetsid sleep 30 &\nsleep 30\n"
+	if err := os.WriteFile(dir+"/server", []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+	m := &meta.Meta{
+		Stage:         0,
+		Entrypoint:    "server",
+		ExecutableDir: dir,
+		ProjectId:     "test-project-123",
+	}
+	steps := []func(config *ServerTestConfig) error{
+		func(config *ServerTestConfig) error { return nil },
+	}
+
+	err := NewRunner(m, steps, []int{}).Run(newTestContext())
+	if err == nil || !strings.Contains(err.Error(), "left running after the step") {
+		t.Fatalf("Run() error = %v, want the escaped process to fail the step", err)
+	}
+	for _, p := range process.Descendants(os.Getpid()) {
+		if p.Command == "sleep" && p.State != "Z" {
+			t.Errorf("process %s is still running after the run", p)
+		}
+	}
+}
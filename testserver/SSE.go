@@ -0,0 +1,332 @@
+package testserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type SSEEvent struct {
+	Type       string
+	Data       string
+	ID         string
+	Retry      time.Duration
+	ReceivedAt time.Time
+}
+
+type SSEStream struct {
+	url         string
+	client      *http.Client
+	ctx         context.Context
+	cancel      context.CancelFunc
+	events      chan SSEEvent
+	done        chan struct{}
+	mu          sync.Mutex
+	received    []SSEEvent
+	lastEventID string
+	retry       time.Duration
+	err         error
+	// addCleanup is the opening config's, so that reconnected streams are
+	// also closed after the step. It is nil for streams opened without one.
+	addCleanup func(cleanup func())
+}
+
+func OpenSSE(url string, lastEventID string) (*SSEStream, error) {
+	return openSSE(&http.Client{}, url, lastEventID)
+}
+
+func openSSE(client *http.Client, url string, lastEventID string) (*SSEStream, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to open event stream %s: %v", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("expected status 200 for event stream, got %d", resp.StatusCode)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/event-stream" {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("expected Content-Type text/event-stream, got %q", resp.Header.Get("Content-Type"))
+	}
+
+	s := &SSEStream{
+		url:         url,
+		client:      client,
+		ctx:         ctx,
+		cancel:      cancel,
+		events:      make(chan SSEEvent, 256),
+		done:        make(chan struct{}),
+		lastEventID: lastEventID,
+	}
+	go func() {
+		defer resp.Body.Close()
+		s.readLoop(resp)
+	}()
+	return s, nil
+}
+
+// Next waits for the next event on the stream.
+func (s *SSEStream) Next(timeout time.Duration) (SSEEvent, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case event := <-s.events:
+		return event, nil
+	case <-s.done:
+		select {
+		case event := <-s.events:
+			return event, nil
+		default:
+		}
+		if s.err != nil {
+			return SSEEvent{}, fmt.Errorf("event stream ended: %v", s.err)
+		}
+		return SSEEvent{}, fmt.Errorf("event stream ended")
+	case <-timer.C:
+		return SSEEvent{}, fmt.Errorf("no event received within %v", timeout)
+	}
+}
+
+// Collect waits for count events, failing if they don't all arrive within timeout.
+func (s *SSEStream) Collect(count int, timeout time.Duration) ([]SSEEvent, error) {
+	deadline := time.Now().Add(timeout)
+	events := make([]SSEEvent, 0, count)
+	for len(events) < count {
+		event, err := s.Next(time.Until(deadline))
+		if err != nil {
+			return events, fmt.Errorf("received %d of %d events: %v", len(events), count, err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// Events returns every event received so far, including ones not yet read with Next.
+func (s *SSEStream) Events() []SSEEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SSEEvent{}, s.received...)
+}
+
+func (s *SSEStream) LastEventID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastEventID
+}
+
+// RetryDelay is the reconnection time most recently requested by the server.
+func (s *SSEStream) RetryDelay() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.retry
+}
+
+// Reconnect closes the stream and opens a new one, sending the last seen event ID.
+func (s *SSEStream) Reconnect() (*SSEStream, error) {
+	s.Close()
+	stream, err := openSSE(s.client, s.url, s.LastEventID())
+	if err != nil {
+		return nil, err
+	}
+	if s.addCleanup != nil {
+		stream.addCleanup = s.addCleanup
+		stream.addCleanup(stream.Close)
+	}
+	return stream, nil
+}
+
+func (s *SSEStream) Close() {
+	s.cancel()
+	<-s.done
+}
+
+func (s *SSEStream) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *SSEStream) readLoop(resp *http.Response) {
+	defer close(s.done)
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	scanner.Split(scanSSELines)
+
+	var eventType string
+	var data strings.Builder
+	hasData := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if hasData {
+				s.dispatch(eventType, strings.TrimSuffix(data.String(), "\n"))
+			}
+			eventType = ""
+			data.Reset()
+			hasData = false
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			data.WriteString(value)
+			data.WriteString("\n")
+			hasData = true
+		case "id":
+			if !strings.Contains(value, "\x00") {
+				s.mu.Lock()
+				s.lastEventID = value
+				s.mu.Unlock()
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				s.mu.Lock()
+				s.retry = time.Duration(ms) * time.Millisecond
+				s.mu.Unlock()
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil && resp.Request.Context().Err() == nil {
+		s.err = err
+	}
+}
+
+func (s *SSEStream) dispatch(eventType string, data string) {
+	if eventType == "" {
+		eventType = "message"
+	}
+	s.mu.Lock()
+	event := SSEEvent{Type: eventType, Data: data, ID: s.lastEventID, Retry: s.retry, ReceivedAt: time.Now()}
+	s.received = append(s.received, event)
+	s.mu.Unlock()
+	// Waiting for a slow reader keeps counts right; Close still stops the stream
+	select {
+	case s.events <- event:
+	case <-s.ctx.Done():
+	}
+}
+
+// scanSSELines splits on CRLF, LF or a lone CR as required by the event stream format.
+func scanSSELines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		return 0, nil, nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func AssertEventTypes(events []SSEEvent, types ...string) error {
+	if len(events) != len(types) {
+		return fmt.Errorf("expected %d events, got %d", len(types), len(events))
+	}
+	for i, event := range events {
+		if event.Type != types[i] {
+			return fmt.Errorf("event %d: expected type %q, got %q", i, types[i], event.Type)
+		}
+	}
+	return nil
+}
+
+func AssertEventData(events []SSEEvent, data ...string) error {
+	if len(events) != len(data) {
+		return fmt.Errorf("expected %d events, got %d", len(data), len(events))
+	}
+	for i, event := range events {
+		if event.Data != data[i] {
+			return fmt.Errorf("event %d: expected data %q, got %q", i, data[i], event.Data)
+		}
+	}
+	return nil
+}
+
+func AssertEventIDs(events []SSEEvent, ids ...string) error {
+	if len(events) != len(ids) {
+		return fmt.Errorf("expected %d events, got %d", len(ids), len(events))
+	}
+	for i, event := range events {
+		if event.ID != ids[i] {
+			return fmt.Errorf("event %d: expected id %q, got %q", i, ids[i], event.ID)
+		}
+	}
+	return nil
+}
+
+// AssertMinSpacing checks that consecutive events arrived at least min apart,
+// which catches servers that buffer the whole stream until the response ends.
+func AssertMinSpacing(events []SSEEvent, min time.Duration) error {
+	for i := 1; i < len(events); i++ {
+		gap := events[i].ReceivedAt.Sub(events[i-1].ReceivedAt)
+		if gap < min {
+			return fmt.Errorf("events %d and %d arrived %v apart, expected at least %v (is the response being flushed after each event?)", i-1, i, gap, min)
+		}
+	}
+	return nil
+}
+
+func (c *ServerTestConfig) OpenSSE(url string) (*SSEStream, error) {
+	c.Logger.LogInfo("Opening event stream " + url)
+	stream, err := openSSE(c.sseClient(), url, "")
+	if err != nil {
+		c.Logger.LogError(fmt.Sprintf("failed to open event stream: %v", err))
+		return nil, err
+	}
+	stream.addCleanup = c.addCleanup
+	c.addCleanup(stream.Close)
+	return stream, nil
+}
+
+// sseClient has no timeout, since streams stay open, trusts the run's
+// certificate authority for https streams and records streams in the HAR file.
+func (c *ServerTestConfig) sseClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if c.TLS != nil {
+		transport.TLSClientConfig = c.TLS.ClientConfig()
+	}
+	if c.HAR != nil {
+		return &http.Client{Transport: c.HAR.Transport(transport)}
+	}
+	return &http.Client{Transport: transport}
+}
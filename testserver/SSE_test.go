@@ -0,0 +1,252 @@
+package testserver
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/buildium-org/buildium_harness/logger"
+)
+
+func newSSETestServer(t *testing.T, handler http.HandlerFunc) string {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestOpenSSEParsesFields(t *testing.T) {
+	url := newSSETestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		fmt.Fprint(w, ": comment\n")
+		fmt.Fprint(w, "retry: 1500\n")
+		fmt.Fprint(w, "id: 1\nevent: greeting\ndata: hello\n\n")
+		fmt.Fprint(w, "id: 2\r\ndata:first line\r\ndata: second line\r\n\r\n")
+		fmt.Fprint(w, "data: no type\rid: 3\r\r")
+	})
+
+	stream, err := OpenSSE(url, "")
+	if err != nil {
+		t.Fatalf("OpenSSE() error = %v", err)
+	}
+	defer stream.Close()
+
+	events, err := stream.Collect(3, time.Second)
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if err := AssertEventTypes(events, "greeting", "message", "message"); err != nil {
+		t.Error(err)
+	}
+	if err := AssertEventData(events, "hello", "first line\nsecond line", "no type"); err != nil {
+		t.Error(err)
+	}
+	if err := AssertEventIDs(events, "1", "2", "3"); err != nil {
+		t.Error(err)
+	}
+	if stream.RetryDelay() != 1500*time.Millisecond {
+		t.Errorf("RetryDelay() = %v, want 1.5s", stream.RetryDelay())
+	}
+	if stream.LastEventID() != "3" {
+		t.Errorf("LastEventID() = %q, want %q", stream.LastEventID(), "3")
+	}
+}
+
+func TestOpenSSERejectsWrongContentType(t *testing.T) {
+	url := newSSETestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "data: hello\n\n")
+	})
+
+	if _, err := OpenSSE(url, ""); err == nil {
+		t.Fatal("OpenSSE() should fail for a non event-stream response")
+	}
+}
+
+func TestSSEReconnectSendsLastEventID(t *testing.T) {
+	url := newSSETestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		start := 0
+		if id := r.Header.Get("Last-Event-ID"); id != "" {
+			fmt.Sscanf(id, "%d", &start)
+		}
+		for i := start + 1; i <= start+2; i++ {
+			fmt.Fprintf(w, "id: %d\ndata: event %d\n\n", i, i)
+		}
+	})
+
+	stream, err := OpenSSE(url, "")
+	if err != nil {
+		t.Fatalf("OpenSSE() error = %v", err)
+	}
+	if _, err := stream.Collect(2, time.Second); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+
+	resumed, err := stream.Reconnect()
+	if err != nil {
+		t.Fatalf("Reconnect() error = %v", err)
+	}
+	defer resumed.Close()
+	events, err := resumed.Collect(2, time.Second)
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if err := AssertEventIDs(events, "3", "4"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConfigSSEReconnectIsClosedAfterTheStep(t *testing.T) {
+	url := newSSETestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "id: 1\ndata: event\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+
+	config := &ServerTestConfig{Logger: logger.NewLogger()}
+	stream, err := config.OpenSSE(url)
+	if err != nil {
+		t.Fatalf("config.OpenSSE() error = %v", err)
+	}
+	if _, err := stream.Next(time.Second); err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	resumed, err := stream.Reconnect()
+	if err != nil {
+		t.Fatalf("Reconnect() error = %v", err)
+	}
+	config.runCleanups()
+	select {
+	case <-resumed.Done():
+	case <-time.After(time.Second):
+		t.Error("the reconnected stream was left open after the step")
+	}
+}
+
+func TestAssertMinSpacing(t *testing.T) {
+	url := newSSETestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, "data: tick %d\n\n", i)
+			flusher.Flush()
+			time.Sleep(50 * time.Millisecond)
+		}
+	})
+
+	stream, err := OpenSSE(url, "")
+	if err != nil {
+		t.Fatalf("OpenSSE() error = %v", err)
+	}
+	defer stream.Close()
+	events, err := stream.Collect(3, time.Second)
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if err := AssertMinSpacing(events, 30*time.Millisecond); err != nil {
+		t.Errorf("AssertMinSpacing() error = %v", err)
+	}
+}
+
+func TestAssertMinSpacingBufferedStream(t *testing.T) {
+	url := newSSETestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		var body strings.Builder
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(&body, "data: tick %d\n\n", i)
+		}
+		// Everything is written at once, as a server that never flushes would
+		buffered := bufio.NewWriter(w)
+		buffered.WriteString(body.String())
+		buffered.Flush()
+	})
+
+	stream, err := OpenSSE(url, "")
+	if err != nil {
+		t.Fatalf("OpenSSE() error = %v", err)
+	}
+	defer stream.Close()
+	events, err := stream.Collect(3, time.Second)
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if err := AssertMinSpacing(events, 30*time.Millisecond); err == nil {
+		t.Error("AssertMinSpacing() should fail for events that arrive together")
+	}
+}
+
+func TestSSENextAfterStreamEnds(t *testing.T) {
+	url := newSSETestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: only\n\n")
+	})
+
+	stream, err := OpenSSE(url, "")
+	if err != nil {
+		t.Fatalf("OpenSSE() error = %v", err)
+	}
+	defer stream.Close()
+	if _, err := stream.Next(time.Second); err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if _, err := stream.Next(time.Second); err == nil {
+		t.Error("Next() should fail once the stream has ended")
+	}
+	if len(stream.Events()) != 1 {
+		t.Errorf("Events() length = %d, want 1", len(stream.Events()))
+	}
+}
+
+func TestSSEKeepsEventsBeyondTheBuffer(t *testing.T) {
+	const count = 600
+	url := newSSETestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := range count {
+			fmt.Fprintf(w, "id: %d\ndata: %d\n\n", i, i)
+		}
+	})
+
+	stream, err := OpenSSE(url, "")
+	if err != nil {
+		t.Fatalf("OpenSSE() error = %v", err)
+	}
+	defer stream.Close()
+	// Let the stream fill the buffer before anything is read
+	time.Sleep(50 * time.Millisecond)
+	events, err := stream.Collect(count, 2*time.Second)
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if events[count-1].Data != fmt.Sprint(count-1) {
+		t.Errorf("last event = %+v, want every event in order", events[count-1])
+	}
+}
+
+func TestConfigOpenSSETrustsRunCA(t *testing.T) {
+	material, err := GenerateTLSMaterial(t.TempDir())
+	if err != nil {
+		t.Fatalf("GenerateTLSMaterial() error = %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: secure\n\n")
+	}))
+	server.TLS = material.ServerConfig()
+	server.StartTLS()
+	defer server.Close()
+
+	config := &ServerTestConfig{Logger: logger.NewLogger(), TLS: material}
+	defer config.runCleanups()
+	stream, err := config.OpenSSE(server.URL)
+	if err != nil {
+		t.Fatalf("config.OpenSSE() error = %v", err)
+	}
+	if event, err := stream.Next(time.Second); err != nil || event.Data != "secure" {
+		t.Errorf("Next() = %+v, %v, want the event", event, err)
+	}
+}
@@ -0,0 +1,214 @@
+package testserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TLSMaterial is an ephemeral CA and a leaf certificate signed by it, written
+// to disk so the user's server can load them.
+type TLSMaterial struct {
+	Dir        string
+	CACertPath string
+	CertPath   string
+	KeyPath    string
+	CACert     *x509.Certificate
+	Leaf       *x509.Certificate
+	pool       *x509.CertPool
+	keyPair    tls.Certificate
+}
+
+var defaultTLSHosts = []string{"localhost", "127.0.0.1", "::1"}
+
+func GenerateTLSMaterial(dir string, hosts ...string) (*TLSMaterial, error) {
+	if len(hosts) == 0 {
+		hosts = defaultTLSHosts
+	}
+	notBefore := time.Now().Add(-time.Hour)
+	notAfter := time.Now().Add(24 * time.Hour)
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate CA key: %v", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{CommonName: "Buildium Test CA", Organization: []string{"Buildium"}},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CA certificate: %v", err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate server key: %v", err)
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{CommonName: hosts[0], Organization: []string{"Buildium"}},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			leafTemplate.IPAddresses = append(leafTemplate.IPAddresses, ip)
+		} else {
+			leafTemplate.DNSNames = append(leafTemplate.DNSNames, host)
+		}
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, caCert, &leafKey.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create server certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(leafDER)
+	if err != nil {
+		return nil, err
+	}
+	leafKeyDER, err := x509.MarshalECPrivateKey(leafKey)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &TLSMaterial{
+		Dir:        dir,
+		CACertPath: filepath.Join(dir, "ca.pem"),
+		CertPath:   filepath.Join(dir, "cert.pem"),
+		KeyPath:    filepath.Join(dir, "key.pem"),
+		CACert:     caCert,
+		Leaf:       leaf,
+		pool:       x509.NewCertPool(),
+	}
+	m.pool.AddCert(caCert)
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: leafKeyDER})
+	if err := os.WriteFile(m.CACertPath, caPEM, 0644); err != nil {
+		return nil, err
+	}
+	// The chain is included so servers that only load one file still present the CA
+	if err := os.WriteFile(m.CertPath, append(certPEM, caPEM...), 0644); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(m.KeyPath, keyPEM, 0600); err != nil {
+		return nil, err
+	}
+	m.keyPair, err = tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Env is how the certificate is handed to the user's server.
+func (m *TLSMaterial) Env() map[string]string {
+	return map[string]string{
+		"BUILDIUM_TLS_CERT": m.CertPath,
+		"BUILDIUM_TLS_KEY":  m.KeyPath,
+		"BUILDIUM_TLS_CA":   m.CACertPath,
+	}
+}
+
+// ServerConfig is a tls.Config serving the leaf certificate, for harness-side servers.
+func (m *TLSMaterial) ServerConfig() *tls.Config {
+	return &tls.Config{Certificates: []tls.Certificate{m.keyPair}}
+}
+
+// ClientConfig is a tls.Config trusting only the ephemeral CA.
+func (m *TLSMaterial) ClientConfig() *tls.Config {
+	return &tls.Config{RootCAs: m.pool}
+}
+
+// HTTPSClient trusts only the ephemeral CA and offers HTTP/2 via ALPN.
+func (m *TLSMaterial) HTTPSClient() *http.Client {
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig:   m.ClientConfig(),
+			ForceAttemptHTTP2: true,
+		},
+	}
+}
+
+func (m *TLSMaterial) Close() error {
+	return os.RemoveAll(m.Dir)
+}
+
+func AssertTLSVersion(resp *http.Response, version uint16) error {
+	if resp.TLS == nil {
+		return fmt.Errorf("response was not served over TLS")
+	}
+	if resp.TLS.Version != version {
+		return fmt.Errorf("expected %s, negotiated %s", tls.VersionName(version), tls.VersionName(resp.TLS.Version))
+	}
+	return nil
+}
+
+func AssertMinTLSVersion(resp *http.Response, version uint16) error {
+	if resp.TLS == nil {
+		return fmt.Errorf("response was not served over TLS")
+	}
+	if resp.TLS.Version < version {
+		return fmt.Errorf("expected at least %s, negotiated %s", tls.VersionName(version), tls.VersionName(resp.TLS.Version))
+	}
+	return nil
+}
+
+// AssertNegotiatedProtocol checks the ALPN result, e.g. "h2" or "http/1.1".
+func AssertNegotiatedProtocol(resp *http.Response, protocol string) error {
+	if resp.TLS == nil {
+		return fmt.Errorf("response was not served over TLS")
+	}
+	negotiated := resp.TLS.NegotiatedProtocol
+	if negotiated == "" {
+		negotiated = "http/1.1"
+	}
+	if negotiated != protocol {
+		return fmt.Errorf("expected ALPN protocol %q, negotiated %q (response protocol %s)", protocol, negotiated, resp.Proto)
+	}
+	return nil
+}
+
+// AssertServesCertificate checks the server presented the harness-issued leaf
+// certificate and that it is valid for host.
+func (m *TLSMaterial) AssertServesCertificate(resp *http.Response, host string) error {
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		return fmt.Errorf("response was not served over TLS")
+	}
+	served := resp.TLS.PeerCertificates[0]
+	if served.SerialNumber.Cmp(m.Leaf.SerialNumber) != 0 {
+		return fmt.Errorf("server presented certificate %q issued by %q, expected the harness certificate from %s", served.Subject.CommonName, served.Issuer.CommonName, m.CertPath)
+	}
+	if err := served.VerifyHostname(host); err != nil {
+		return err
+	}
+	return nil
+}
+
+func randomSerial() *big.Int {
+	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	return serial
+}
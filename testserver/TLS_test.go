@@ -0,0 +1,123 @@
+package testserver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTLSTestServer(t *testing.T, material *TLSMaterial, http2 bool) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Proto)
+	}))
+	server.TLS = material.ServerConfig()
+	server.EnableHTTP2 = http2
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGenerateTLSMaterialWritesFiles(t *testing.T) {
+	material, err := GenerateTLSMaterial(t.TempDir())
+	if err != nil {
+		t.Fatalf("GenerateTLSMaterial() error = %v", err)
+	}
+
+	for _, path := range []string{material.CACertPath, material.CertPath, material.KeyPath} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %s to exist: %v", filepath.Base(path), err)
+		}
+	}
+	if _, err := tls.LoadX509KeyPair(material.CertPath, material.KeyPath); err != nil {
+		t.Errorf("written cert/key pair cannot be loaded: %v", err)
+	}
+	if err := material.Leaf.CheckSignatureFrom(material.CACert); err != nil {
+		t.Errorf("leaf is not signed by the CA: %v", err)
+	}
+	if err := material.Leaf.VerifyHostname("localhost"); err != nil {
+		t.Errorf("leaf is not valid for localhost: %v", err)
+	}
+	if err := material.Leaf.VerifyHostname("127.0.0.1"); err != nil {
+		t.Errorf("leaf is not valid for 127.0.0.1: %v", err)
+	}
+
+	env := material.Env()
+	if env["BUILDIUM_TLS_CERT"] != material.CertPath || env["BUILDIUM_TLS_KEY"] != material.KeyPath {
+		t.Errorf("Env() = %v, want cert and key paths", env)
+	}
+}
+
+func TestHTTPSClientNegotiatesHTTP2(t *testing.T) {
+	material, err := GenerateTLSMaterial(t.TempDir())
+	if err != nil {
+		t.Fatalf("GenerateTLSMaterial() error = %v", err)
+	}
+	server := newTLSTestServer(t, material, true)
+
+	resp, err := material.HTTPSClient().Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	if err := AssertNegotiatedProtocol(resp, "h2"); err != nil {
+		t.Error(err)
+	}
+	if err := AssertMinTLSVersion(resp, tls.VersionTLS12); err != nil {
+		t.Error(err)
+	}
+	if err := AssertTLSVersion(resp, tls.VersionTLS13); err != nil {
+		t.Error(err)
+	}
+	if err := material.AssertServesCertificate(resp, "127.0.0.1"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHTTPSClientHTTP1Only(t *testing.T) {
+	material, err := GenerateTLSMaterial(t.TempDir())
+	if err != nil {
+		t.Fatalf("GenerateTLSMaterial() error = %v", err)
+	}
+	server := newTLSTestServer(t, material, false)
+
+	resp, err := material.HTTPSClient().Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	if err := AssertNegotiatedProtocol(resp, "h2"); err == nil {
+		t.Error("AssertNegotiatedProtocol() should fail when the server only speaks HTTP/1.1")
+	}
+	if err := AssertNegotiatedProtocol(resp, "http/1.1"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHTTPSClientRejectsOtherCertificates(t *testing.T) {
+	material, err := GenerateTLSMaterial(t.TempDir())
+	if err != nil {
+		t.Fatalf("GenerateTLSMaterial() error = %v", err)
+	}
+	other, err := GenerateTLSMaterial(t.TempDir())
+	if err != nil {
+		t.Fatalf("GenerateTLSMaterial() error = %v", err)
+	}
+	server := newTLSTestServer(t, other, true)
+
+	if _, err := material.HTTPSClient().Get(server.URL); err == nil {
+		t.Error("HTTPSClient() should not trust certificates from another CA")
+	}
+}
+
+func TestAssertTLSVersionPlainHTTP(t *testing.T) {
+	resp := &http.Response{}
+	if err := AssertTLSVersion(resp, tls.VersionTLS13); err == nil {
+		t.Error("AssertTLSVersion() should fail for a response without TLS")
+	}
+}
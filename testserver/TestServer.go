@@ -3,29 +3,79 @@ package testserver
 import (
 	"context"
 	"fmt"
+	"os"
 	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
+	"github.com/buildium-org/buildium_harness/diagnostics"
 	"github.com/buildium-org/buildium_harness/logger"
 )
 
 type TestServer struct {
 	executable string
+	args       []string
+	sourceDir  string
 	logger     *logger.Logger
+	env        []string
+	mu         sync.Mutex
 	cleanup    func()
 	running    bool
+	pid        atomic.Int64
 }
 
 func NewTestServer(executable string, logger *logger.Logger) *TestServer {
 	return &TestServer{executable: executable, logger: logger}
 }
 
+// SetArgs sets the arguments the server is started with, such as the script
+// when executable is an interpreter.
+func (t *TestServer) SetArgs(args ...string) {
+	t.args = args
+}
+
+// SetSourceDir sets the learner's source tree, used to spot stale binaries
+// when the server fails to start.
+func (t *TestServer) SetSourceDir(dir string) {
+	t.sourceDir = dir
+}
+
+// SetEnv sets an environment variable for the next time the server starts.
+func (t *TestServer) SetEnv(key, value string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.unsetEnv(key)
+	t.env = append(t.env, key+"="+value)
+}
+
+func (t *TestServer) UnsetEnv(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.unsetEnv(key)
+}
+
+func (t *TestServer) unsetEnv(key string) {
+	t.env = slices.DeleteFunc(t.env, func(entry string) bool {
+		return strings.HasPrefix(entry, key+"=")
+	})
+}
+
 func (t *TestServer) Start() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.running {
+		return
+	}
 	serverCtx := context.Background()
 	serverCtx, cancel := context.WithCancel(serverCtx)
 	serverDone := make(chan error, 1)
+	env := slices.Clone(t.env)
 	go func() {
-		serverDone <- t.startServer(serverCtx)
+		serverDone <- t.startServer(serverCtx, env)
 	}()
 
 	cleanup := func() {
@@ -33,36 +83,57 @@ func (t *TestServer) Start() {
 		<-serverDone // Wait for server to actually terminate
 	}
 	t.cleanup = cleanup
+	t.running = true
 }
 
 func (t *TestServer) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	if !t.running {
 		return
 	}
 	t.cleanup()
+	t.running = false
 }
 
-func (t *TestServer) startServer(ctx context.Context) error {
-	cmd := exec.Command(t.executable)
+// Pid returns the pid of the running server process, or 0.
+func (t *TestServer) Pid() int {
+	return int(t.pid.Load())
+}
+
+// Restart stops the server and starts it again, picking up any environment
+// changes made since it was started.
+func (t *TestServer) Restart() {
+	t.Stop()
+	t.Start()
+}
+
+func (t *TestServer) startServer(ctx context.Context, env []string) error {
+	cmd := exec.Command(t.executable, t.args...)
+	cmd.Env = append(os.Environ(), env...)
 	// Create a new process group so we can kill all child processes
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
 	cmd.Stdout = t.logger.Writer()
 	cmd.Stderr = t.logger.Writer()
+	// Processes that escape the group keep the output pipes open; don't let
+	// them block Wait once the server itself has exited
+	cmd.WaitDelay = time.Second
 
 	if err := cmd.Start(); err != nil {
 		t.logger.LogError(fmt.Sprintf("%v", err))
+		diagnostics.Inspect(t.executable, t.sourceDir).Log(t.logger)
 		return err
 	}
+	t.pid.Store(int64(cmd.Process.Pid))
+	defer t.pid.Store(0)
 
 	// Wait for context cancellation in a separate goroutine
 	go func() {
 		<-ctx.Done()
 		// Kill the entire process group (negative PID)
 		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
-		t.running = false
 	}()
 
-	t.running = true
 	return cmd.Wait()
 }
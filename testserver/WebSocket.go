@@ -0,0 +1,605 @@
+package testserver
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	WebSocketContinuation = 0x0
+	WebSocketText         = 0x1
+	WebSocketBinary       = 0x2
+	WebSocketClose        = 0x8
+	WebSocketPing         = 0x9
+	WebSocketPong         = 0xA
+)
+
+const (
+	WebSocketCloseNormal          = 1000
+	WebSocketCloseGoingAway       = 1001
+	WebSocketCloseProtocolError   = 1002
+	WebSocketCloseUnsupportedData = 1003
+	WebSocketCloseNoStatus        = 1005
+	WebSocketCloseAbnormal        = 1006
+	WebSocketCloseInvalidPayload  = 1007
+	WebSocketClosePolicyViolation = 1008
+	WebSocketCloseMessageTooBig   = 1009
+	WebSocketCloseInternalError   = 1011
+)
+
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// webSocketCloseWait is how long Close waits for the server's close frame.
+var webSocketCloseWait = time.Second
+
+type WebSocketMessage struct {
+	Type int
+	Data []byte
+}
+
+func (m WebSocketMessage) Text() string {
+	return string(m.Data)
+}
+
+type WebSocketConn struct {
+	conn        net.Conn
+	reader      *bufio.Reader
+	writeMu     sync.Mutex
+	messages    chan WebSocketMessage
+	pongs       chan []byte
+	done        chan struct{}
+	closeOnce   sync.Once
+	closeCode   int
+	closeReason string
+	err         error
+}
+
+type wsFrame struct {
+	fin     bool
+	opcode  byte
+	masked  bool
+	payload []byte
+}
+
+func DialWebSocket(rawUrl string, headers http.Header) (*WebSocketConn, error) {
+	return dialWebSocket(rawUrl, headers, nil, nil)
+}
+
+// dialWebSocket verifies wss:// servers against tlsConfig's roots, or the
+// system roots if tlsConfig is nil, and records the handshake in har if set.
+func dialWebSocket(rawUrl string, headers http.Header, tlsConfig *tls.Config, har *HARRecorder) (*WebSocketConn, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid websocket url %q: %v", rawUrl, err)
+	}
+	host := u.Host
+	start := time.Now()
+	var conn net.Conn
+	switch u.Scheme {
+	case "ws":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+		conn, err = net.DialTimeout("tcp", host, 5*time.Second)
+	case "wss":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		}
+		config := &tls.Config{}
+		if tlsConfig != nil {
+			config = tlsConfig.Clone()
+		}
+		config.ServerName = u.Hostname()
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", host, config)
+	default:
+		return nil, fmt.Errorf("unsupported websocket scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", host, err)
+	}
+
+	keyBytes := make([]byte, 16)
+	rand.Read(keyBytes)
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	req.URL.Scheme = "http"
+	for name, values := range headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send handshake: %v", err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	har.addUpgrade(u.String(), req, resp, start, err)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read handshake response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, fmt.Errorf("handshake failed: expected status 101, got %d", resp.StatusCode)
+	}
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") {
+		conn.Close()
+		return nil, fmt.Errorf("handshake failed: expected Upgrade: websocket, got %q", resp.Header.Get("Upgrade"))
+	}
+	if !headerContainsToken(resp.Header, "Connection", "upgrade") {
+		conn.Close()
+		return nil, fmt.Errorf("handshake failed: expected Connection: Upgrade, got %q", resp.Header.Get("Connection"))
+	}
+	if expected := webSocketAccept(key); resp.Header.Get("Sec-WebSocket-Accept") != expected {
+		conn.Close()
+		return nil, fmt.Errorf("handshake failed: expected Sec-WebSocket-Accept %q, got %q", expected, resp.Header.Get("Sec-WebSocket-Accept"))
+	}
+	conn.SetDeadline(time.Time{})
+
+	ws := &WebSocketConn{
+		conn:     conn,
+		reader:   reader,
+		messages: make(chan WebSocketMessage, 64),
+		pongs:    make(chan []byte, 8),
+		done:     make(chan struct{}),
+	}
+	go ws.readLoop()
+	return ws, nil
+}
+
+func DialWebSockets(rawUrl string, count int) ([]*WebSocketConn, error) {
+	return dialWebSockets(rawUrl, count, nil, nil)
+}
+
+func dialWebSockets(rawUrl string, count int, tlsConfig *tls.Config, har *HARRecorder) ([]*WebSocketConn, error) {
+	conns := make([]*WebSocketConn, count)
+	errs := make([]error, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conns[i], errs[i] = dialWebSocket(rawUrl, nil, tlsConfig, har)
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			for _, conn := range conns {
+				if conn != nil {
+					conn.Close(WebSocketCloseGoingAway, "")
+				}
+			}
+			return nil, fmt.Errorf("connection %d: %v", i, err)
+		}
+	}
+	return conns, nil
+}
+
+// AssertBroadcast sends message on sender and expects every receiver to get it within timeout.
+func AssertBroadcast(sender *WebSocketConn, receivers []*WebSocketConn, message string, timeout time.Duration) error {
+	if err := sender.SendText(message); err != nil {
+		return fmt.Errorf("failed to send %q: %v", message, err)
+	}
+	errs := make([]error, len(receivers))
+	var wg sync.WaitGroup
+	for i, receiver := range receivers {
+		wg.Add(1)
+		go func(i int, receiver *WebSocketConn) {
+			defer wg.Done()
+			deadline := time.Now().Add(timeout)
+			for {
+				msg, err := receiver.Receive(time.Until(deadline))
+				if err != nil {
+					errs[i] = fmt.Errorf("receiver %d did not get %q within %v: %v", i, message, timeout, err)
+					return
+				}
+				if msg.Type == WebSocketText && msg.Text() == message {
+					return
+				}
+			}
+		}(i, receiver)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (w *WebSocketConn) SendText(message string) error {
+	return w.writeFrame(true, WebSocketText, []byte(message))
+}
+
+func (w *WebSocketConn) SendBinary(data []byte) error {
+	return w.writeFrame(true, WebSocketBinary, data)
+}
+
+// SendFragmented sends a single message split across one frame per part.
+func (w *WebSocketConn) SendFragmented(opcode byte, parts [][]byte) error {
+	if len(parts) == 0 {
+		return w.writeFrame(true, opcode, nil)
+	}
+	for i, part := range parts {
+		frameOpcode := byte(WebSocketContinuation)
+		if i == 0 {
+			frameOpcode = opcode
+		}
+		if err := w.writeFrame(i == len(parts)-1, frameOpcode, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ping sends a ping and waits for the matching pong.
+func (w *WebSocketConn) Ping(payload []byte, timeout time.Duration) error {
+	if len(payload) > 125 {
+		return fmt.Errorf("ping payload must be at most 125 bytes, got %d", len(payload))
+	}
+	if err := w.writeFrame(true, WebSocketPing, payload); err != nil {
+		return err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case pong := <-w.pongs:
+			if string(pong) == string(payload) {
+				return nil
+			}
+		case <-w.done:
+			return fmt.Errorf("connection closed before pong: %v", w.Err())
+		case <-timer.C:
+			return fmt.Errorf("no pong received within %v", timeout)
+		}
+	}
+}
+
+func (w *WebSocketConn) Receive(timeout time.Duration) (WebSocketMessage, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case msg := <-w.messages:
+		return msg, nil
+	case <-w.done:
+		select {
+		case msg := <-w.messages:
+			return msg, nil
+		default:
+		}
+		return WebSocketMessage{}, fmt.Errorf("connection closed: %v", w.Err())
+	case <-timer.C:
+		return WebSocketMessage{}, fmt.Errorf("no message received within %v", timeout)
+	}
+}
+
+func (w *WebSocketConn) ReceiveText(timeout time.Duration) (string, error) {
+	msg, err := w.Receive(timeout)
+	if err != nil {
+		return "", err
+	}
+	if msg.Type != WebSocketText {
+		return "", fmt.Errorf("expected text message, got opcode %d", msg.Type)
+	}
+	return msg.Text(), nil
+}
+
+// Close performs the closing handshake, waiting briefly for the server's close frame.
+func (w *WebSocketConn) Close(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	err := w.writeFrame(true, WebSocketClose, payload)
+	select {
+	case <-w.done:
+	case <-time.After(webSocketCloseWait):
+	}
+	w.shutdown(0, "", nil)
+	return err
+}
+
+// CloseCode is the status code received from the server, or 0 if none was received.
+func (w *WebSocketConn) CloseCode() int {
+	<-w.done
+	return w.closeCode
+}
+
+func (w *WebSocketConn) CloseReason() string {
+	<-w.done
+	return w.closeReason
+}
+
+func (w *WebSocketConn) Done() <-chan struct{} {
+	return w.done
+}
+
+func (w *WebSocketConn) Err() error {
+	select {
+	case <-w.done:
+		return w.err
+	default:
+		return nil
+	}
+}
+
+func (w *WebSocketConn) readLoop() {
+	var fragments []byte
+	var fragmentOpcode byte
+	for {
+		frame, err := readFrame(w.reader)
+		if err != nil {
+			w.shutdown(0, "", err)
+			return
+		}
+		if frame.masked {
+			w.fail(WebSocketCloseProtocolError, "server frames must not be masked")
+			return
+		}
+		switch frame.opcode {
+		case WebSocketPing:
+			w.writeFrame(true, WebSocketPong, frame.payload)
+		case WebSocketPong:
+			select {
+			case w.pongs <- frame.payload:
+			default:
+			}
+		case WebSocketClose:
+			code := WebSocketCloseNoStatus
+			reason := ""
+			if len(frame.payload) == 1 {
+				w.fail(WebSocketCloseProtocolError, "close frame payload of 1 byte")
+				return
+			}
+			if len(frame.payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(frame.payload))
+				reason = string(frame.payload[2:])
+			}
+			w.writeFrame(true, WebSocketClose, frame.payload[:min(len(frame.payload), 2)])
+			w.shutdown(code, reason, nil)
+			return
+		case WebSocketText, WebSocketBinary:
+			if fragments != nil {
+				w.fail(WebSocketCloseProtocolError, "new data frame received before fragmented message finished")
+				return
+			}
+			if frame.fin {
+				if !w.deliver(frame.opcode, frame.payload) {
+					return
+				}
+			} else {
+				fragmentOpcode = frame.opcode
+				fragments = append([]byte{}, frame.payload...)
+			}
+		case WebSocketContinuation:
+			if fragments == nil {
+				w.fail(WebSocketCloseProtocolError, "continuation frame without a started message")
+				return
+			}
+			fragments = append(fragments, frame.payload...)
+			if frame.fin {
+				if !w.deliver(fragmentOpcode, fragments) {
+					return
+				}
+				fragments = nil
+			}
+		default:
+			w.fail(WebSocketCloseProtocolError, fmt.Sprintf("unknown opcode %d", frame.opcode))
+			return
+		}
+	}
+}
+
+func (w *WebSocketConn) deliver(opcode byte, payload []byte) bool {
+	if opcode == WebSocketText && !utf8.Valid(payload) {
+		w.fail(WebSocketCloseInvalidPayload, "text message is not valid UTF-8")
+		return false
+	}
+	select {
+	case w.messages <- WebSocketMessage{Type: int(opcode), Data: payload}:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+func (w *WebSocketConn) fail(code int, reason string) {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	w.writeFrame(true, WebSocketClose, payload)
+	w.shutdown(0, "", fmt.Errorf("protocol violation: %s", reason))
+}
+
+// shutdown closes the connection once, recording the close code and reason
+// received from the server, or 0 and "" when none was.
+func (w *WebSocketConn) shutdown(code int, reason string, err error) {
+	w.closeOnce.Do(func() {
+		w.closeCode, w.closeReason = code, reason
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+			w.err = err
+		}
+		if w.closeCode == 0 && w.err == nil && err != nil {
+			w.closeCode = WebSocketCloseAbnormal
+		}
+		w.conn.Close()
+		close(w.done)
+	})
+}
+
+func (w *WebSocketConn) writeFrame(fin bool, opcode byte, payload []byte) error {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+	return writeFrame(w.conn, fin, opcode, payload, true)
+}
+
+func writeFrame(out io.Writer, fin bool, opcode byte, payload []byte, mask bool) error {
+	header := make([]byte, 0, 14)
+	first := opcode & 0x0F
+	if fin {
+		first |= 0x80
+	}
+	header = append(header, first)
+	var maskBit byte
+	if mask {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) <= 125:
+		header = append(header, maskBit|byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		header = append(header, maskBit|126)
+		header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	default:
+		header = append(header, maskBit|127)
+		header = binary.BigEndian.AppendUint64(header, uint64(len(payload)))
+	}
+	data := payload
+	if mask {
+		maskKey := make([]byte, 4)
+		rand.Read(maskKey)
+		header = append(header, maskKey...)
+		data = make([]byte, len(payload))
+		for i := range payload {
+			data[i] = payload[i] ^ maskKey[i%4]
+		}
+	}
+	if _, err := out.Write(append(header, data...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func readFrame(in *bufio.Reader) (wsFrame, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(in, head); err != nil {
+		return wsFrame{}, err
+	}
+	if head[0]&0x70 != 0 {
+		return wsFrame{}, fmt.Errorf("reserved bits set in frame header")
+	}
+	frame := wsFrame{fin: head[0]&0x80 != 0, opcode: head[0] & 0x0F, masked: head[1]&0x80 != 0}
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(in, ext); err != nil {
+			return wsFrame{}, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(in, ext); err != nil {
+			return wsFrame{}, err
+		}
+		length = binary.BigEndian.Uint64(ext)
+	}
+	if frame.opcode >= WebSocketClose && (length > 125 || !frame.fin) {
+		return wsFrame{}, fmt.Errorf("invalid control frame (opcode %d, length %d, fin %v)", frame.opcode, length, frame.fin)
+	}
+	if length > 64<<20 {
+		return wsFrame{}, fmt.Errorf("frame too large: %d bytes", length)
+	}
+	var maskKey []byte
+	if frame.masked {
+		maskKey = make([]byte, 4)
+		if _, err := io.ReadFull(in, maskKey); err != nil {
+			return wsFrame{}, err
+		}
+	}
+	frame.payload = make([]byte, length)
+	if _, err := io.ReadFull(in, frame.payload); err != nil {
+		return wsFrame{}, err
+	}
+	if frame.masked {
+		for i := range frame.payload {
+			frame.payload[i] ^= maskKey[i%4]
+		}
+	}
+	return frame, nil
+}
+
+func webSocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *ServerTestConfig) DialWebSocket(rawUrl string) (*WebSocketConn, error) {
+	c.Logger.LogInfo("Opening websocket connection to " + rawUrl)
+	conn, err := dialWebSocket(rawUrl, nil, c.tlsClientConfig(), c.HAR)
+	if err != nil {
+		c.Logger.LogError(fmt.Sprintf("websocket connection failed: %v", err))
+		return nil, err
+	}
+	c.addCleanup(func() { closeWebSockets([]*WebSocketConn{conn}) })
+	return conn, nil
+}
+
+func (c *ServerTestConfig) DialWebSockets(rawUrl string, count int) ([]*WebSocketConn, error) {
+	c.Logger.LogInfo(fmt.Sprintf("Opening %d websocket connections to %s", count, rawUrl))
+	conns, err := dialWebSockets(rawUrl, count, c.tlsClientConfig(), c.HAR)
+	if err != nil {
+		c.Logger.LogError(fmt.Sprintf("websocket connections failed: %v", err))
+		return nil, err
+	}
+	c.addCleanup(func() { closeWebSockets(conns) })
+	return conns, nil
+}
+
+// tlsClientConfig trusts the run's CA, when the run has one.
+func (c *ServerTestConfig) tlsClientConfig() *tls.Config {
+	if c.TLS == nil {
+		return nil
+	}
+	return c.TLS.ClientConfig()
+}
+
+func closeWebSockets(conns []*WebSocketConn) {
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		select {
+		case <-conn.Done():
+		default:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				conn.Close(WebSocketCloseGoingAway, "step finished")
+			}()
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,291 @@
+package testserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/buildium-org/buildium_harness/logger"
+)
+
+// Minimal websocket server used to exercise the client. Text messages are
+// broadcast to every connection, "ping-me" triggers a server ping and
+// "close-me" triggers a server-initiated close.
+type wsTestServer struct {
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (s *wsTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/reject" {
+		http.Error(w, "nope", http.StatusForbidden)
+		return
+	}
+	conn, rw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	accept := webSocketAccept(r.Header.Get("Sec-WebSocket-Key"))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " + accept + "\r\n\r\n")
+	rw.Flush()
+
+	s.mu.Lock()
+	s.conns = append(s.conns, conn)
+	s.mu.Unlock()
+
+	reader := bufio.NewReader(rw)
+	for {
+		frame, err := readFrame(reader)
+		if err != nil {
+			return
+		}
+		switch frame.opcode {
+		case WebSocketPing:
+			writeFrame(conn, true, WebSocketPong, frame.payload, false)
+		case WebSocketClose:
+			writeFrame(conn, true, WebSocketClose, frame.payload, false)
+			conn.Close()
+			return
+		case WebSocketBinary:
+			writeFrame(conn, true, WebSocketBinary, frame.payload, false)
+		case WebSocketText:
+			switch string(frame.payload) {
+			case "ping-me":
+				writeFrame(conn, true, WebSocketPing, []byte("hello"), false)
+			case "close-me":
+				payload := binary.BigEndian.AppendUint16(nil, WebSocketClosePolicyViolation)
+				writeFrame(conn, true, WebSocketClose, append(payload, "bye"...), false)
+			case "fragment-me":
+				writeFrame(conn, false, WebSocketText, []byte("frag"), false)
+				writeFrame(conn, true, WebSocketPing, []byte("mid"), false)
+				writeFrame(conn, true, WebSocketContinuation, []byte("mented"), false)
+			default:
+				s.mu.Lock()
+				for _, c := range s.conns {
+					writeFrame(c, true, WebSocketText, frame.payload, false)
+				}
+				s.mu.Unlock()
+			}
+		}
+	}
+}
+
+func newWebSocketTestServer(t *testing.T) string {
+	server := httptest.NewServer(&wsTestServer{})
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestDialWebSocketSendAndReceive(t *testing.T) {
+	url := newWebSocketTestServer(t)
+	conn, err := DialWebSocket(url+"/chat", nil)
+	if err != nil {
+		t.Fatalf("DialWebSocket() error = %v", err)
+	}
+	defer conn.Close(WebSocketCloseNormal, "")
+
+	if err := conn.SendText("hello"); err != nil {
+		t.Fatalf("SendText() error = %v", err)
+	}
+	text, err := conn.ReceiveText(time.Second)
+	if err != nil {
+		t.Fatalf("ReceiveText() error = %v", err)
+	}
+	if text != "hello" {
+		t.Errorf("ReceiveText() = %q, want %q", text, "hello")
+	}
+
+	payload := bytes.Repeat([]byte{0xAB}, 70000)
+	if err := conn.SendBinary(payload); err != nil {
+		t.Fatalf("SendBinary() error = %v", err)
+	}
+	msg, err := conn.Receive(time.Second)
+	if err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if msg.Type != WebSocketBinary || !bytes.Equal(msg.Data, payload) {
+		t.Errorf("Receive() returned type %d with %d bytes, want binary with %d bytes", msg.Type, len(msg.Data), len(payload))
+	}
+}
+
+func TestDialWebSocketTrustsRunCA(t *testing.T) {
+	material, err := GenerateTLSMaterial(t.TempDir())
+	if err != nil {
+		t.Fatalf("GenerateTLSMaterial() error = %v", err)
+	}
+	server := httptest.NewUnstartedServer(&wsTestServer{})
+	server.TLS = material.ServerConfig()
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	url := "wss" + strings.TrimPrefix(server.URL, "https")
+
+	if _, err := DialWebSocket(url, nil); err == nil {
+		t.Fatal("DialWebSocket() trusted the run CA without being given it")
+	}
+	config := &ServerTestConfig{Logger: logger.NewLogger(), TLS: material}
+	conn, err := config.DialWebSocket(url)
+	if err != nil {
+		t.Fatalf("config.DialWebSocket() error = %v", err)
+	}
+	defer conn.Close(WebSocketCloseNormal, "")
+	if err := conn.SendText("hello"); err != nil {
+		t.Fatalf("SendText() error = %v", err)
+	}
+	if text, err := conn.ReceiveText(time.Second); err != nil || text != "hello" {
+		t.Errorf("ReceiveText() = %q, %v, want hello", text, err)
+	}
+}
+
+func TestDialWebSocketRejected(t *testing.T) {
+	url := newWebSocketTestServer(t)
+	_, err := DialWebSocket(url+"/reject", nil)
+	if err == nil {
+		t.Fatal("DialWebSocket() should fail when the server does not upgrade")
+	}
+	if !strings.Contains(err.Error(), "101") {
+		t.Errorf("error = %v, want mention of status 101", err)
+	}
+}
+
+func TestWebSocketPingPong(t *testing.T) {
+	url := newWebSocketTestServer(t)
+	conn, err := DialWebSocket(url, nil)
+	if err != nil {
+		t.Fatalf("DialWebSocket() error = %v", err)
+	}
+	defer conn.Close(WebSocketCloseNormal, "")
+
+	if err := conn.Ping([]byte("are you there"), time.Second); err != nil {
+		t.Errorf("Ping() error = %v", err)
+	}
+}
+
+func TestWebSocketFragmentedMessage(t *testing.T) {
+	url := newWebSocketTestServer(t)
+	conn, err := DialWebSocket(url, nil)
+	if err != nil {
+		t.Fatalf("DialWebSocket() error = %v", err)
+	}
+	defer conn.Close(WebSocketCloseNormal, "")
+
+	if err := conn.SendText("fragment-me"); err != nil {
+		t.Fatalf("SendText() error = %v", err)
+	}
+	text, err := conn.ReceiveText(time.Second)
+	if err != nil {
+		t.Fatalf("ReceiveText() error = %v", err)
+	}
+	if text != "fragmented" {
+		t.Errorf("ReceiveText() = %q, want %q", text, "fragmented")
+	}
+}
+
+func TestWebSocketServerClose(t *testing.T) {
+	url := newWebSocketTestServer(t)
+	conn, err := DialWebSocket(url, nil)
+	if err != nil {
+		t.Fatalf("DialWebSocket() error = %v", err)
+	}
+	conn.SendText("close-me")
+
+	select {
+	case <-conn.Done():
+	case <-time.After(time.Second):
+		t.Fatal("connection was not closed by server")
+	}
+	if conn.CloseCode() != WebSocketClosePolicyViolation {
+		t.Errorf("CloseCode() = %d, want %d", conn.CloseCode(), WebSocketClosePolicyViolation)
+	}
+	if conn.CloseReason() != "bye" {
+		t.Errorf("CloseReason() = %q, want %q", conn.CloseReason(), "bye")
+	}
+}
+
+func TestWebSocketCloseWhileServerCloses(t *testing.T) {
+	closeWait := webSocketCloseWait
+	webSocketCloseWait = 0
+	t.Cleanup(func() { webSocketCloseWait = closeWait })
+	// The server closes as soon as the client connects, while the client closes too
+	var conns atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		accept := webSocketAccept(r.Header.Get("Sec-WebSocket-Key"))
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " + accept + "\r\n\r\n")
+		rw.Flush()
+		time.Sleep(time.Duration(conns.Add(1)%10) * 20 * time.Microsecond)
+		payload := binary.BigEndian.AppendUint16(nil, WebSocketCloseGoingAway)
+		writeFrame(conn, true, WebSocketClose, append(payload, "restarting"...), false)
+		readFrame(rw.Reader)
+	}))
+	t.Cleanup(server.Close)
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	for range 50 {
+		conn, err := DialWebSocket(url, nil)
+		if err != nil {
+			t.Fatalf("DialWebSocket() error = %v", err)
+		}
+		conn.Close(WebSocketCloseNormal, "")
+		if code := conn.CloseCode(); code != 0 && code != WebSocketCloseGoingAway {
+			t.Errorf("CloseCode() = %d, want the server's code or none", code)
+		}
+	}
+}
+
+func TestAssertBroadcast(t *testing.T) {
+	url := newWebSocketTestServer(t)
+	conns, err := DialWebSockets(url, 3)
+	if err != nil {
+		t.Fatalf("DialWebSockets() error = %v", err)
+	}
+	// Make sure every connection is registered before broadcasting
+	for _, conn := range conns {
+		if err := conn.Ping(nil, time.Second); err != nil {
+			t.Fatalf("Ping() error = %v", err)
+		}
+	}
+
+	if err := AssertBroadcast(conns[0], conns[1:], "hi all", time.Second); err != nil {
+		t.Errorf("AssertBroadcast() error = %v", err)
+	}
+
+	closeWebSockets(conns)
+	for i, conn := range conns {
+		select {
+		case <-conn.Done():
+		default:
+			t.Errorf("connection %d still open after closeWebSockets()", i)
+		}
+	}
+}
+
+func TestAssertBroadcastTimeout(t *testing.T) {
+	url := newWebSocketTestServer(t)
+	sender, err := DialWebSocket(url, nil)
+	if err != nil {
+		t.Fatalf("DialWebSocket() error = %v", err)
+	}
+	defer sender.Close(WebSocketCloseNormal, "")
+	receiver, err := DialWebSocket(url, nil)
+	if err != nil {
+		t.Fatalf("DialWebSocket() error = %v", err)
+	}
+	defer receiver.Close(WebSocketCloseNormal, "")
+
+	// ping-me is answered with a ping, never broadcast
+	if err := AssertBroadcast(sender, []*WebSocketConn{receiver}, "ping-me", 100*time.Millisecond); err == nil {
+		t.Error("AssertBroadcast() should fail when the message is not broadcast")
+	}
+}
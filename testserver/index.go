@@ -2,23 +2,68 @@ package testserver
 
 import (
 	"context"
+	"math/rand/v2"
 
 	"github.com/buildium-org/buildium_harness/logger"
-	"github.com/buildium-org/buildium_harness/meta"
-	"github.com/buildium-org/buildium_harness/utils"
+	"github.com/buildium-org/buildium_harness/runner"
 )
 
 type ServerTestConfig struct {
 	Logger *logger.Logger
 	Server *TestServer
+	TLS    *TLSMaterial
+	HAR    *HARRecorder
+	// Resources samples the server's process tree while the step runs.
+	Resources *ResourceMonitor
+	// ctx is done when the step times out or the run is cancelled.
+	ctx context.Context
+	// Rand generates random inputs that replay with the run's seed; see
+	// runner.Session.
+	Rand *rand.Rand
+
+	cleanups []func()
+}
+
+// Case is one input checked within a step; see runner.Case.
+type Case = runner.Case[*ServerTestConfig]
+
+// RunCases runs each case and logs a per-case summary; see runner.RunCases.
+func (c *ServerTestConfig) RunCases(cases ...Case) error {
+	return runner.RunCases(c.Logger, c, cases)
 }
 
-func RunServerTest(steps []func(config *ServerTestConfig) error, skipSteps []int) {
-	meta := meta.NewMeta()
+// Context is done when the step times out or the run is cancelled, so
+// long-running checks can stop early.
+func (c *ServerTestConfig) Context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+func (c *ServerTestConfig) addCleanup(cleanup func()) {
+	c.cleanups = append(c.cleanups, cleanup)
+}
+
+func (c *ServerTestConfig) runCleanups() {
+	for i := len(c.cleanups) - 1; i >= 0; i-- {
+		c.cleanups[i]()
+	}
+	c.cleanups = nil
+}
+
+func RunServerTest(steps []func(config *ServerTestConfig) error, skipSteps []int) *runner.RunResult {
+	return runner.MainWithIndexSkips(NewEnvironment(), runner.Steps(steps...), skipSteps, Hooks{})
+}
+
+// RunServerSteps is RunServerTest for named steps, skipping steps by Id.
+// The harness flags (-path, -step, -list...) are parsed from the command line;
+// see runner.ParseFlags.
+func RunServerSteps(steps []Step, skipSteps []string) *runner.RunResult {
+	return runner.Main(NewEnvironment(), steps, skipSteps)
+}
 
-	logger := logger.NewLogger()
-	ctx := context.WithValue(context.Background(), "logger", logger)
-	runner := NewRunner(meta, steps, skipSteps)
-	runner.Run(ctx)
-	logger.LogInfo("Testing complete! See results at " + utils.GetProjectUrl(meta.ProjectId))
+// RunServerStepsWithHooks is RunServerSteps running hooks around the steps.
+func RunServerStepsWithHooks(steps []Step, skipSteps []string, hooks Hooks) *runner.RunResult {
+	return runner.MainWithHooks(NewEnvironment(), steps, skipSteps, hooks)
 }
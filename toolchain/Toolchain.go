@@ -0,0 +1,139 @@
+package toolchain
+
+import (
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/buildium-org/buildium_harness/meta"
+)
+
+// Profile describes how projects in one language are built and launched.
+type Profile struct {
+	Language string
+	// Tools must be on PATH before the project can be built or run.
+	Tools []string
+	// Install tells the learner how to get the tools.
+	Install string
+	// BuildCommand and Output are the default build, with {entrypoint} replaced
+	// by meta.json's entrypoint. Interpreted languages leave them empty.
+	BuildCommand string
+	Output       string
+	// Interpreter launches the entrypoint as a script, e.g. python3 main.py.
+	Interpreter string
+}
+
+var profiles = map[string]Profile{
+	"go": {
+		Language:     "go",
+		Tools:        []string{"go"},
+		Install:      "Install Go from https://go.dev/dl/",
+		BuildCommand: "go build -o {entrypoint} .",
+		Output:       "{entrypoint}",
+	},
+	"rust": {
+		Language:     "rust",
+		Tools:        []string{"cargo"},
+		Install:      "Install Rust with rustup from https://rustup.rs/",
+		BuildCommand: "cargo build --release",
+		Output:       "target/release/{entrypoint}",
+	},
+	"python": {
+		Language:    "python",
+		Tools:       []string{"python3"},
+		Install:     "Install Python 3 from https://www.python.org/downloads/",
+		Interpreter: "python3",
+	},
+	"node": {
+		Language:    "node",
+		Tools:       []string{"node"},
+		Install:     "Install Node.js from https://nodejs.org/",
+		Interpreter: "node",
+	},
+}
+
+// Languages returns the supported values of meta.json's language field.
+func Languages() []string {
+	languages := make([]string, 0, len(profiles))
+	for language := range profiles {
+		languages = append(languages, language)
+	}
+	slices.Sort(languages)
+	return languages
+}
+
+func Lookup(language string) (Profile, error) {
+	profile, ok := profiles[strings.ToLower(language)]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown language %q in meta.json, expected one of %s",
+			language, strings.Join(Languages(), ", "))
+	}
+	return profile, nil
+}
+
+// Command is how the user's program is launched: a program and the arguments
+// that come before any a step adds.
+type Command struct {
+	Path string
+	Args []string
+}
+
+// Cmd returns an exec.Cmd running the command with args appended.
+func (c Command) Cmd(args ...string) *exec.Cmd {
+	return exec.Command(c.Path, append(slices.Clone(c.Args), args...)...)
+}
+
+func (c Command) String() string {
+	return strings.Join(append([]string{c.Path}, c.Args...), " ")
+}
+
+// Setup is a project's resolved build and launch configuration.
+type Setup struct {
+	// Language is empty for projects that ship a prebuilt entrypoint.
+	Language string
+	// Build is nil when there is nothing to compile.
+	Build    *meta.BuildConfig
+	BuildDir string
+	// Executable is the compiled binary, or the script for interpreted languages.
+	Executable string
+	Command    Command
+}
+
+// Interpreted reports whether the executable is a script run by an interpreter.
+func (s *Setup) Interpreted() bool {
+	return len(s.Command.Args) > 0
+}
+
+// Resolve works out how to build and launch the project described by m. An
+// explicit build in meta.json replaces the language's default build. It fails
+// when the language is unknown or its tools are not installed.
+func Resolve(m *meta.Meta) (*Setup, error) {
+	if m.Language == "" {
+		return &Setup{Build: m.Build, BuildDir: m.BuildDir(), Executable: m.Executable(),
+			Command: Command{Path: m.Executable()}}, nil
+	}
+	profile, err := Lookup(m.Language)
+	if err != nil {
+		return nil, err
+	}
+	resolved := *m
+	if resolved.Build == nil && profile.BuildCommand != "" {
+		resolved.Build = &meta.BuildConfig{
+			Command: strings.ReplaceAll(profile.BuildCommand, "{entrypoint}", m.Entrypoint),
+			Output:  strings.ReplaceAll(profile.Output, "{entrypoint}", m.Entrypoint),
+		}
+	}
+	for _, tool := range profile.Tools {
+		if _, err := exec.LookPath(tool); err != nil {
+			return nil, fmt.Errorf("%s projects need %s, but it was not found on your PATH. %s", profile.Language, tool, profile.Install)
+		}
+	}
+	setup := &Setup{Language: profile.Language, Build: resolved.Build, BuildDir: resolved.BuildDir(), Executable: resolved.Executable()}
+	setup.Command = Command{Path: setup.Executable}
+	if profile.Interpreter != "" {
+		interpreter, _ := exec.LookPath(profile.Interpreter)
+		setup.Command = Command{Path: interpreter, Args: []string{setup.Executable}}
+	}
+	return setup, nil
+}
@@ -0,0 +1,116 @@
+package toolchain
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/buildium-org/buildium_harness/meta"
+)
+
+// fakeTools puts stub programs with the given names on an otherwise empty PATH.
+func fakeTools(t *testing.T, names ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\necho \"$0 $*\"\n"), 0755); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	t.Setenv("PATH", dir)
+	return dir
+}
+
+func TestResolveWithoutLanguage(t *testing.T) {
+	m := &meta.Meta{Entrypoint: "app", ExecutableDir: "/project"}
+	setup, err := Resolve(m)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	want := &Setup{BuildDir: "/project", Executable: "/project/app", Command: Command{Path: "/project/app"}}
+	if !reflect.DeepEqual(setup, want) {
+		t.Errorf("Resolve() = %+v, want %+v", setup, want)
+	}
+}
+
+func TestResolveProfiles(t *testing.T) {
+	tools := fakeTools(t, "go", "cargo", "python3", "node")
+	cases := []struct {
+		language   string
+		build      string
+		executable string
+		command    Command
+	}{
+		{"go", "go build -o app .", "/project/app", Command{Path: "/project/app"}},
+		{"Rust", "cargo build --release", "/project/target/release/app", Command{Path: "/project/target/release/app"}},
+		{"python", "", "/project/app", Command{Path: filepath.Join(tools, "python3"), Args: []string{"/project/app"}}},
+		{"node", "", "/project/app", Command{Path: filepath.Join(tools, "node"), Args: []string{"/project/app"}}},
+	}
+	for _, test := range cases {
+		t.Run(test.language, func(t *testing.T) {
+			m := &meta.Meta{Entrypoint: "app", ExecutableDir: "/project", Language: test.language}
+			setup, err := Resolve(m)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			build := ""
+			if setup.Build != nil {
+				build = setup.Build.Command
+			}
+			if build != test.build || setup.Executable != test.executable || !reflect.DeepEqual(setup.Command, test.command) {
+				t.Errorf("Resolve() = %+v, build %q", setup, build)
+			}
+			if setup.Interpreted() != (test.build == "") {
+				t.Errorf("Interpreted() = %v", setup.Interpreted())
+			}
+			if m.Build != nil {
+				t.Error("Resolve() modified meta")
+			}
+		})
+	}
+}
+
+func TestResolveExplicitBuild(t *testing.T) {
+	fakeTools(t, "go")
+	m := &meta.Meta{Entrypoint: "app", ExecutableDir: "/project", Language: "go",
+		Build: &meta.BuildConfig{Command: "make", WorkingDir: "src", Output: "out/app"}}
+	setup, err := Resolve(m)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if setup.Build != m.Build || setup.BuildDir != "/project/src" || setup.Executable != "/project/out/app" {
+		t.Errorf("Resolve() = %+v, want the build from meta.json", setup)
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	fakeTools(t)
+	_, err := Resolve(&meta.Meta{Entrypoint: "main.rs", Language: "rust"})
+	if err == nil || !strings.Contains(err.Error(), "rust projects need cargo") || !strings.Contains(err.Error(), "rustup") {
+		t.Errorf("Resolve() error = %v, want missing cargo", err)
+	}
+	_, err = Resolve(&meta.Meta{Entrypoint: "main.rb", Language: "ruby"})
+	if err == nil || !strings.Contains(err.Error(), "go, node, python, rust") {
+		t.Errorf("Resolve() error = %v, want the supported languages", err)
+	}
+}
+
+func TestCommandCmd(t *testing.T) {
+	tools := fakeTools(t, "python3")
+	command := Command{Path: filepath.Join(tools, "python3"), Args: []string{"main.py"}}
+	output, err := command.Cmd("add", "1").Output()
+	if err != nil {
+		t.Fatalf("Cmd() error = %v", err)
+	}
+	if want := command.Path + " main.py add 1\n"; string(output) != want {
+		t.Errorf("Cmd() output = %q, want %q", output, want)
+	}
+	if len(command.Args) != 1 {
+		t.Errorf("Cmd() changed Args to %v", command.Args)
+	}
+	if command.String() != command.Path+" main.py" {
+		t.Errorf("String() = %q", command.String())
+	}
+}